@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+
+	assembler "github.com/RISC-GoV/risc-assembler"
+)
+
+// asmLine is a single source line split into its parts
+type asmLine struct {
+	Label   string   // label defined on this line, without the trailing ':'
+	Fields  []string // mnemonic or directive followed by its operands
+	Code    string   // the line without its comments, at the same byte offsets
+	Comment string   // comment text including the leading '#', '//' or '/*'
+}
+
+// stripComment splits a line into code and comment, ignoring comment
+// markers that appear inside string or character literals. inBlock is
+// whether the line starts inside a /* */ comment, and the line's state is
+// returned for the next one. Block comments within the code are blanked
+// out with spaces, so byte offsets into the code match the line.
+func stripComment(line string, inBlock bool) (string, string, bool) {
+	code := []byte(line)
+	var comments []string
+	inString := false
+	inChar := false
+	blockStart := 0
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inBlock:
+			if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+				i++
+				comments = append(comments, line[blockStart:i+1])
+				for j := blockStart; j <= i; j++ {
+					code[j] = ' '
+				}
+				inBlock = false
+			}
+		case c == '\\' && (inString || inChar):
+			i++ // Skip escaped character
+		case c == '"' && !inChar:
+			inString = !inString
+		case c == '\'' && !inString:
+			inChar = !inChar
+		case inString || inChar:
+			continue
+		case c == '/' && i+1 < len(line) && line[i+1] == '*':
+			inBlock = true
+			blockStart = i
+			i++
+		case c == '#' || c == '/' && i+1 < len(line) && line[i+1] == '/':
+			comments = append(comments, line[i:])
+			return string(code[:i]), strings.Join(comments, " "), false
+		}
+	}
+	if inBlock {
+		comments = append(comments, line[blockStart:])
+		code = code[:blockStart]
+	}
+	return string(code), strings.Join(comments, " "), inBlock
+}
+
+// blockCommentStates returns whether each line starts inside a /* */ comment
+func blockCommentStates(lines []string) []bool {
+	states := make([]bool, len(lines))
+	inBlock := false
+	for i, line := range lines {
+		states[i] = inBlock
+		_, _, inBlock = stripComment(line, inBlock)
+	}
+	return states
+}
+
+// parseAsmLines parses the lines of a source text, carrying /* */
+// comments from one line to the next
+func parseAsmLines(lines []string) []asmLine {
+	statements := make([]asmLine, len(lines))
+	inBlock := false
+	for i, line := range lines {
+		statements[i], inBlock = parseAsmLine(line, inBlock)
+	}
+	return statements
+}
+
+// parseAsmLine breaks a source line into label, statement fields and
+// comment, given whether it starts inside a /* */ comment, and returns
+// whether it ends inside one
+func parseAsmLine(line string, inBlock bool) (asmLine, bool) {
+	code, comment, inBlock := stripComment(line, inBlock)
+	result := asmLine{Code: code, Comment: comment}
+
+	code = strings.TrimSpace(code)
+	if colon := strings.Index(code, ":"); colon > 0 && isSymbolName(code[:colon]) {
+		result.Label = code[:colon]
+		code = strings.TrimSpace(code[colon+1:])
+	}
+
+	result.Fields = strings.Fields(code)
+	return result, inBlock
+}
+
+// isSymbolName reports whether name is a valid label or symbol identifier
+func isSymbolName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		case i > 0 && (c == '$' || (c >= '0' && c <= '9')):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Mnemonic returns the instruction or directive of the line, if any
+func (l asmLine) Mnemonic() string {
+	if len(l.Fields) == 0 {
+		return ""
+	}
+	return l.Fields[0]
+}
+
+// isInstruction reports whether mnemonic is known to the assembler as
+// either a base instruction or a pseudo-instruction
+func isInstruction(mnemonic string) bool {
+	_, isBase := assembler.InstructionToOpType[mnemonic]
+	_, isPseudo := assembler.PseudoToInstruction[mnemonic]
+	return isBase || isPseudo
+}
+
+// instructionWordCount returns how many machine instructions the statement
+// assembles to, expanding pseudo-instructions the same way the assembler does
+func instructionWordCount(fields []string) int {
+	if len(fields) == 0 {
+		return 0
+	}
+	if expand, isPseudo := assembler.PseudoToInstruction[fields[0]]; isPseudo {
+		return len(expand(fields))
+	}
+	if _, isBase := assembler.InstructionToOpType[fields[0]]; isBase {
+		return 1
+	}
+	return 0
+}
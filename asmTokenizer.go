@@ -0,0 +1,176 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// asmTokenKind is what a piece of a source line is
+type asmTokenKind int
+
+const (
+	tokenLabel           asmTokenKind = iota // Label definition, with its ':'
+	tokenInstruction                         // Base instruction mnemonic
+	tokenPseudo                              // Pseudo-instruction mnemonic
+	tokenDirective                           // Assembler directive or %hi/%lo style relocation
+	tokenRegister                            // Register operand
+	tokenNumber                              // Number literal
+	tokenString                              // String or character literal
+	tokenComment                             // Line or block comment
+	tokenSymbol                              // Label or constant used as an operand
+	tokenUnknownMnemonic                     // Mnemonic or directive the assembler does not know
+	tokenBadRegister                         // Looks like a register but does not exist
+)
+
+// asmToken is a token of a source line, as byte offsets into the line
+type asmToken struct {
+	kind       asmTokenKind
+	start, end int
+}
+
+// asmLineState is carried from one line to the next: whether the line
+// ends inside a /* */ comment or a macro body
+type asmLineState int
+
+const (
+	stateInBlockComment asmLineState = 1 << iota
+	stateInMacro
+)
+
+// reRegisterLike matches names that can only be meant as registers
+var reRegisterLike = regexp.MustCompile(`^(?:x|a|s|t|f|fa|fs|ft)[0-9]+$`)
+
+// tokenizeAsmLine splits a source line into tokens, given the state the
+// previous line ended in, and returns the state this line ends in. Words
+// are classified by their position in the statement, so registers and
+// numbers in comments or strings are never taken for what they are not.
+// macros are the names of the macros defined in the file.
+func tokenizeAsmLine(line string, state asmLineState, macros map[string]bool) ([]asmToken, asmLineState) {
+	var tokens []asmToken
+	add := func(kind asmTokenKind, start, end int) {
+		tokens = append(tokens, asmToken{kind: kind, start: start, end: end})
+	}
+
+	mnemonic := ""
+	for i := 0; i < len(line); {
+		c := line[i]
+
+		// Inside a block comment everything up to */ is comment
+		if state&stateInBlockComment != 0 {
+			end := strings.Index(line[i:], "*/")
+			if end < 0 {
+				add(tokenComment, i, len(line))
+				return tokens, state
+			}
+			add(tokenComment, i, i+end+2)
+			state &^= stateInBlockComment
+			i += end + 2
+			continue
+		}
+
+		switch {
+		case c == ' ' || c == '\t' || c == ',' || c == '(' || c == ')':
+			i++
+
+		case strings.HasPrefix(line[i:], "/*"):
+			state |= stateInBlockComment
+			add(tokenComment, i, i+2)
+			i += 2
+
+		case c == '#' || strings.HasPrefix(line[i:], "//"):
+			add(tokenComment, i, len(line))
+			return tokens, state
+
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(line) && line[end] != c {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(line))
+			add(tokenString, i, end)
+			i = end
+
+		case c >= '0' && c <= '9':
+			end := i
+			for end < len(line) && isSymbolChar(line[end]) && line[end] != '.' {
+				end++
+			}
+			add(tokenNumber, i, end)
+			i = end
+
+		case c == '%':
+			end := i + 1
+			for end < len(line) && isSymbolChar(line[end]) {
+				end++
+			}
+			if end > i+1 {
+				add(tokenDirective, i, end)
+			}
+			i = end
+
+		case isSymbolChar(c):
+			end := i
+			for end < len(line) && isSymbolChar(line[end]) {
+				end++
+			}
+			word := line[i:end]
+
+			if mnemonic == "" {
+				// A label is a word followed by ':' before the mnemonic
+				if rest := strings.TrimLeft(line[end:], " \t"); strings.HasPrefix(rest, ":") && isSymbolName(word) {
+					colon := len(line) - len(rest)
+					add(tokenLabel, i, colon+1)
+					i = colon + 1
+					continue
+				}
+				mnemonic = word
+				add(mnemonicKind(word, state&stateInMacro != 0, macros), i, end)
+				switch word {
+				case ".macro":
+					state |= stateInMacro
+				case ".endm":
+					state &^= stateInMacro
+				}
+			} else if vocabulary.instructions[mnemonic] || vocabulary.pseudos[mnemonic] {
+				add(operandTokenKind(word), i, end)
+			} else {
+				add(tokenSymbol, i, end)
+			}
+			i = end
+
+		default:
+			i++
+		}
+	}
+	return tokens, state
+}
+
+// mnemonicKind classifies the first word of a statement
+func mnemonicKind(word string, inMacro bool, macros map[string]bool) asmTokenKind {
+	switch {
+	case vocabulary.instructions[word]:
+		return tokenInstruction
+	case vocabulary.pseudos[word]:
+		return tokenPseudo
+	case vocabulary.directives[word]:
+		return tokenDirective
+	case inMacro || macros[word]:
+		// Macro bodies may call macros with arguments substituted
+		return tokenSymbol
+	}
+	return tokenUnknownMnemonic
+}
+
+// operandTokenKind classifies a word in the operands of an instruction
+func operandTokenKind(word string) asmTokenKind {
+	if vocabulary.registers[word] {
+		return tokenRegister
+	}
+	if reRegisterLike.MatchString(word) {
+		return tokenBadRegister
+	}
+	return tokenSymbol
+}
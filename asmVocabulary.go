@@ -0,0 +1,187 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	assembler "github.com/RISC-GoV/risc-assembler"
+)
+
+// instructionSignatures describes the operands of each mnemonic, as shown
+// by completion and signature help
+var instructionSignatures = map[string]string{
+	// RV32I register-register
+	"add": "rd, rs1, rs2", "sub": "rd, rs1, rs2", "sll": "rd, rs1, rs2", "slt": "rd, rs1, rs2",
+	"sltu": "rd, rs1, rs2", "xor": "rd, rs1, rs2", "srl": "rd, rs1, rs2", "sra": "rd, rs1, rs2",
+	"or": "rd, rs1, rs2", "and": "rd, rs1, rs2",
+
+	// RV32I register-immediate
+	"addi": "rd, rs1, imm", "slti": "rd, rs1, imm", "sltiu": "rd, rs1, imm", "xori": "rd, rs1, imm",
+	"ori": "rd, rs1, imm", "andi": "rd, rs1, imm", "slli": "rd, rs1, shamt", "srli": "rd, rs1, shamt",
+	"srai": "rd, rs1, shamt", "lui": "rd, imm", "auipc": "rd, imm",
+
+	// Loads and stores
+	"lb": "rd, offset(rs1)", "lh": "rd, offset(rs1)", "lw": "rd, offset(rs1)",
+	"lbu": "rd, offset(rs1)", "lhu": "rd, offset(rs1)",
+	"sb": "rs2, offset(rs1)", "sh": "rs2, offset(rs1)", "sw": "rs2, offset(rs1)",
+
+	// Branches and jumps
+	"beq": "rs1, rs2, label", "bne": "rs1, rs2, label", "blt": "rs1, rs2, label",
+	"bge": "rs1, rs2, label", "bltu": "rs1, rs2, label", "bgeu": "rs1, rs2, label",
+	"jal": "rd, label", "jalr": "rd, offset(rs1)",
+
+	// System
+	"ecall": "", "ebreak": "", "fence": "", "fence.i": "",
+	"csrrw": "rd, csr, rs1", "csrrs": "rd, csr, rs1", "csrrc": "rd, csr, rs1",
+	"csrrwi": "rd, csr, uimm", "csrrsi": "rd, csr, uimm", "csrrci": "rd, csr, uimm",
+
+	// RV32M
+	"mul": "rd, rs1, rs2", "mulh": "rd, rs1, rs2", "mulhsu": "rd, rs1, rs2", "mulhu": "rd, rs1, rs2",
+	"div": "rd, rs1, rs2", "divu": "rd, rs1, rs2", "rem": "rd, rs1, rs2", "remu": "rd, rs1, rs2",
+
+	// Pseudo-instructions
+	"nop": "", "li": "rd, imm", "la": "rd, symbol", "mv": "rd, rs", "not": "rd, rs", "neg": "rd, rs",
+	"seqz": "rd, rs", "snez": "rd, rs", "sltz": "rd, rs", "sgtz": "rd, rs",
+	"beqz": "rs, label", "bnez": "rs, label", "blez": "rs, label", "bgez": "rs, label",
+	"bltz": "rs, label", "bgtz": "rs, label",
+	"bgt": "rs, rt, label", "ble": "rs, rt, label", "bgtu": "rs, rt, label", "bleu": "rs, rt, label",
+	"j": "label", "jr": "rs", "ret": "", "call": "symbol", "tail": "symbol",
+}
+
+// directiveSignatures lists the directives the assembler accepts and
+// describes their arguments, as shown by completion
+var directiveSignatures = map[string]string{
+	".text": "", ".data": "", ".bss": "", ".rodata": "", ".section": "name",
+	".globl": "symbol", ".global": "symbol", ".local": "symbol", ".weak": "symbol",
+	".byte": "value, ...", ".half": "value, ...", ".2byte": "value, ...",
+	".word": "value, ...", ".4byte": "value, ...", ".dword": "value, ...", ".8byte": "value, ...",
+	".string": "\"text\"", ".asciz": "\"text\"", ".ascii": "\"text\"",
+	".zero": "size", ".space": "size", ".align": "n", ".balign": "bytes", ".p2align": "n",
+	".equ": "name, value", ".set": "name, value", ".type": "symbol, @function", ".size": "symbol, size",
+	".option": "rvc|norvc|push|pop", ".file": "\"name\"",
+
+	// Macro and repeated blocks
+	".macro": "name, parameters", ".endm": "", ".rept": "count", ".endr": "",
+	".irp": "name, values", ".irpc": "name, characters",
+}
+
+// knownMnemonics lists the mnemonics the assembler accepts, base
+// instructions and pseudo-instructions alike
+func knownMnemonics() []string {
+	seen := make(map[string]bool)
+	for name := range assembler.InstructionToOpType {
+		seen[name] = true
+	}
+	for name := range assembler.PseudoToInstruction {
+		seen[name] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// knownDirectives lists the directives the assembler accepts
+func knownDirectives() []string {
+	names := make([]string, 0, len(directiveSignatures))
+	for name := range directiveSignatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registerNames lists the integer registers by ABI name, then by number
+func registerNames() []string {
+	names := append([]string{}, abiRegisterNames[:]...)
+	names = append(names, "fp")
+	for i := 0; i < 32; i++ {
+		names = append(names, "x"+strconv.Itoa(i))
+	}
+	return names
+}
+
+// operandNames splits a signature into its operands
+func operandNames(signature string) []string {
+	if signature == "" {
+		return nil
+	}
+	operands := strings.Split(signature, ",")
+	for i := range operands {
+		operands[i] = strings.TrimSpace(operands[i])
+	}
+	return operands
+}
+
+// csrNames lists the standard control and status registers by name
+var csrNames = []string{
+	// Unprivileged counters and floating-point status
+	"cycle", "time", "instret", "cycleh", "timeh", "instreth", "fflags", "frm", "fcsr",
+
+	// Supervisor
+	"sstatus", "sie", "stvec", "scounteren", "sscratch", "sepc", "scause", "stval", "sip", "satp",
+
+	// Machine
+	"mvendorid", "marchid", "mimpid", "mhartid", "mstatus", "misa", "medeleg", "mideleg", "mie",
+	"mtvec", "mcounteren", "mstatush", "mscratch", "mepc", "mcause", "mtval", "mip",
+	"mcycle", "minstret", "mcycleh", "minstreth",
+}
+
+// floatRegisterNames lists the floating-point registers by ABI name, then
+// by number
+func floatRegisterNames() []string {
+	var names []string
+	for i := 0; i < 12; i++ {
+		names = append(names, "ft"+strconv.Itoa(i), "fs"+strconv.Itoa(i))
+	}
+	for i := 0; i < 8; i++ {
+		names = append(names, "fa"+strconv.Itoa(i))
+	}
+	for i := 0; i < 32; i++ {
+		names = append(names, "f"+strconv.Itoa(i))
+	}
+	return names
+}
+
+// highlightVocabulary holds the words the highlighter knows, built once at
+// startup from the assembler's tables so it never colours a mnemonic the
+// assembler would reject
+type highlightVocabulary struct {
+	instructions map[string]bool
+	pseudos      map[string]bool
+	directives   map[string]bool
+	registers    map[string]bool // Integer and floating-point registers and CSRs
+}
+
+var vocabulary = newHighlightVocabulary()
+
+func newHighlightVocabulary() highlightVocabulary {
+	v := highlightVocabulary{
+		instructions: make(map[string]bool),
+		pseudos:      make(map[string]bool),
+		directives:   make(map[string]bool),
+		registers:    make(map[string]bool),
+	}
+	for name := range assembler.InstructionToOpType {
+		v.instructions[name] = true
+	}
+	for name := range assembler.PseudoToInstruction {
+		// Mnemonics in both tables are coloured as instructions
+		if !v.instructions[name] {
+			v.pseudos[name] = true
+		}
+	}
+	for name := range directiveSignatures {
+		v.directives[name] = true
+	}
+	for _, names := range [][]string{registerNames(), floatRegisterNames(), csrNames} {
+		for _, name := range names {
+			v.registers[name] = true
+		}
+	}
+	return v
+}
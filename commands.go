@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// command is something the IDE can do from a menu or toolbar. Every command
+// is registered with a default key binding the user can change.
+type command struct {
+	id       string // Stable name, the key of the binding in the preferences
+	category string // Menu or toolbar it belongs to
+	title    string
+	shortcut string // Default binding, in portable key sequence text
+	action   *widgets.QAction
+}
+
+// commands lists the registered commands in menu order
+var (
+	commands     []*command
+	commandsByID = make(map[string]*command)
+)
+
+// registerCommand creates the action of a command. The caller adds it to a
+// menu or toolbar.
+func registerCommand(category, id, text, shortcut string, run func()) *widgets.QAction {
+	action := widgets.NewQAction2(text, mainWindow)
+	action.ConnectTriggered(func(bool) { run() })
+
+	c := &command{
+		id:       id,
+		category: category,
+		title:    strings.TrimSuffix(strings.ReplaceAll(text, "&", ""), "..."),
+		shortcut: shortcut,
+		action:   action,
+	}
+	commands = append(commands, c)
+	commandsByID[id] = c
+	action.SetShortcut(gui.NewQKeySequence2(preferences.Keybindings.binding(c), gui.QKeySequence__PortableText))
+	return action
+}
+
+// addCommand registers a command and adds it to a menu, the menu's title
+// being its category
+func addCommand(menu *widgets.QMenu, id, text, shortcut string, run func()) {
+	category := strings.ReplaceAll(menu.Title(), "&", "")
+	menu.QWidget.AddAction(registerCommand(category, id, text, shortcut, run))
+}
+
+// applyKeybindings binds every command to its key in the preferences
+func applyKeybindings() {
+	for _, c := range commands {
+		c.action.SetShortcut(gui.NewQKeySequence2(preferences.Keybindings.binding(c), gui.QKeySequence__PortableText))
+	}
+}
+
+// claimsShortcut reports whether a key press starts the binding of a
+// command. The editor leaves such keys to the command rather than handling
+// them as standard keys, so Ctrl+Y can paste when it is bound to Paste.
+func claimsShortcut(event *gui.QKeyEvent) bool {
+	chord := gui.NewQKeySequence3(int(event.Modifiers())|event.Key(), 0, 0, 0).ToString(gui.QKeySequence__PortableText)
+	for _, c := range commands {
+		binding := c.action.Shortcut().ToString(gui.QKeySequence__PortableText)
+		if binding != "" && keyChords(binding)[0] == chord {
+			return true
+		}
+	}
+	return false
+}
+
+// keyChords splits a key sequence such as "Ctrl+X, Ctrl+S" into its chords
+func keyChords(sequence string) []string {
+	return strings.Split(sequence, ", ")
+}
+
+// keybindingConflict reports whether two bindings clash: they are the same,
+// or one starts the other so the shorter one could never be pressed
+func keybindingConflict(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	chordsA, chordsB := keyChords(a), keyChords(b)
+	for i := 0; i < len(chordsA) && i < len(chordsB); i++ {
+		if chordsA[i] != chordsB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeKeySequence rewrites a key sequence the way Qt prints it, so
+// "Shift+Alt+F" and "Alt+Shift+F" compare equal
+func normalizeKeySequence(sequence string) string {
+	return gui.NewQKeySequence2(sequence, gui.QKeySequence__PortableText).ToString(gui.QKeySequence__PortableText)
+}
+
+// commandEvent lets commands take the keys they are bound to before the
+// editor handles them as standard keys
+func (e *CodeEditor) commandEvent(event *core.QEvent) bool {
+	if event.Type() == core.QEvent__ShortcutOverride && claimsShortcut(gui.NewQKeyEventFromPointer(event.Pointer())) {
+		return false
+	}
+	return e.EventDefault(event)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// completionKind selects which words the completion popup offers
+type completionKind int
+
+const (
+	completeMnemonics completionKind = 1 << iota
+	completeDirectives
+	completeRegisters
+	completeLabels
+)
+
+// completionItem is one suggestion with the detail shown next to it
+type completionItem struct {
+	text   string
+	detail string
+}
+
+// labelDefinition is a label or constant and where it is defined
+type labelDefinition struct {
+	name     string
+	path     string
+	line     int  // 0-based
+	column   int  // Qt position within the line
+	constant bool // Defined by .equ or .set
+}
+
+// Role holding the text that completion matches and inserts
+const completionTextRole = int(core.Qt__UserRole) + 1
+
+// isSymbolChar reports whether c can be part of a mnemonic, register or label
+func isSymbolChar(c byte) bool {
+	return c == '_' || c == '.' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// completionContext works out what is being typed at the end of line, the
+// text before the cursor, which starts inside a /* */ comment if inBlock
+// is set. ok is false inside comments and strings.
+func completionContext(line string, inBlock bool) (prefix string, kinds completionKind, ok bool) {
+	// Closed block comments are blanked, so a shorter code means the
+	// cursor is in a comment
+	code, _, _ := stripComment(line, inBlock)
+	if len(code) < len(line) || strings.Count(code, "\"")%2 == 1 {
+		return "", 0, false
+	}
+
+	start := len(code)
+	for start > 0 && isSymbolChar(code[start-1]) {
+		start--
+	}
+	prefix = code[start:]
+	before := code[:start]
+
+	// Skip a label in front of the statement
+	if colon := strings.Index(before, ":"); colon > 0 && isSymbolName(strings.TrimSpace(before[:colon])) {
+		before = before[colon+1:]
+	}
+
+	// Start of a statement: mnemonic or directive
+	if strings.TrimSpace(before) == "" {
+		if strings.HasPrefix(prefix, ".") {
+			return prefix, completeDirectives, true
+		}
+		return prefix, completeMnemonics | completeDirectives, true
+	}
+
+	mnemonic := strings.Fields(before)[0]
+	operands := before[strings.Index(before, mnemonic)+len(mnemonic):]
+
+	// Directive arguments may name symbols
+	if strings.HasPrefix(mnemonic, ".") {
+		if strings.Contains(directiveSignatures[mnemonic], "symbol") {
+			return prefix, completeLabels, true
+		}
+		return prefix, 0, true
+	}
+
+	// The base register of offset(rs1)
+	if strings.LastIndex(operands, "(") > strings.LastIndex(operands, ")") {
+		return prefix, completeRegisters, true
+	}
+
+	index := strings.Count(operands, ",")
+	signature, known := instructionSignatures[mnemonic]
+	if !known {
+		return prefix, completeRegisters | completeLabels, true
+	}
+	names := operandNames(signature)
+	if index >= len(names) {
+		return prefix, 0, true
+	}
+
+	kinds = operandKind(names[index])
+	if mnemonic == "jal" && index == 0 {
+		kinds |= completeLabels // jal label is short for jal ra, label
+	}
+	return prefix, kinds, true
+}
+
+// operandKind maps an operand name from a signature to what can be typed there
+func operandKind(operand string) completionKind {
+	switch operand {
+	case "rd", "rs", "rs1", "rs2", "rt":
+		return completeRegisters
+	case "label", "symbol":
+		return completeLabels
+	}
+	return 0
+}
+
+// fileLabels lists the labels and the .equ and .set constants defined in
+// a source text
+func fileLabels(path, text string) []labelDefinition {
+	var labels []labelDefinition
+	inBlock := false
+	for i, line := range strings.Split(text, "\n") {
+		startsInBlock := inBlock
+		var statement asmLine
+		statement, inBlock = parseAsmLine(line, inBlock)
+		name, constant := statement.Label, false
+		if mnemonic := statement.Mnemonic(); name == "" && (mnemonic == ".equ" || mnemonic == ".set") && len(statement.Fields) > 1 {
+			name, constant = strings.TrimSpace(strings.Split(statement.Fields[1], ",")[0]), true
+		}
+		if name == "" || !isSymbolName(name) {
+			continue
+		}
+		if occurrences, _ := lineSymbolOccurrences(line, startsInBlock, name); len(occurrences) > 0 {
+			labels = append(labels, labelDefinition{name: name, path: path, line: i, column: occurrences[0].start, constant: constant})
+		}
+	}
+	return labels
+}
+
+// isAssemblySource reports whether path looks like an assembly file
+func isAssemblySource(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".s", ".asm":
+		return true
+	}
+	return false
+}
+
+// projectLabels lists the labels of the open files and of the assembly
+// sources in the project, open buffers take precedence over the disk
+func projectLabels() []labelDefinition {
+	var labels []labelDefinition
+	for _, source := range projectSources() {
+		labels = append(labels, fileLabels(source.path, source.text)...)
+	}
+	return labels
+}
+
+// completionItems gathers the suggestions of the given kinds
+func completionItems(kinds completionKind) []completionItem {
+	var items []completionItem
+	if kinds&completeMnemonics != 0 {
+		for _, name := range knownMnemonics() {
+			items = append(items, completionItem{text: name, detail: instructionSignatures[name]})
+		}
+	}
+	if kinds&completeDirectives != 0 {
+		for _, name := range knownDirectives() {
+			items = append(items, completionItem{text: name, detail: directiveSignatures[name]})
+		}
+	}
+	if kinds&completeRegisters != 0 {
+		for _, name := range registerNames() {
+			if number, ok := registerNumber(name); ok && number != registerPC && name != fmt.Sprintf("x%d", number) {
+				items = append(items, completionItem{text: name, detail: fmt.Sprintf("x%d", number)})
+			} else {
+				items = append(items, completionItem{text: name})
+			}
+		}
+	}
+	if kinds&completeLabels != 0 {
+		seen := make(map[string]bool)
+		for _, label := range projectLabels() {
+			if seen[label.name] {
+				continue
+			}
+			seen[label.name] = true
+			location := "untitled"
+			if label.path != "" {
+				location = filepath.Base(label.path)
+			}
+			items = append(items, completionItem{text: label.name, detail: fmt.Sprintf("%s:%d", location, label.line+1)})
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return strings.ToLower(items[i].text) < strings.ToLower(items[j].text) })
+	return items
+}
+
+// setupCompletion attaches a completion popup to the editor
+func (e *CodeEditor) setupCompletion() {
+	e.completionModel = gui.NewQStandardItemModel(e)
+	e.completer = widgets.NewQCompleter(e)
+	e.completer.SetModel(e.completionModel)
+	e.completer.SetWidget(e)
+	e.completer.SetCompletionRole(completionTextRole)
+	e.completer.SetCaseSensitivity(core.Qt__CaseInsensitive)
+	e.completer.SetCompletionMode(widgets.QCompleter__PopupCompletion)
+	e.completer.SetMaxVisibleItems(12)
+	e.completer.ConnectActivated(e.insertCompletion)
+}
+
+// insertCompletion replaces the word being typed with the chosen suggestion
+func (e *CodeEditor) insertCompletion(text string) {
+	cursor := e.TextCursor()
+	cursor.MovePosition(gui.QTextCursor__Left, gui.QTextCursor__KeepAnchor, utf16Length(e.completionPrefix))
+	insert := text
+	// Mnemonics and directives that take operands are followed by a space
+	if e.completionKinds&(completeMnemonics|completeDirectives) != 0 {
+		if signature, ok := instructionSignatures[text]; ok && signature != "" {
+			insert += " "
+		} else if signature, ok := directiveSignatures[text]; ok && signature != "" {
+			insert += " "
+		}
+	}
+	cursor.InsertText(insert)
+	e.SetTextCursor(cursor)
+}
+
+// keyPress drives the completion popup and signature help around the
+// default key handling
+func (e *CodeEditor) keyPress(event *gui.QKeyEvent) {
+	popup := e.completer.Popup()
+	if popup.IsVisible() {
+		switch core.Qt__Key(event.Key()) {
+		case core.Qt__Key_Enter, core.Qt__Key_Return, core.Qt__Key_Escape, core.Qt__Key_Tab, core.Qt__Key_Backtab:
+			// Let the completer pick or dismiss the suggestion
+			event.Ignore()
+			return
+		}
+	}
+
+	// Escape closes the signature help before anything else
+	if core.Qt__Key(event.Key()) == core.Qt__Key_Escape && e.signatureLabel.IsVisible() {
+		e.signatureLabel.Hide()
+		return
+	}
+
+	// Ctrl+Space asks for suggestions even before anything is typed
+	modifiers := event.Modifiers()
+	force := modifiers&core.Qt__ControlModifier != 0 && core.Qt__Key(event.Key()) == core.Qt__Key_Space
+	if !force {
+		e.KeyPressEventDefault(event)
+		e.updateSignatureHelp()
+	}
+
+	typed := event.Text()
+	switch {
+	case force:
+		e.updateCompletion(true)
+	case modifiers&(core.Qt__ControlModifier|core.Qt__AltModifier) != 0:
+		popup.Hide()
+	case typed != "" && isSymbolChar(typed[0]):
+		e.updateCompletion(false)
+	case popup.IsVisible():
+		// Backspace or moving the cursor refilters the open popup
+		e.updateCompletion(false)
+	}
+}
+
+// updateCompletion shows, filters or hides the popup for the word at the
+// cursor. force shows it even when nothing has been typed yet.
+func (e *CodeEditor) updateCompletion(force bool) {
+	popup := e.completer.Popup()
+
+	cursor := e.TextCursor()
+	block := cursor.Block().Text()
+	column := cursor.PositionInBlock()
+	before := string([]rune(block)[:min(column, len([]rune(block)))])
+
+	prefix, kinds, ok := completionContext(before, startsInBlockComment(cursor.Block()))
+	if !ok || kinds == 0 || (!force && prefix == "") {
+		popup.Hide()
+		return
+	}
+
+	// Rebuild the list when the kind of word changes or the popup opens
+	if kinds != e.completionKinds || !popup.IsVisible() {
+		e.completionKinds = kinds
+		e.completionModel.Clear()
+		for _, item := range completionItems(kinds) {
+			display := item.text
+			if item.detail != "" {
+				display = fmt.Sprintf("%-10s %s", item.text, item.detail)
+			}
+			row := gui.NewQStandardItem2(display)
+			row.SetData(core.NewQVariant1(item.text), completionTextRole)
+			row.SetToolTip(item.detail)
+			e.completionModel.AppendRow2(row)
+		}
+	}
+
+	e.completionPrefix = prefix
+	e.completer.SetCompletionPrefix(prefix)
+	count := e.completer.CompletionCount()
+	if count == 0 || (count == 1 && !force && e.completer.CurrentCompletion() == prefix) {
+		popup.Hide()
+		return
+	}
+	popup.SetCurrentIndex(e.completer.CompletionModel().Index(0, 0, core.NewQModelIndex()))
+
+	rect := e.CursorRect(cursor)
+	rect.SetWidth(popup.SizeHintForColumn(0) + popup.VerticalScrollBar().SizeHint().Width())
+	e.completer.Complete(rect)
+}
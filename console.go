@@ -0,0 +1,256 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// ConsoleWidget shows program output and takes program input in one place,
+// like a terminal. The line being typed is always at the end of the last
+// block, after any output that did not end with a newline (e.g. a prompt).
+type ConsoleWidget struct {
+	*widgets.QPlainTextEdit
+	outputTail int // Length of program output in the last block
+
+	history      []string
+	historyIndex int
+	historyDraft string
+
+	onInput     func(text string) // Called with each submitted line, including its newline
+	onEOF       func()
+	onInterrupt func()
+}
+
+const maxConsoleHistory = 100
+
+func NewConsoleWidget() *ConsoleWidget {
+	console := &ConsoleWidget{
+		QPlainTextEdit: widgets.NewQPlainTextEdit(nil),
+	}
+	console.SetLineWrapMode(widgets.QPlainTextEdit__WidgetWidth)
+	console.SetUndoRedoEnabled(false)
+
+	console.ConnectKeyPressEvent(console.keyPress)
+	console.ConnectInsertFromMimeData(console.insertFromMimeData)
+	console.ConnectEvent(console.event)
+
+	return console
+}
+
+// qtLength returns the length of s in UTF-16 code units, as used by Qt positions
+func qtLength(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// inputStart is the document position where the editable input begins
+func (c *ConsoleWidget) inputStart() int {
+	return c.Document().LastBlock().Position() + c.outputTail
+}
+
+// pendingInput returns the text typed since the last submitted line
+func (c *ConsoleWidget) pendingInput() string {
+	cursor := gui.NewQTextCursor2(c.Document())
+	cursor.SetPosition(c.inputStart(), gui.QTextCursor__MoveAnchor)
+	cursor.MovePosition(gui.QTextCursor__End, gui.QTextCursor__KeepAnchor, 1)
+	return cursor.SelectedText()
+}
+
+// setPendingInput replaces the line being typed
+func (c *ConsoleWidget) setPendingInput(text string) {
+	cursor := gui.NewQTextCursor2(c.Document())
+	cursor.SetPosition(c.inputStart(), gui.QTextCursor__MoveAnchor)
+	cursor.MovePosition(gui.QTextCursor__End, gui.QTextCursor__KeepAnchor, 1)
+	cursor.InsertText(text)
+	c.SetTextCursor(cursor)
+}
+
+// AppendOutput inserts program output before the line being typed
+func (c *ConsoleWidget) AppendOutput(text string) {
+	if text == "" {
+		return
+	}
+	start := c.inputStart()
+	atEnd := c.TextCursor().Position() >= start
+
+	cursor := gui.NewQTextCursor2(c.Document())
+	cursor.SetPosition(start, gui.QTextCursor__MoveAnchor)
+	cursor.InsertText(text)
+
+	if newline := strings.LastIndex(text, "\n"); newline >= 0 {
+		c.outputTail = qtLength(text[newline+1:])
+	} else {
+		c.outputTail += qtLength(text)
+	}
+
+	if atEnd {
+		c.moveCursorToEnd()
+	}
+	c.EnsureCursorVisible()
+}
+
+// ClearConsole removes all output but keeps the line being typed
+func (c *ConsoleWidget) ClearConsole() {
+	pending := c.pendingInput()
+	c.Clear()
+	c.outputTail = 0
+	c.setPendingInput(pending)
+}
+
+func (c *ConsoleWidget) moveCursorToEnd() {
+	cursor := c.TextCursor()
+	cursor.MovePosition(gui.QTextCursor__End, gui.QTextCursor__MoveAnchor, 1)
+	c.SetTextCursor(cursor)
+}
+
+// submit sends text to the program, optionally ending the input line
+func (c *ConsoleWidget) submit(text string, newline bool) {
+	c.moveCursorToEnd()
+	if newline {
+		c.TextCursor().InsertText("\n")
+		c.outputTail = 0
+		text += "\n"
+	} else {
+		// Flushed text becomes part of the output line
+		c.outputTail += qtLength(text)
+	}
+
+	line := strings.TrimSuffix(text, "\n")
+	if line != "" && (len(c.history) == 0 || c.history[len(c.history)-1] != line) {
+		c.history = append(c.history, line)
+		if len(c.history) > maxConsoleHistory {
+			c.history = c.history[1:]
+		}
+	}
+	c.historyIndex = len(c.history)
+
+	if c.onInput != nil && text != "" {
+		c.onInput(text)
+	}
+}
+
+// recallHistory replaces the pending input with an older or newer entry
+func (c *ConsoleWidget) recallHistory(delta int) {
+	if len(c.history) == 0 {
+		return
+	}
+	if c.historyIndex == len(c.history) {
+		c.historyDraft = c.pendingInput()
+	}
+
+	index := c.historyIndex + delta
+	if index < 0 || index > len(c.history) {
+		return
+	}
+	c.historyIndex = index
+
+	if index == len(c.history) {
+		c.setPendingInput(c.historyDraft)
+	} else {
+		c.setPendingInput(c.history[index])
+	}
+}
+
+// event claims Ctrl+C, Ctrl+D, Ctrl+V and Ctrl+X before they reach the menu shortcuts
+func (c *ConsoleWidget) event(e *core.QEvent) bool {
+	if e.Type() == core.QEvent__ShortcutOverride {
+		keyEvent := gui.NewQKeyEventFromPointer(e.Pointer())
+		if keyEvent.Modifiers()&core.Qt__ControlModifier != 0 {
+			switch core.Qt__Key(keyEvent.Key()) {
+			case core.Qt__Key_C, core.Qt__Key_D, core.Qt__Key_V, core.Qt__Key_X:
+				e.Accept()
+				return true
+			}
+		}
+	}
+	return c.EventDefault(e)
+}
+
+func (c *ConsoleWidget) keyPress(event *gui.QKeyEvent) {
+	key := core.Qt__Key(event.Key())
+	control := event.Modifiers()&core.Qt__ControlModifier != 0
+	shift := event.Modifiers()&core.Qt__ShiftModifier != 0
+	cursor := c.TextCursor()
+	inInput := cursor.SelectionStart() >= c.inputStart()
+
+	switch {
+	case control && key == core.Qt__Key_C:
+		// Copy a selection like any editor, interrupt the program otherwise
+		if cursor.HasSelection() {
+			c.Copy()
+		} else if c.onInterrupt != nil {
+			c.AppendOutput("^C\n")
+			c.onInterrupt()
+		}
+		return
+
+	case control && key == core.Qt__Key_D:
+		// Flush pending input, or signal end of file on an empty line
+		if pending := c.pendingInput(); pending != "" {
+			c.submit(pending, false)
+		} else if c.onEOF != nil {
+			c.onEOF()
+		}
+		return
+
+	case key == core.Qt__Key_Return || key == core.Qt__Key_Enter:
+		c.submit(c.pendingInput(), true)
+		return
+
+	case key == core.Qt__Key_Up:
+		c.recallHistory(-1)
+		return
+
+	case key == core.Qt__Key_Down:
+		c.recallHistory(1)
+		return
+
+	case key == core.Qt__Key_Home:
+		mode := gui.QTextCursor__MoveAnchor
+		if shift {
+			mode = gui.QTextCursor__KeepAnchor
+		}
+		cursor.SetPosition(c.inputStart(), mode)
+		c.SetTextCursor(cursor)
+		return
+
+	case key == core.Qt__Key_Left && inInput && !shift && cursor.Position() <= c.inputStart():
+		// Never step back into the program output
+		return
+	}
+
+	// Navigation and copying work everywhere, editing only in the input line
+	edits := event.Text() != "" || key == core.Qt__Key_Backspace || key == core.Qt__Key_Delete ||
+		(control && (key == core.Qt__Key_X || key == core.Qt__Key_V))
+	if edits && !inInput {
+		c.moveCursorToEnd()
+	}
+	if key == core.Qt__Key_Backspace && !c.TextCursor().HasSelection() && c.TextCursor().Position() <= c.inputStart() {
+		return
+	}
+
+	c.KeyPressEventDefault(event)
+}
+
+// insertFromMimeData pastes into the input line, submitting every complete line
+func (c *ConsoleWidget) insertFromMimeData(source *core.QMimeData) {
+	if !source.HasText() {
+		return
+	}
+	if c.TextCursor().SelectionStart() < c.inputStart() {
+		c.moveCursorToEnd()
+	}
+
+	text := strings.ReplaceAll(source.Text(), "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		c.TextCursor().InsertText(line)
+		if i < len(lines)-1 {
+			c.submit(c.pendingInput(), true)
+		}
+	}
+	c.EnsureCursorVisible()
+}
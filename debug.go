@@ -7,7 +7,6 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
-	"time"
 
 	rcore "github.com/RISC-GoV/core"
 	assembler "github.com/RISC-GoV/risc-assembler"
@@ -35,39 +34,48 @@ func stepDebugCode() {
 			return
 		}
 		defer lockExecution.Unlock()
+
+		// I/O ecalls are served by the session instead of the simulator
+		handled, err := debugInfo.session.handleEcall()
+		if err != nil {
+			debugLog.Log(fmt.Sprintf("Error executing instruction: %v", err))
+			return
+		}
+		if handled {
+			updateRegistersDisplay()
+			highlightExecutionLine()
+			return
+		}
+
 		// Execute the current instruction
 		state, err := debugInfo.cpu.ExecuteSingle()
 		if err != nil {
-			terminalOutput.Append(fmt.Sprintf("Error executing instruction: %v\n", err))
+			debugLog.Log(fmt.Sprintf("Error executing instruction: %v", err))
 			return
 		}
 		if debugInfo.cpu == nil {
-			terminalOutput.Append("CPU is nil, stopping debugging.\n")
+			debugLog.Log("CPU is nil, stopping debugging.")
 			stopDebugging()
 			return
 		}
 		updateRegistersDisplay()
 
-		lineNum := 1 // Default to line 1
 		if debugInfo.cpu.PC != 0 {
-			// Calculate line number based on PC value
-			lineNum = int(debugInfo.cpu.PC / 4)
-
 			// Highlight the next execution line
-			editor.HighlightLine(lineNum)
+			highlightExecutionLine()
 
 			switch state {
 			case rcore.PROGRAM_EXIT:
-				terminalOutput.Append("Program exited normally\n")
+				debugLog.Log("Program exited normally")
 				stopDebugging()
 			case rcore.PROGRAM_EXIT_FAILURE:
-				terminalOutput.Append("Program exited with failure\n")
+				debugLog.Log("Program exited with failure")
 				stopDebugging()
 			case rcore.E_BREAK:
-				terminalOutput.Append(fmt.Sprintf("Breakpoint hit at 0x%0x/%d\n", debugInfo.cpu.PC, debugInfo.cpu.PC))
+				debugLog.Log(fmt.Sprintf("Breakpoint hit at 0x%0x/%d", debugInfo.cpu.PC, debugInfo.cpu.PC))
 			default:
-				terminalOutput.Append(fmt.Sprintf("PC (4byte/instructions) = %d", debugInfo.cpu.PC))
-				debugInfo.cpu.PrintInstruction(debugInfo.cpu.PC)
+				debugLog.Log(fmt.Sprintf("PC (4byte/instructions) = %d", debugInfo.cpu.PC))
+				traceInstruction(debugInfo.cpu)
 			}
 
 		}
@@ -87,42 +95,156 @@ func continueDebugCode() {
 			return
 		}
 		defer lockExecution.Unlock()
+		session := debugInfo.session
+		elf := loadedELF // stopDebugging clears loadedELF, so read it once
+		session.resetInterrupt()
 		for debugInfo.isDebugging {
+			// Ctrl+C in the console pauses the program like a breakpoint
+			if session.isInterrupted() {
+				debugLog.Log(fmt.Sprintf("Interrupted at 0x%0x", debugInfo.cpu.PC))
+				updateRegistersDisplay()
+				highlightExecutionLine()
+				return
+			}
+
+			// I/O ecalls are served by the session instead of the simulator
+			handled, err := session.handleEcall()
+			if err != nil && !session.isInterrupted() {
+				debugLog.Log(fmt.Sprintf("Error executing instruction: %v", err))
+				return
+			}
+			if handled || err != nil {
+				continue
+			}
+
 			state, err := debugInfo.cpu.ExecuteSingle()
 			if err != nil {
-				terminalOutput.Append(fmt.Sprintf("Error executing instruction: %v\n", err))
+				debugLog.Log(fmt.Sprintf("Error executing instruction: %v", err))
+				return
+			}
+
+			// ELF programs have no injected ebreaks, so check their line table instead
+			if elf != nil && state != rcore.PROGRAM_EXIT && state != rcore.PROGRAM_EXIT_FAILURE &&
+				elf.hasBreakpoint(uint32(debugInfo.cpu.PC)) {
+				debugLog.Log(fmt.Sprintf("Breakpoint hit at %s", elf.symbolize(uint32(debugInfo.cpu.PC))))
+				updateRegistersDisplay()
+				highlightExecutionLine()
+				return
+			}
+
+			// Breakpoints set after the program was assembled have no ebreak either
+			if elf == nil && state != rcore.PROGRAM_EXIT && state != rcore.PROGRAM_EXIT_FAILURE && state != rcore.E_BREAK &&
+				hasLiveBreakpoint(uint32(debugInfo.cpu.PC)) {
+				debugLog.Log(fmt.Sprintf("Breakpoint hit at 0x%0x", debugInfo.cpu.PC))
+				updateRegistersDisplay()
+				highlightExecutionLine()
 				return
 			}
 
 			switch state {
 			case rcore.PROGRAM_EXIT:
-				terminalOutput.Append("Program exited normally\n")
+				debugLog.Log("Program exited normally")
 				stopDebugging()
 				return
 			case rcore.PROGRAM_EXIT_FAILURE:
-				terminalOutput.Append("Program exited with failure\n")
+				debugLog.Log("Program exited with failure")
 				stopDebugging()
 				return
 			case rcore.E_BREAK:
-				terminalOutput.Append(fmt.Sprintf("Breakpoint hit at 0x%0x\n", debugInfo.cpu.PC))
-
-				// Calculate the line to highlight in the editor - show the next line to execute
-				lineNum := 1 // Default to line 1
-				if debugInfo.cpu.PC != 0 {
-					// Calculate line number based on PC value - point to next instruction
-					lineNum = int(debugInfo.cpu.PC / 4)
-				}
+				debugLog.Log(fmt.Sprintf("Breakpoint hit at 0x%0x", debugInfo.cpu.PC))
 
 				// Update registers and highlight the current line
 				updateRegistersDisplay()
-				editor.HighlightLine(lineNum)
+				highlightExecutionLine()
+				return
+			}
+		}
+		updateRegistersDisplay()
+	}()
+}
+
+// stepInstructions executes up to count instructions, stopping early at a
+// breakpoint or when the program exits
+func stepInstructions(count int) {
+	if !debugInfo.isDebugging || debugInfo.cpu == nil {
+		return
+	}
+
+	go func() {
+		//check if the mutex is already locked
+		if !lockExecution.TryLock() {
+			// If the mutex is already locked, return without executing
+			return
+		}
+		defer lockExecution.Unlock()
+
+		session := debugInfo.session
+		elf := loadedELF // stopDebugging clears loadedELF, so read it once
+		executed := 0
+	steps:
+		for executed < count {
+			executed++
+
+			// I/O ecalls are served by the session instead of the simulator
+			handled, err := session.handleEcall()
+			if err != nil {
+				debugLog.Log(fmt.Sprintf("Error executing instruction: %v", err))
+				break
+			}
+			if handled {
+				continue
+			}
+
+			state, err := debugInfo.cpu.ExecuteSingle()
+			if err != nil {
+				debugLog.Log(fmt.Sprintf("Error executing instruction: %v", err))
+				break
+			}
+
+			switch state {
+			case rcore.PROGRAM_EXIT:
+				debugLog.Log("Program exited normally")
+				stopDebugging()
 				return
+			case rcore.PROGRAM_EXIT_FAILURE:
+				debugLog.Log("Program exited with failure")
+				stopDebugging()
+				return
+			case rcore.E_BREAK:
+				debugLog.Log(fmt.Sprintf("Breakpoint hit at 0x%0x", debugInfo.cpu.PC))
+				break steps
+			}
+
+			if elf != nil && executed < count && elf.hasBreakpoint(uint32(debugInfo.cpu.PC)) {
+				debugLog.Log(fmt.Sprintf("Breakpoint hit at %s", elf.symbolize(uint32(debugInfo.cpu.PC))))
+				break
+			}
+			if elf == nil && executed < count && hasLiveBreakpoint(uint32(debugInfo.cpu.PC)) {
+				debugLog.Log(fmt.Sprintf("Breakpoint hit at 0x%0x", debugInfo.cpu.PC))
+				break
 			}
 		}
+
+		debugLog.Log(fmt.Sprintf("Stepped %d instruction(s), PC = 0x%08x%s", executed, debugInfo.cpu.PC, describeSymbol(uint32(debugInfo.cpu.PC))))
 		updateRegistersDisplay()
+		highlightExecutionLine()
 	}()
 }
 
+// highlightExecutionLine shows the line of the next instruction to execute
+func highlightExecutionLine() {
+	if elf := loadedELF; elf != nil {
+		elf.highlight(uint32(debugInfo.cpu.PC))
+		return
+	}
+
+	// The listing maps addresses to editor lines wherever the program is
+	// loaded and however many instructions a line assembles to
+	if line, ok := debugInfo.addressLines[uint32(debugInfo.cpu.PC)]; ok {
+		postHighlight(sourceLocation{File: debugEditor().filePath, Line: line + 1})
+	}
+}
+
 func AssembleCode() {
 	if currentFilePath == "" {
 		widgets.QMessageBox_Information(mainWindow, "No File", "No file is currently open to assemble", widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
@@ -132,18 +254,19 @@ func AssembleCode() {
 	saveCurrentFile()
 
 	// Assemble code
-	terminalOutput.SetPlainText("Assembling code...\n")
+	buildLog.Clear()
+	buildLog.Log("Assembling code...")
 
 	asm := assembler.Assembler{}
 	dir := filepath.Dir(currentFilePath)
 	err := asm.Assemble(currentFilePath, dir)
 	if err != nil {
-		errMsg := fmt.Sprintf("Assembly failed: %v\n", err)
-		terminalOutput.SetPlainText(errMsg)
+		buildLog.Log(fmt.Sprintf("Assembly failed: %v", err))
+		buildLog.reveal()
 		return
 	}
 
-	setTerminal("Assembly successful.")
+	buildLog.Log("Assembly successful.")
 }
 
 func debugCode() {
@@ -157,94 +280,80 @@ func debugCode() {
 		stopDebugging()
 	}
 
+	// The active editor becomes the one being debugged
+	target := editor
 	saveCurrentFile()
 
-	// Create hidden directory for assembled output
-	outputDir := filepath.Join(filepath.Dir(currentFilePath), ".riscgov_ide/assembling")
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		log.Printf("Error creating output directory: %v", err)
-		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Failed to create output directory: %v", err), widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
-		return
-	}
-
-	// Process breakpoints - add ebreak instructions
-	lines := strings.Split(editor.ToPlainText(), "\n")
-	tempFile := filepath.Join(outputDir, "temp_"+filepath.Base(currentFilePath))
-
-	var modifiedContent strings.Builder
-
-	for lineIndex, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-
-		// Skip empty lines and comments for breakpoint purposes
-		if trimmedLine != "" && !strings.HasPrefix(trimmedLine, "#") && !strings.HasPrefix(trimmedLine, "//") {
-			parts := strings.Fields(trimmedLine)
-			if len(parts) > 0 {
-				_, isInstruction := assembler.InstructionToOpType[parts[0]]
-				_, isInstruction2 := assembler.PseudoToInstruction[parts[0]]
-
-				// If this is an instruction and we have a breakpoint on this line
-				if (isInstruction || isInstruction2) && debugInfo.breakpoints[lineIndex] {
-					modifiedContent.WriteString("ebreak\n")
-				}
-			}
-		}
-
-		modifiedContent.WriteString(line + "\n")
-	}
-	terminalOutput.Clear()
-
-	debugFileContent := modifiedContent.String()
-
-	debugFileSplit = strings.Split(debugFileContent, "\n")
-	realFileSplit = strings.Split(editor.ToPlainText(), "\n")
-	if err := os.WriteFile(tempFile, []byte(modifiedContent.String()), 0644); err != nil {
-		terminalOutput.SetPlainText("Failed to create temporary file with breakpoints.")
+	buildLog.Clear()
+	debugLog.Clear()
+	source, err := writeDebugSource(target)
+	if err != nil {
+		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Failed to prepare the code for debugging: %v", err), widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
 		return
 	}
 
 	// Assemble code
-	terminalOutput.SetPlainText("Assembling code with breakpoints...\n")
+	buildLog.Log("Assembling code with breakpoints...")
 
 	asm := assembler.Assembler{}
-	err := asm.Assemble(tempFile, outputDir)
+	err = asm.Assemble(source.path, source.dir)
 	if err != nil {
-		errMsg := fmt.Sprintf("Assembly failed: %v\n", err)
-		terminalOutput.SetPlainText(errMsg)
+		buildLog.Log(fmt.Sprintf("Assembly failed: %v", err))
+		buildLog.reveal()
 		return
 	}
 
-	setTerminal("Assembly successful.\nStarting debugger...\n")
+	buildLog.Log("Assembly successful.")
+	debugLog.Log("Starting debugger...")
+	debugLog.reveal()
 
 	// Start debug session with fresh state
 	debugInfo.isDebugging = true
+	debugInfo.editor = target
 	debugInfo.cpu = rcore.NewCPU(rcore.NewMemory())
 	rcore.Kernel.Init()
 	// Show debug UI
 	showDebugWindows()
 
-	outputFile := filepath.Join(outputDir, "output.exe")
+	outputFile := filepath.Join(source.dir, "output.exe")
 	// Load program in CPU
 	err = debugInfo.cpu.LoadFile(outputFile)
 	if err != nil {
-		setTerminal(fmt.Sprintf("Debug failed: %v\n", err))
+		debugLog.Log(fmt.Sprintf("Debug failed: %v", err))
 		stopDebugging()
 		return
 	}
 
-	// Update registers display
-	updateRegistersDisplay()
+	// Labels for the debug console, addresses include the injected ebreaks
+	if image, err := buildProgramImage(source.path, outputFile); err == nil {
+		debugInfo.symbols = image.Symbols
+		debugInfo.imageEnd = image.End()
+		debugInfo.addressLines = source.addressLines(image.Listing)
+	}
 
-	lineNum := 1 // Default to line 1
-	if debugInfo.cpu.PC != 0 {
-		// Calculate line number based on PC value - point to next instruction
-		lineNum = int(debugInfo.cpu.PC/4) + 1
+	// Pass arguments and redirect I/O as configured
+	if projectSettingsPath == "" {
+		LoadProjectSettings(projectRoot())
+	}
+	debugInfo.session = newProgramSession(debugInfo.cpu)
+	debugInfo.session.activate()
+	if err := applyRunConfiguration(debugInfo.session, target.filePath); err != nil {
+		debugLog.Log(fmt.Sprintf("Debug failed: %v", err))
+		stopDebugging()
+		return
 	}
-	editor.HighlightLine(lineNum)
-	setTerminal("Debug session started. Use Step or Continue.\n")
+
+	// Update registers display
+	updateRegistersDisplay()
+	highlightExecutionLine()
+	debugLog.Log("Debug session started. Use Step or Continue.")
 }
 
 func hotReloadCode() {
+	if loadedELF != nil {
+		widgets.QMessageBox_Information(mainWindow, "Hot Reload", "Hot reload is not available while debugging an ELF file", widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
 
 	//check if the mutex is already locked
 	if !lockExecution.TryLock() {
@@ -252,19 +361,80 @@ func hotReloadCode() {
 		return
 	}
 	defer lockExecution.Unlock()
+	target := debugEditor()
+	editorTabs.SetCurrentWidget(target)
 	saveCurrentFile()
 
+	buildLog.Clear()
+	source, err := writeDebugSource(target)
+	if err != nil {
+		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Hot reload failed, error preparing the code:\n %v", err), widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	asm := assembler.Assembler{}
+	err = asm.Assemble(source.path, source.dir)
+	if err != nil {
+		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Hot reload failed, error Assembling:\n %v", err), widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	// Show debug UI
+	showDebugWindows()
+
+	outputFile := filepath.Join(source.dir, "output.exe")
+	debugInfo.cpu.Memory = rcore.NewMemory()
+	oldPC := debugInfo.cpu.PC
+	// Load program in CPU
+	err = debugInfo.cpu.LoadFile(outputFile)
+	if err != nil {
+		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Hot reload failed, error LoadingFile:\n %v", err), widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	debugInfo.cpu.PC = oldPC
+	if image, err := buildProgramImage(source.path, outputFile); err == nil {
+		debugInfo.symbols = image.Symbols
+		debugInfo.imageEnd = image.End()
+		debugInfo.addressLines = source.addressLines(image.Listing)
+	}
+}
+
+// debugSource is the code being debugged as written for the assembler
+type debugSource struct {
+	path  string // The file written, with the injected ebreaks
+	dir   string // Where the program is assembled
+	lines []int  // 0-based editor line of each line of path, -1 for an injected ebreak
+}
+
+// addressLines maps the address of each instruction of the assembled
+// source to its 0-based editor line, leaving out the injected ebreaks
+func (source *debugSource) addressLines(listing []listingEntry) map[uint32]int {
+	lines := make(map[uint32]int)
+	for _, entry := range listing {
+		if !entry.Code || entry.Line < 1 || entry.Line > len(source.lines) {
+			continue
+		}
+		if line := source.lines[entry.Line-1]; line >= 0 {
+			lines[entry.Address] = line
+		}
+	}
+	return lines
+}
+
+// writeDebugSource writes the code of the editor being debugged to the
+// assembling directory next to it, with an ebreak before every line that
+// has a breakpoint
+func writeDebugSource(target *CodeEditor) (*debugSource, error) {
 	// Create hidden directory for assembled output
-	outputDir := filepath.Join(filepath.Dir(currentFilePath), ".riscgov_ide/assembling")
+	outputDir := filepath.Join(filepath.Dir(target.filePath), ".riscgov_ide/assembling")
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		log.Printf("Error creating output directory: %v", err)
-		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Failed to create output directory: %v", err), widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
-		return
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
 	}
+	source := &debugSource{dir: outputDir}
 
 	// Process breakpoints - add ebreak instructions
-	lines := strings.Split(editor.ToPlainText(), "\n")
-	tempFile := filepath.Join(outputDir, "temp_"+filepath.Base(currentFilePath))
+	lines := strings.Split(target.ToPlainText(), "\n")
+	source.path = filepath.Join(outputDir, "temp_"+filepath.Base(target.filePath))
 
 	var modifiedContent strings.Builder
 
@@ -279,45 +449,29 @@ func hotReloadCode() {
 				_, isInstruction2 := assembler.PseudoToInstruction[parts[0]]
 
 				// If this is an instruction and we have a breakpoint on this line
-				if (isInstruction || isInstruction2) && debugInfo.breakpoints[lineIndex] {
+				if (isInstruction || isInstruction2) && target.breakpoints[lineIndex] {
 					modifiedContent.WriteString("ebreak\n")
+					source.lines = append(source.lines, -1)
 				}
 			}
 		}
 
 		modifiedContent.WriteString(line + "\n")
+		source.lines = append(source.lines, lineIndex)
 	}
-	terminalOutput.Clear()
-
-	debugFileContent := modifiedContent.String()
 
-	debugFileSplit = strings.Split(debugFileContent, "\n")
-	realFileSplit = strings.Split(editor.ToPlainText(), "\n")
-	if err := os.WriteFile(tempFile, []byte(modifiedContent.String()), 0644); err != nil {
-		terminalOutput.SetPlainText("Failed to create temporary file with breakpoints.")
-		return
-	}
-
-	asm := assembler.Assembler{}
-	err := asm.Assemble(tempFile, outputDir)
-	if err != nil {
-		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Hot reload failed, error Assembling:\n %v", err), widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
-		return
+	if err := os.WriteFile(source.path, []byte(modifiedContent.String()), 0644); err != nil {
+		return nil, fmt.Errorf("failed to create temporary file with breakpoints: %v", err)
 	}
+	return source, nil
+}
 
-	// Show debug UI
-	showDebugWindows()
-
-	outputFile := filepath.Join(outputDir, "output.exe")
-	debugInfo.cpu.Memory = rcore.NewMemory()
-	oldPC := debugInfo.cpu.PC
-	// Load program in CPU
-	err = debugInfo.cpu.LoadFile(outputFile)
-	if err != nil {
-		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Hot reload failed, error LoadingFile:\n %v", err), widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
-		return
-	}
-	debugInfo.cpu.PC = oldPC
+// hasLiveBreakpoint reports whether a breakpoint without an injected ebreak,
+// such as one set while the program runs, is on the instruction at address
+func hasLiveBreakpoint(address uint32) bool {
+	line, ok := debugInfo.addressLines[address]
+	e := debugInfo.editor
+	return ok && e != nil && e.breakpoints[line]
 }
 
 func stopDebugging() {
@@ -326,17 +480,24 @@ func stopDebugging() {
 	}
 	debugInfo.isDebugging = false
 	debugInfo.cpu = nil
+	loadedELF = nil
+	debugInfo.symbols = nil
+	debugInfo.imageEnd = 0
+	debugInfo.addressLines = nil
+	debugInfo.editor = nil
+	if debugInfo.session != nil {
+		debugInfo.session.close()
+		debugInfo.session = nil
+	}
 
 	// Restore normal UI
 	hideDebugWindows()
-	debugFileSplit = nil
-	realFileSplit = nil
 
 	if editor != nil && editor.lineNumberArea != nil {
 		editor.lineNumberArea.Update()
 	}
 
-	terminalOutput.Append("Debug session stopped.\n")
+	debugLog.Log("Debug session stopped.")
 }
 
 func showDebugWindows() {
@@ -418,15 +579,15 @@ func showDebugWindows() {
 		debugPanel.AddWidget(memoryPanel)
 		debugPanel.SetSizes([]int{400, 400})
 
-		// Replace editor with a splitter containing editor and debug panel
-		editorParent := editor.ParentWidget()
+		// Replace editor tabs with a splitter containing the tabs and debug panel
+		editorParent := editorTabs.ParentWidget()
 		editorLayout := editorParent.Layout()
-		// Remove editor from its parent
-		editorLayout.RemoveWidget(editor)
+		// Remove editor tabs from their parent
+		editorLayout.RemoveWidget(editorTabs)
 
 		// Create new container for editor and debug view
 		debugContainer = widgets.NewQSplitter2(core.Qt__Horizontal, nil)
-		debugContainer.AddWidget(editor)
+		debugContainer.AddWidget(editorTabs)
 		debugContainer.AddWidget(debugPanel)
 		debugContainer.SetSizes([]int{700, 500})
 
@@ -450,8 +611,8 @@ func hideDebugWindows() {
 
 	// Clear highlight
 	currentHighline = -1
-	if editor != nil && editor.lineNumberArea != nil {
-		editor.lineNumberArea.Update()
+	for _, e := range openEditors {
+		e.lineNumberArea.Update()
 	}
 }
 
@@ -462,72 +623,23 @@ func (e *CodeEditor) lineNumberAreaMousePress(event *gui.QMouseEvent) {
 	// Calculate the actual source code line number (1-based)
 	lineNumber := blockNumber - 1
 
+	// Clicks on the fold markers fold or unfold instead
+	if event.X() >= e.lineNumberArea.Width()-e.foldMarkerWidth() {
+		e.toggleFold(lineNumber)
+		return
+	}
+
 	// Toggle breakpoint
-	if debugInfo.breakpoints[lineNumber] {
-		delete(debugInfo.breakpoints, lineNumber)
+	if e.breakpoints[lineNumber] {
+		delete(e.breakpoints, lineNumber)
 	} else {
-		debugInfo.breakpoints[lineNumber] = true
+		e.breakpoints[lineNumber] = true
 	}
 
 	// Update the line number area
 	e.lineNumberArea.Update()
 }
 
-func getRelevantLine(lineNum int, lines []string) (int, int) {
-	instructionCount := 0
-	nBreaks := 0
-	for i, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-		if trimmedLine == "" || strings.HasPrefix(trimmedLine, "#") || strings.HasPrefix(trimmedLine, "//") {
-			continue // Skip empty lines and comments
-		}
-
-		// Check if this line contains an instruction
-		parts := strings.Fields(trimmedLine)
-		if len(parts) > 0 {
-			_, isInstruction := assembler.InstructionToOpType[parts[0]]
-			retFunc, isInstruction2 := assembler.PseudoToInstruction[parts[0]]
-			if isInstruction || isInstruction2 {
-
-				instructionCount++
-
-				if instructionCount == lineNum {
-					return i, nBreaks
-				}
-				if isInstruction2 {
-					result := retFunc(parts)
-					instructionCount += len(result) - 1
-				}
-				if parts[0] == "ebreak" {
-					nBreaks++
-				}
-			}
-		}
-	}
-	return -1, nBreaks
-}
-
-func (e *CodeEditor) HighlightLine(lineNum int) {
-	// Calculate the actual line number in the source code
-	currentHighline = -1
-	realFileVal, realBreaks := getRelevantLine(lineNum, realFileSplit)
-	_, debugBreaks := getRelevantLine(lineNum, debugFileSplit)
-	currentHighline = realFileVal + (realBreaks - debugBreaks)
-	if currentHighline < 1 {
-		return // Line doesn't exist or isn't an instruction
-	}
-
-	// Scroll to make sure the line is visible
-	block := e.Document().FindBlockByLineNumber(currentHighline)
-	cursor := e.TextCursor()
-	cursor.SetPosition(block.Position(), gui.QTextCursor__MoveAnchor)
-	e.SetTextCursor(cursor)
-	e.CenterCursor()
-
-	// Redraw line number area to show highlight
-	e.lineNumberArea.Update()
-}
-
 func runCode() {
 	if currentFilePath == "" {
 		widgets.QMessageBox_Information(mainWindow, "No File", "No file is currently open to run", widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
@@ -545,30 +657,83 @@ func runCode() {
 	}
 
 	// Assemble code
-	terminalOutput.SetPlainText("Assembling code...\n")
+	buildLog.Clear()
+	buildLog.Log("Assembling code...")
 
 	asm := assembler.Assembler{}
 
 	err := asm.Assemble(currentFilePath, outputDir)
 	if err != nil {
-		errMsg := fmt.Sprintf("Assembly failed: %v\n", err)
-		terminalOutput.SetPlainText(errMsg)
+		buildLog.Log(fmt.Sprintf("Assembly failed: %v", err))
+		buildLog.reveal()
 		return
 	}
 
-	setTerminal("Assembly successful.\nRunning code...\n")
+	if projectSettingsPath == "" {
+		LoadProjectSettings(projectRoot())
+	}
+
+	buildLog.Log("Assembly successful.")
+	programOutput.Log(fmt.Sprintf("Running %s...", filepath.Base(currentFilePath)))
+	programOutput.reveal()
+	programPath := currentFilePath
 	go func() {
-		// Execute code
+		// Load code
 		outputFile := filepath.Join(outputDir, "output.exe")
 		cpu := rcore.NewCPU(rcore.NewMemory())
 		rcore.Kernel.Init()
-		err = cpu.ExecuteFile(outputFile)
+		err = cpu.LoadFile(outputFile)
 		if err != nil {
-			setTerminal(fmt.Sprintf("Execution failed: %v\n", err))
+			programOutput.Log(fmt.Sprintf("\nExecution failed: %v", err))
+			return
+		}
+
+		// Pass arguments and redirect I/O as configured
+		session := newProgramSession(cpu)
+		if err := applyRunConfiguration(session, programPath); err != nil {
+			programOutput.Log(fmt.Sprintf("\nExecution failed: %v", err))
 			return
 		}
-		//wait 100ms
-		time.Sleep(100 * time.Millisecond)
-		setTerminal("\nProgram execution finished.\n")
+
+		// Execute code with its own console I/O
+		session.activate()
+		err = executeProgram(session)
+		session.close()
+		if err != nil {
+			programOutput.Log(fmt.Sprintf("\nExecution failed: %v", err))
+			return
+		}
+		programOutput.Log("\nProgram execution finished.")
 	}()
 }
+
+// executeProgram runs a loaded program until it exits
+func executeProgram(session *programSession) error {
+	cpu := session.cpu
+	for {
+		if session.isInterrupted() {
+			return fmt.Errorf("interrupted at 0x%0x", cpu.PC)
+		}
+
+		// I/O ecalls are served by the session instead of the simulator
+		handled, err := session.handleEcall()
+		if err != nil && !session.isInterrupted() {
+			return err
+		}
+		if handled || err != nil {
+			continue
+		}
+
+		state, err := cpu.ExecuteSingle()
+		if err != nil {
+			return err
+		}
+
+		switch state {
+		case rcore.PROGRAM_EXIT:
+			return nil
+		case rcore.PROGRAM_EXIT_FAILURE:
+			return fmt.Errorf("program exited with failure")
+		}
+	}
+}
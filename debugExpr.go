@@ -0,0 +1,590 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	rcore "github.com/RISC-GoV/core"
+)
+
+// ABI names of the integer registers, indexed by register number
+var abiRegisterNames = [32]string{
+	"zero", "ra", "sp", "gp", "tp", "t0", "t1", "t2",
+	"s0", "s1", "a0", "a1", "a2", "a3", "a4", "a5",
+	"a6", "a7", "s2", "s3", "s4", "s5", "s6", "s7",
+	"s8", "s9", "s10", "s11", "t3", "t4", "t5", "t6",
+}
+
+// registerPC stands for the program counter wherever a register number is expected
+const registerPC = 32
+
+// registerNumber resolves x0-x31, ABI names, fp and pc, with an optional '$'
+func registerNumber(name string) (int, bool) {
+	name = strings.TrimPrefix(name, "$")
+	switch name {
+	case "pc":
+		return registerPC, true
+	case "fp":
+		return 8, true
+	}
+	if strings.HasPrefix(name, "x") {
+		if n, err := strconv.Atoi(name[1:]); err == nil && n >= 0 && n < 32 && name[1:] == strconv.Itoa(n) {
+			return n, true
+		}
+	}
+	for i, abiName := range abiRegisterNames {
+		if abiName == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// exprType is the C type of a value in a debugger expression. Everything is
+// 32-bit like the target, so only sizes of 1, 2 and 4 bytes exist.
+type exprType struct {
+	name    string
+	size    int
+	signed  bool
+	pointee *exprType // Set for pointer types
+}
+
+var (
+	typeInt    = &exprType{name: "int", size: 4, signed: true}
+	typeUint   = &exprType{name: "unsigned int", size: 4}
+	typeShort  = &exprType{name: "short", size: 2, signed: true}
+	typeUshort = &exprType{name: "unsigned short", size: 2}
+	typeChar   = &exprType{name: "char", size: 1, signed: true}
+	typeUchar  = &exprType{name: "unsigned char", size: 1}
+
+	// The type of pc, arithmetic on it is in bytes
+	typeCode = &exprType{name: "void (*)()", size: 4, pointee: typeUchar}
+)
+
+// exprTypeNames maps the type names accepted in casts to their types
+var exprTypeNames = map[string]*exprType{
+	"int":            typeInt,
+	"signed":         typeInt,
+	"signed int":     typeInt,
+	"long":           typeInt,
+	"unsigned":       typeUint,
+	"unsigned int":   typeUint,
+	"unsigned long":  typeUint,
+	"short":          typeShort,
+	"unsigned short": typeUshort,
+	"char":           typeChar,
+	"signed char":    typeChar,
+	"unsigned char":  typeUchar,
+	"int8_t":         typeChar,
+	"uint8_t":        typeUchar,
+	"int16_t":        typeShort,
+	"uint16_t":       typeUshort,
+	"int32_t":        typeInt,
+	"uint32_t":       typeUint,
+	"void":           typeUchar, // void* steps by one byte like in GNU C
+}
+
+func pointerTo(t *exprType) *exprType {
+	return &exprType{name: t.name + " *", size: 4, pointee: t}
+}
+
+// exprValue is the result of evaluating an expression. Values that name a
+// register or a memory location can be assigned to.
+type exprValue struct {
+	value uint32
+	typ   *exprType
+
+	register int // Register number if the value is a register, -1 otherwise
+	inMemory bool
+	address  uint32
+}
+
+func rvalue(value uint32, typ *exprType) exprValue {
+	return exprValue{value: value, typ: typ, register: -1}
+}
+
+// signedValue interprets the value according to its type
+func (v exprValue) signedValue() int64 {
+	if v.typ.signed {
+		return int64(int32(v.value))
+	}
+	return int64(v.value)
+}
+
+// format renders the value the way the debug console prints results
+func (v exprValue) format() string {
+	switch {
+	case v.typ.pointee != nil:
+		return fmt.Sprintf("(%s) 0x%08x%s", v.typ.name, v.value, describeSymbol(v.value))
+	case v.typ.size == 1:
+		return fmt.Sprintf("%d %s", v.signedValue(), quoteChar(byte(v.value)))
+	case v.typ.signed:
+		return fmt.Sprintf("%d (0x%x)", int32(v.value), v.value)
+	default:
+		return fmt.Sprintf("%d (0x%x)", v.value, v.value)
+	}
+}
+
+func quoteChar(c byte) string {
+	if c >= 32 && c <= 126 {
+		return strconv.QuoteRune(rune(c))
+	}
+	return fmt.Sprintf("'\\x%02x'", c)
+}
+
+// describeSymbol returns " <label+offset>" for addresses inside the loaded program
+func describeSymbol(address uint32) string {
+	if address >= debugInfo.imageEnd {
+		return ""
+	}
+	var best *programSymbol
+	for i := range debugInfo.symbols {
+		symbol := &debugInfo.symbols[i]
+		if symbol.Address <= address && (best == nil || symbol.Address >= best.Address) {
+			best = symbol
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	if best.Address == address {
+		return fmt.Sprintf(" <%s>", best.Name)
+	}
+	return fmt.Sprintf(" <%s+%d>", best.Name, address-best.Address)
+}
+
+// lookupSymbol returns the address of a label of the program being debugged
+func lookupSymbol(name string) (uint32, bool) {
+	for _, symbol := range debugInfo.symbols {
+		if symbol.Name == name {
+			return symbol.Address, true
+		}
+	}
+	return 0, false
+}
+
+// readMemoryValue reads a little-endian value of size bytes
+func readMemoryValue(cpu *rcore.CPU, address uint32, size int) (uint32, error) {
+	var buf [4]byte
+	for i := 0; i < size; i++ {
+		value, err := cpu.Memory.ReadByte(address + uint32(i))
+		if err != nil {
+			return 0, fmt.Errorf("cannot access memory at 0x%08x: %v", address+uint32(i), err)
+		}
+		buf[i] = value
+	}
+	return binary.LittleEndian.Uint32(buf[:]), nil
+}
+
+// writeMemoryValue writes the low size bytes of value, little-endian
+func writeMemoryValue(cpu *rcore.CPU, address uint32, size int, value uint32) error {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], value)
+	return writeMemory(cpu, address, buf[:size])
+}
+
+// truncate narrows value to the size of typ, sign-extending signed types
+func truncate(value uint32, typ *exprType) uint32 {
+	switch {
+	case typ.size == 1 && typ.signed:
+		return uint32(int32(int8(value)))
+	case typ.size == 1:
+		return value & 0xff
+	case typ.size == 2 && typ.signed:
+		return uint32(int32(int16(value)))
+	case typ.size == 2:
+		return value & 0xffff
+	}
+	return value
+}
+
+// tokenizeExpr splits an expression into identifiers, numbers, character
+// literals and operators
+func tokenizeExpr(text string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '_' || c == '$' || c == '.' || isAlnum(c):
+			start := i
+			for i < len(text) && (text[i] == '_' || text[i] == '$' || text[i] == '.' || isAlnum(text[i])) {
+				i++
+			}
+			tokens = append(tokens, text[start:i])
+		case c == '\'':
+			end := strings.IndexByte(text[i+1:], '\'')
+			if end == 1 && text[i+1] == '\\' {
+				// An escaped quote, the literal ends at the next one
+				if next := strings.IndexByte(text[i+3:], '\''); next >= 0 {
+					end = next + 2
+				} else {
+					end = -1
+				}
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character literal")
+			}
+			tokens = append(tokens, text[i:i+end+2])
+			i += end + 2
+		default:
+			op := string(c)
+			if i+1 < len(text) {
+				switch two := text[i : i+2]; two {
+				case "<<", ">>", "<=", ">=", "==", "!=", "&&", "||":
+					op = two
+				}
+			}
+			if !strings.Contains("+-*/%&|^~!<>=()", string(c)) {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			tokens = append(tokens, op)
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+func isAlnum(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// exprParser evaluates C-like expressions against the live CPU state
+type exprParser struct {
+	cpu    *rcore.CPU
+	tokens []string
+	pos    int
+}
+
+// evaluateExpression evaluates text against the CPU of the debug session
+func evaluateExpression(cpu *rcore.CPU, text string) (exprValue, error) {
+	tokens, err := tokenizeExpr(text)
+	if err != nil {
+		return exprValue{}, err
+	}
+	if len(tokens) == 0 {
+		return exprValue{}, fmt.Errorf("expression expected")
+	}
+
+	p := &exprParser{cpu: cpu, tokens: tokens}
+	value, err := p.parseBinary(0)
+	if err != nil {
+		return exprValue{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return exprValue{}, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return value, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// Binary operators from lowest to highest precedence
+var exprPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseBinary(level int) (exprValue, error) {
+	if level == len(exprPrecedence) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return left, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, candidate := range exprPrecedence[level] {
+			if op == candidate {
+				found = true
+			}
+		}
+		if !found {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return right, err
+		}
+		if left, err = applyBinary(op, left, right); err != nil {
+			return left, err
+		}
+	}
+}
+
+// applyBinary follows C's usual arithmetic conversions for 32-bit values,
+// including scaling by the element size in pointer arithmetic
+func applyBinary(op string, left, right exprValue) (exprValue, error) {
+	boolean := func(b bool) exprValue {
+		if b {
+			return rvalue(1, typeInt)
+		}
+		return rvalue(0, typeInt)
+	}
+
+	// Pointer arithmetic
+	if left.typ.pointee != nil || right.typ.pointee != nil {
+		switch {
+		case op == "+" && left.typ.pointee != nil && right.typ.pointee == nil:
+			return rvalue(left.value+right.value*uint32(left.typ.pointee.size), left.typ), nil
+		case op == "+" && right.typ.pointee != nil && left.typ.pointee == nil:
+			return rvalue(right.value+left.value*uint32(right.typ.pointee.size), right.typ), nil
+		case op == "-" && left.typ.pointee != nil && right.typ.pointee == nil:
+			return rvalue(left.value-right.value*uint32(left.typ.pointee.size), left.typ), nil
+		case op == "-" && left.typ.pointee != nil && right.typ.pointee != nil:
+			return rvalue(uint32(int32(left.value-right.value)/int32(left.typ.pointee.size)), typeInt), nil
+		}
+	}
+
+	resultType := typeInt
+	if !left.typ.signed || !right.typ.signed {
+		resultType = typeUint
+	}
+	unsigned := resultType == typeUint
+	a, b := left.value, right.value
+	sa, sb := int32(a), int32(b)
+
+	switch op {
+	case "+":
+		return rvalue(a+b, resultType), nil
+	case "-":
+		return rvalue(a-b, resultType), nil
+	case "*":
+		return rvalue(a*b, resultType), nil
+	case "/", "%":
+		if b == 0 {
+			return exprValue{}, fmt.Errorf("division by zero")
+		}
+		switch {
+		case unsigned && op == "/":
+			return rvalue(a/b, resultType), nil
+		case unsigned:
+			return rvalue(a%b, resultType), nil
+		case op == "/":
+			return rvalue(uint32(sa/sb), resultType), nil
+		default:
+			return rvalue(uint32(sa%sb), resultType), nil
+		}
+	case "&":
+		return rvalue(a&b, resultType), nil
+	case "|":
+		return rvalue(a|b, resultType), nil
+	case "^":
+		return rvalue(a^b, resultType), nil
+	case "<<":
+		return rvalue(a<<(b&31), left.typ), nil
+	case ">>":
+		if left.typ.signed {
+			return rvalue(uint32(sa>>(b&31)), left.typ), nil
+		}
+		return rvalue(a>>(b&31), left.typ), nil
+	case "==":
+		return boolean(a == b), nil
+	case "!=":
+		return boolean(a != b), nil
+	case "<", "<=", ">", ">=":
+		var less, equal bool
+		if unsigned {
+			less, equal = a < b, a == b
+		} else {
+			less, equal = sa < sb, sa == sb
+		}
+		switch op {
+		case "<":
+			return boolean(less), nil
+		case "<=":
+			return boolean(less || equal), nil
+		case ">":
+			return boolean(!less && !equal), nil
+		default:
+			return boolean(!less), nil
+		}
+	case "&&":
+		return boolean(a != 0 && b != 0), nil
+	case "||":
+		return boolean(a != 0 || b != 0), nil
+	}
+	return exprValue{}, fmt.Errorf("unknown operator %q", op)
+}
+
+// parseCastType reads "(type)" or "(type *)" at the current position
+func (p *exprParser) parseCastType() (*exprType, bool) {
+	if p.peek() != "(" {
+		return nil, false
+	}
+
+	end := p.pos + 1
+	var words []string // Multi-word names like "unsigned char" are matched word by word
+	for end < len(p.tokens) && exprTypeNames[strings.Join(append(words, p.tokens[end]), " ")] != nil {
+		words = append(words, p.tokens[end])
+		end++
+	}
+	if len(words) == 0 {
+		return nil, false
+	}
+
+	typ := exprTypeNames[strings.Join(words, " ")]
+	for end < len(p.tokens) && p.tokens[end] == "*" {
+		typ = pointerTo(typ)
+		end++
+	}
+	if end >= len(p.tokens) || p.tokens[end] != ")" {
+		return nil, false
+	}
+
+	p.pos = end + 1
+	return typ, true
+}
+
+func (p *exprParser) parseUnary() (exprValue, error) {
+	if typ, ok := p.parseCastType(); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return operand, err
+		}
+		return rvalue(truncate(operand.value, typ), typ), nil
+	}
+
+	switch op := p.peek(); op {
+	case "-", "+", "~", "!", "*", "&":
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return operand, err
+		}
+
+		switch op {
+		case "-":
+			return rvalue(-operand.value, operand.typ), nil
+		case "+":
+			return rvalue(operand.value, operand.typ), nil
+		case "~":
+			return rvalue(^operand.value, operand.typ), nil
+		case "!":
+			if operand.value == 0 {
+				return rvalue(1, typeInt), nil
+			}
+			return rvalue(0, typeInt), nil
+		case "*":
+			return p.dereference(operand)
+		default:
+			if !operand.inMemory {
+				return exprValue{}, fmt.Errorf("cannot take the address of a value that is not in memory")
+			}
+			return rvalue(operand.address, pointerTo(operand.typ)), nil
+		}
+	}
+
+	return p.parsePrimary()
+}
+
+// dereference reads the value a pointer points to; plain integers are
+// treated as addresses of an int
+func (p *exprParser) dereference(pointer exprValue) (exprValue, error) {
+	typ := pointer.typ.pointee
+	if typ == nil {
+		typ = typeInt
+	}
+
+	raw, err := readMemoryValue(p.cpu, pointer.value, typ.size)
+	if err != nil {
+		return exprValue{}, err
+	}
+	return exprValue{
+		value:    truncate(raw, typ),
+		typ:      typ,
+		register: -1,
+		inMemory: true,
+		address:  pointer.value,
+	}, nil
+}
+
+func (p *exprParser) parsePrimary() (exprValue, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return exprValue{}, fmt.Errorf("unexpected end of expression")
+
+	case token == "(":
+		value, err := p.parseBinary(0)
+		if err != nil {
+			return value, err
+		}
+		if p.next() != ")" {
+			return exprValue{}, fmt.Errorf("missing ')'")
+		}
+		return value, nil
+
+	case token[0] == '\'':
+		value, _, _, err := strconv.UnquoteChar(token[1:len(token)-1], '\'')
+		if err != nil {
+			return exprValue{}, fmt.Errorf("invalid character literal %s", token)
+		}
+		return rvalue(uint32(value), typeChar), nil
+
+	case token[0] >= '0' && token[0] <= '9':
+		value, err := strconv.ParseUint(strings.TrimRight(token, "uUlL"), 0, 32)
+		if err != nil {
+			return exprValue{}, fmt.Errorf("invalid number %q", token)
+		}
+		if strings.ContainsAny(token, "uU") || value > 0x7fffffff {
+			return rvalue(uint32(value), typeUint), nil
+		}
+		return rvalue(uint32(value), typeInt), nil
+	}
+
+	if register, ok := registerNumber(token); ok {
+		if register == registerPC {
+			return exprValue{value: uint32(p.cpu.PC), typ: typeCode, register: registerPC}, nil
+		}
+		return exprValue{value: uint32(p.cpu.Registers[register]), typ: typeInt, register: register}, nil
+	}
+	if address, ok := lookupSymbol(token); ok {
+		return rvalue(address, typeUint), nil
+	}
+	return exprValue{}, fmt.Errorf("no register or symbol named %q", token)
+}
+
+// assignValue stores value into a register or memory location
+func assignValue(cpu *rcore.CPU, target, value exprValue) error {
+	switch {
+	case target.register == registerPC:
+		cpu.PC = value.value
+	case target.register == 0:
+		return fmt.Errorf("zero is hardwired to 0")
+	case target.register > 0:
+		cpu.Registers[target.register] = value.value
+	case target.inMemory:
+		return writeMemoryValue(cpu, target.address, target.typ.size, value.value)
+	default:
+		return fmt.Errorf("left side of the assignment is not a register or memory location")
+	}
+	return nil
+}
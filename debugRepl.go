@@ -0,0 +1,665 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	rcore "github.com/RISC-GoV/core"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// debugCommand is a command of the debug console
+type debugCommand struct {
+	name    string
+	aliases []string
+	usage   string
+	help    string
+	run     func(args string)
+}
+
+var debugCommands []debugCommand
+
+func init() {
+	debugCommands = []debugCommand{
+		{"print", []string{"p"}, "print[/FMT] EXPR", "Evaluate an expression such as *(int*)(sp+8) or a0 + a1; typing just the expression does the same", replPrint},
+		{"x", nil, "x/NFU ADDR", "Examine N units of memory; F is x, d, u, o, t or c and U is b, h or w", replExamine},
+		{"set", nil, "set TARGET = EXPR", "Assign to a register, pc or memory, e.g. set t0 = 5 or set *(char*)(a1+2) = 'A'", replSet},
+		{"break", []string{"b"}, "break [LABEL|LINE]", "Set a breakpoint in the debugged file, or list breakpoints", replBreak},
+		{"delete", []string{"d"}, "delete [LABEL|LINE]", "Remove a breakpoint, or all of them", replDelete},
+		{"step", []string{"s", "si", "stepi"}, "step [N]", "Execute N instructions (default 1)", replStep},
+		{"continue", []string{"c"}, "continue", "Run until the next breakpoint", func(string) { continueDebugCode() }},
+		{"info", []string{"i"}, "info registers|breakpoints|symbols", "Show the registers, breakpoints or labels", replInfo},
+		{"help", []string{"?"}, "help", "Show this list", replHelp},
+	}
+}
+
+// findDebugCommand looks a command up by name or alias
+func findDebugCommand(name string) *debugCommand {
+	for i := range debugCommands {
+		command := &debugCommands[i]
+		if command.name == name {
+			return command
+		}
+		for _, alias := range command.aliases {
+			if alias == name {
+				return command
+			}
+		}
+	}
+	return nil
+}
+
+// runDebugCommand executes one line typed into the debug console
+func runDebugCommand(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	debugLog.Log("(dbg) " + line)
+
+	// The command name ends at a space or at the '/' of a format
+	name := line
+	args := ""
+	if end := strings.IndexAny(line, " \t/"); end >= 0 {
+		name = line[:end]
+		args = strings.TrimSpace(line[end:])
+	}
+
+	if command := findDebugCommand(name); command != nil {
+		command.run(args)
+		return
+	}
+	replPrint(line)
+}
+
+// lockPausedCPU returns the CPU of the debug session and holds the execution
+// lock, so the program cannot run while the console inspects it. The caller
+// must unlock lockExecution when done.
+func lockPausedCPU() (*rcore.CPU, bool) {
+	if !debugInfo.isDebugging || debugInfo.cpu == nil {
+		debugLog.Log("No debug session. Start one with Run → Debug (F7).")
+		return nil, false
+	}
+	if !lockExecution.TryLock() {
+		debugLog.Log("The program is running. Interrupt it with Ctrl+C in the Output tab first.")
+		return nil, false
+	}
+	return debugInfo.cpu, true
+}
+
+// replPrint evaluates an expression, with an optional /FMT like gdb's print
+func replPrint(args string) {
+	format := byte(0)
+	if strings.HasPrefix(args, "/") {
+		if len(args) < 2 {
+			debugLog.Log("Missing format after '/'")
+			return
+		}
+		format = args[1]
+		args = strings.TrimSpace(args[2:])
+	}
+
+	cpu, ok := lockPausedCPU()
+	if !ok {
+		return
+	}
+	defer lockExecution.Unlock()
+
+	value, err := evaluateExpression(cpu, args)
+	if err != nil {
+		debugLog.Log(fmt.Sprintf("Error: %v", err))
+		return
+	}
+
+	if format == 0 {
+		debugLog.Log(fmt.Sprintf("%s = %s", args, value.format()))
+		return
+	}
+	text, err := formatUnit(value.value, value.typ.size, format)
+	if err != nil {
+		debugLog.Log(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	debugLog.Log(fmt.Sprintf("%s = %s", args, text))
+}
+
+// formatUnit renders a value of size bytes in one of the x and print formats
+func formatUnit(value uint32, size int, format byte) (string, error) {
+	switch format {
+	case 'x':
+		return fmt.Sprintf("0x%0*x", size*2, value), nil
+	case 'd':
+		return strconv.FormatInt(int64(int32(truncate(value, &exprType{size: size, signed: true}))), 10), nil
+	case 'u':
+		return strconv.FormatUint(uint64(value), 10), nil
+	case 'o':
+		return fmt.Sprintf("0%o", value), nil
+	case 't':
+		return fmt.Sprintf("%0*b", size*8, value), nil
+	case 'c':
+		return fmt.Sprintf("%d %s", int8(value), quoteChar(byte(value))), nil
+	}
+	return "", fmt.Errorf("unknown format '%c'", format)
+}
+
+// replExamine dumps memory like gdb's x/NFU
+func replExamine(args string) {
+	count, format, size := 1, byte('x'), 4
+	unitGiven := false
+	if strings.HasPrefix(args, "/") {
+		spec := args[1:]
+		if end := strings.IndexAny(spec, " \t"); end >= 0 {
+			args = strings.TrimSpace(spec[end:])
+			spec = spec[:end]
+		} else {
+			args = ""
+		}
+
+		digits := 0
+		for digits < len(spec) && spec[digits] >= '0' && spec[digits] <= '9' {
+			digits++
+		}
+		if digits > 0 {
+			count, _ = strconv.Atoi(spec[:digits])
+		}
+		for _, letter := range spec[digits:] {
+			switch letter {
+			case 'b':
+				size, unitGiven = 1, true
+			case 'h':
+				size, unitGiven = 2, true
+			case 'w':
+				size, unitGiven = 4, true
+			case 'x', 'd', 'u', 'o', 't', 'c':
+				format = byte(letter)
+			default:
+				debugLog.Log(fmt.Sprintf("Unknown format letter '%c' in x/%s", letter, spec))
+				return
+			}
+		}
+	}
+	if format == 'c' && !unitGiven {
+		size = 1 // Characters are bytes unless asked otherwise
+	}
+	if args == "" {
+		debugLog.Log("Usage: x/NFU ADDR")
+		return
+	}
+	if count < 1 || count > 4096 {
+		debugLog.Log("The count must be between 1 and 4096")
+		return
+	}
+
+	cpu, ok := lockPausedCPU()
+	if !ok {
+		return
+	}
+	defer lockExecution.Unlock()
+
+	start, err := evaluateExpression(cpu, args)
+	if err != nil {
+		debugLog.Log(fmt.Sprintf("Error: %v", err))
+		return
+	}
+
+	perRow := 16 / size
+	if format == 'c' {
+		perRow = 8
+	}
+
+	var out strings.Builder
+	address := start.value
+	for i := 0; i < count; i++ {
+		if i%perRow == 0 {
+			if i > 0 {
+				out.WriteString("\n")
+			}
+			fmt.Fprintf(&out, "0x%08x%s:", address, describeSymbol(address))
+		}
+
+		value, err := readMemoryValue(cpu, address, size)
+		if err != nil {
+			out.WriteString("\n" + err.Error())
+			break
+		}
+		text, _ := formatUnit(value, size, format)
+		out.WriteString("\t" + text)
+		address += uint32(size)
+	}
+	debugLog.Log(out.String())
+}
+
+// splitAssignment splits "target = value" at the assignment operator
+func splitAssignment(text string) (string, string, bool) {
+	for i := 0; i < len(text); i++ {
+		if text[i] != '=' {
+			continue
+		}
+		if i > 0 && strings.ContainsRune("=!<>", rune(text[i-1])) {
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == '=' {
+			i++
+			continue
+		}
+		return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+	}
+	return "", "", false
+}
+
+// replSet assigns to a register, the PC or memory
+func replSet(args string) {
+	args = strings.TrimPrefix(args, "var ")
+	targetText, valueText, ok := splitAssignment(args)
+	if !ok || targetText == "" || valueText == "" {
+		debugLog.Log("Usage: set TARGET = EXPR")
+		return
+	}
+
+	cpu, ok := lockPausedCPU()
+	if !ok {
+		return
+	}
+	defer lockExecution.Unlock()
+
+	target, err := evaluateExpression(cpu, targetText)
+	if err != nil {
+		debugLog.Log(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	value, err := evaluateExpression(cpu, valueText)
+	if err != nil {
+		debugLog.Log(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if err := assignValue(cpu, target, value); err != nil {
+		debugLog.Log(fmt.Sprintf("Error: %v", err))
+		return
+	}
+
+	// Show the stored value, which may have been truncated
+	if updated, err := evaluateExpression(cpu, targetText); err == nil {
+		debugLog.Log(fmt.Sprintf("%s = %s", targetText, updated.format()))
+	}
+	updateRegistersDisplay()
+	if target.register == registerPC {
+		highlightExecutionLine()
+	}
+}
+
+// isBreakpointLine reports whether a breakpoint on line can take effect,
+// using the same test as the ebreak injection in debugCode
+func isBreakpointLine(line string) bool {
+	parts := strings.Fields(strings.TrimSpace(line))
+	return len(parts) > 0 && isInstruction(parts[0])
+}
+
+// breakpointEditor is the editor whose breakpoints the console changes:
+// the one being debugged, or the open one before a session starts
+func breakpointEditor() (*CodeEditor, []string, error) {
+	e := debugEditor()
+	if e == nil || e.filePath == "" {
+		return nil, nil, fmt.Errorf("no file is open")
+	}
+	return e, strings.Split(e.ToPlainText(), "\n"), nil
+}
+
+// resolveBreakpointLine turns a label or 1-based line number of the
+// debugged file into the 0-based line index that breakpoints are keyed by
+func resolveBreakpointLine(location string) (*CodeEditor, int, error) {
+	e, lines, err := breakpointEditor()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if number, err := strconv.Atoi(location); err == nil {
+		if number < 1 || number > len(lines) {
+			return nil, 0, fmt.Errorf("line %d is outside the file (1-%d)", number, len(lines))
+		}
+		return e, number - 1, nil
+	}
+
+	for i, statement := range parseAsmLines(lines) {
+		if statement.Label != location {
+			continue
+		}
+		// Break on the first instruction at or after the label
+		for j := i; j < len(lines); j++ {
+			if isBreakpointLine(lines[j]) {
+				return e, j, nil
+			}
+		}
+		return nil, 0, fmt.Errorf("no instruction follows label %q", location)
+	}
+	return nil, 0, fmt.Errorf("no label %q in %s", location, e.filePath)
+}
+
+// sortedBreakpoints returns the breakpoint line indexes of an editor in order
+func sortedBreakpoints(e *CodeEditor) []int {
+	var lines []int
+	for line, set := range e.breakpoints {
+		if set {
+			lines = append(lines, line)
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+func replBreak(args string) {
+	if args == "" {
+		replInfo("breakpoints")
+		return
+	}
+
+	e, line, err := resolveBreakpointLine(args)
+	if err != nil {
+		debugLog.Log(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	e.breakpoints[line] = true
+	e.lineNumberArea.Update()
+
+	// The running program stops at it from now on, unless the line was
+	// not assembled into it
+	message := fmt.Sprintf("Breakpoint at line %d", line+1)
+	if debugInfo.isDebugging && loadedELF == nil && !lineIsLoaded(line) {
+		message += " (the line is not in the running program, use HotReload to apply it)"
+	}
+	debugLog.Log(message)
+}
+
+// lineIsLoaded reports whether an editor line has an instruction in the
+// program being debugged
+func lineIsLoaded(line int) bool {
+	for _, loaded := range debugInfo.addressLines {
+		if loaded == line {
+			return true
+		}
+	}
+	return false
+}
+
+func replDelete(args string) {
+	if args == "" {
+		e, _, err := breakpointEditor()
+		if err != nil {
+			debugLog.Log(fmt.Sprintf("Error: %v", err))
+			return
+		}
+		clear(e.breakpoints)
+		e.lineNumberArea.Update()
+		debugLog.Log("Deleted all breakpoints")
+		return
+	}
+
+	e, line, err := resolveBreakpointLine(args)
+	if err != nil {
+		debugLog.Log(fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if !e.breakpoints[line] {
+		debugLog.Log(fmt.Sprintf("No breakpoint at line %d", line+1))
+		return
+	}
+	delete(e.breakpoints, line)
+	e.lineNumberArea.Update()
+	debugLog.Log(fmt.Sprintf("Deleted breakpoint at line %d", line+1))
+}
+
+func replStep(args string) {
+	count := 1
+	if args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 {
+			debugLog.Log("Usage: step [N], with N a positive number")
+			return
+		}
+		count = n
+	}
+	if !debugInfo.isDebugging || debugInfo.cpu == nil {
+		debugLog.Log("No debug session. Start one with Run → Debug (F7).")
+		return
+	}
+	stepInstructions(count)
+}
+
+func replInfo(args string) {
+	switch strings.TrimSpace(args) {
+	case "registers", "reg", "r":
+		cpu, ok := lockPausedCPU()
+		if !ok {
+			return
+		}
+		defer lockExecution.Unlock()
+
+		var out strings.Builder
+		fmt.Fprintf(&out, "pc  0x%08x%s", cpu.PC, describeSymbol(uint32(cpu.PC)))
+		for i, name := range abiRegisterNames {
+			if i%4 == 0 {
+				out.WriteString("\n")
+			}
+			fmt.Fprintf(&out, "%-4s 0x%08x  ", name, cpu.Registers[i])
+		}
+		debugLog.Log(out.String())
+
+	case "breakpoints", "break", "b":
+		e, source, err := breakpointEditor()
+		if err != nil {
+			debugLog.Log(fmt.Sprintf("Error: %v", err))
+			return
+		}
+		lines := sortedBreakpoints(e)
+		if len(lines) == 0 {
+			debugLog.Log("No breakpoints")
+			return
+		}
+		var out strings.Builder
+		for _, line := range lines {
+			text := ""
+			if line < len(source) {
+				text = strings.TrimSpace(source[line])
+			}
+			fmt.Fprintf(&out, "line %d: %s\n", line+1, text)
+		}
+		debugLog.Log(out.String())
+
+	case "symbols", "sym", "s":
+		if len(debugInfo.symbols) == 0 {
+			debugLog.Log("No symbols")
+			return
+		}
+		var out strings.Builder
+		for _, symbol := range debugInfo.symbols {
+			fmt.Fprintf(&out, "0x%08x  %s\n", symbol.Address, symbol.Name)
+		}
+		debugLog.Log(out.String())
+
+	default:
+		debugLog.Log("Usage: info registers|breakpoints|symbols")
+	}
+}
+
+func replHelp(string) {
+	var out strings.Builder
+	for _, command := range debugCommands {
+		fmt.Fprintf(&out, "%-36s %s\n", command.usage, command.help)
+	}
+	out.WriteString("Expressions use C syntax with registers (a0, x10, $sp, pc), labels, casts like (char*) and * to read memory.")
+	debugLog.Log(out.String())
+}
+
+// debugCompletions returns the words that can be typed at a position, given
+// the text before the word being completed
+func debugCompletions(before string) []string {
+	fields := strings.Fields(before)
+	if len(fields) == 0 {
+		var names []string
+		for _, command := range debugCommands {
+			names = append(names, command.name)
+		}
+		return names
+	}
+	if command := findDebugCommand(fields[0]); command != nil && command.name == "info" && len(fields) == 1 {
+		return []string{"registers", "breakpoints", "symbols"}
+	}
+
+	words := []string{"pc"}
+	for i, name := range abiRegisterNames {
+		words = append(words, name, fmt.Sprintf("x%d", i))
+	}
+	for _, symbol := range debugInfo.symbols {
+		words = append(words, symbol.Name)
+	}
+	if fields[0] == "break" || fields[0] == "b" || fields[0] == "delete" || fields[0] == "d" {
+		_, lines, _ := breakpointEditor()
+		for _, statement := range parseAsmLines(lines) {
+			if label := statement.Label; label != "" {
+				words = append(words, label)
+			}
+		}
+	}
+	for name := range exprTypeNames {
+		if !strings.Contains(name, " ") {
+			words = append(words, name)
+		}
+	}
+	return words
+}
+
+// debugReplInput is the command line of the Debug Console tab
+type debugReplInput struct {
+	*widgets.QLineEdit
+	history      []string
+	historyIndex int
+	historyDraft string
+}
+
+func newDebugReplInput() *widgets.QWidget {
+	input := &debugReplInput{QLineEdit: widgets.NewQLineEdit(nil)}
+	input.SetPlaceholderText("Expression or command, e.g. *(int*)(sp+8), x/8wx 0x1000, set t0 = 5, break loop, step 10 (help lists all)")
+	input.ConnectReturnPressed(input.submit)
+	input.ConnectKeyPressEvent(input.keyPress)
+	input.ConnectEvent(input.event)
+
+	row := widgets.NewQWidget(nil, 0)
+	rowLayout := widgets.NewQHBoxLayout()
+	rowLayout.SetContentsMargins(0, 0, 0, 0)
+	rowLayout.AddWidget(widgets.NewQLabel2("(dbg)", nil, 0), 0, 0)
+	rowLayout.AddWidget(input, 1, 0)
+	row.SetLayout(rowLayout)
+	return row
+}
+
+func (r *debugReplInput) submit() {
+	line := strings.TrimSpace(r.Text())
+	r.Clear()
+	if line == "" {
+		return
+	}
+
+	if len(r.history) == 0 || r.history[len(r.history)-1] != line {
+		r.history = append(r.history, line)
+		if len(r.history) > maxConsoleHistory {
+			r.history = r.history[1:]
+		}
+	}
+	r.historyIndex = len(r.history)
+
+	runDebugCommand(line)
+}
+
+// recallHistory replaces the input with an older or newer entry
+func (r *debugReplInput) recallHistory(delta int) {
+	if len(r.history) == 0 {
+		return
+	}
+	if r.historyIndex == len(r.history) {
+		r.historyDraft = r.Text()
+	}
+
+	index := r.historyIndex + delta
+	if index < 0 || index > len(r.history) {
+		return
+	}
+	r.historyIndex = index
+
+	if index == len(r.history) {
+		r.SetText(r.historyDraft)
+	} else {
+		r.SetText(r.history[index])
+	}
+}
+
+// complete extends the word before the cursor, listing the candidates
+// when there is more than one
+func (r *debugReplInput) complete() {
+	text := r.Text()
+	position := r.CursorPosition()
+	if position > len(text) {
+		position = len(text)
+	}
+
+	start := position
+	for start > 0 && (isAlnum(text[start-1]) || strings.IndexByte("_.$", text[start-1]) >= 0) {
+		start--
+	}
+	prefix := strings.TrimPrefix(text[start:position], "$")
+
+	var matches []string
+	seen := make(map[string]bool)
+	for _, word := range debugCompletions(text[:start]) {
+		if strings.HasPrefix(word, prefix) && !seen[word] {
+			seen[word] = true
+			matches = append(matches, word)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	sort.Strings(matches)
+
+	// Extend to the longest common prefix
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 {
+		common += " "
+	}
+	if len(common) > len(prefix) {
+		r.SetText(text[:position] + common[len(prefix):] + text[position:])
+		r.SetCursorPosition(position + len(common) - len(prefix))
+		return
+	}
+	debugLog.Log(strings.Join(matches, "  "))
+}
+
+// event takes Tab for completion before it moves the focus
+func (r *debugReplInput) event(e *core.QEvent) bool {
+	if e.Type() == core.QEvent__KeyPress {
+		keyEvent := gui.NewQKeyEventFromPointer(e.Pointer())
+		if core.Qt__Key(keyEvent.Key()) == core.Qt__Key_Tab && keyEvent.Modifiers() == core.Qt__NoModifier {
+			r.complete()
+			return true
+		}
+	}
+	return r.EventDefault(e)
+}
+
+func (r *debugReplInput) keyPress(event *gui.QKeyEvent) {
+	switch core.Qt__Key(event.Key()) {
+	case core.Qt__Key_Up:
+		r.recallHistory(-1)
+	case core.Qt__Key_Down:
+		r.recallHistory(1)
+	default:
+		r.KeyPressEventDefault(event)
+	}
+}
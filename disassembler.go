@@ -0,0 +1,97 @@
+package main
+
+import "fmt"
+
+// Mnemonics by funct3 for the opcodes that only need funct3
+var (
+	loadMnemonics   = [8]string{"lb", "lh", "lw", "", "lbu", "lhu", "", ""}
+	storeMnemonics  = [8]string{"sb", "sh", "sw", "", "", "", "", ""}
+	branchMnemonics = [8]string{"beq", "bne", "", "", "blt", "bge", "bltu", "bgeu"}
+	immMnemonics    = [8]string{"addi", "slli", "slti", "sltiu", "xori", "srli", "ori", "andi"}
+	regMnemonics    = [8]string{"add", "sll", "slt", "sltu", "xor", "srl", "or", "and"}
+	mulMnemonics    = [8]string{"mul", "mulh", "mulhsu", "mulhu", "div", "divu", "rem", "remu"}
+	csrMnemonics    = [8]string{"", "csrrw", "csrrs", "csrrc", "", "csrrwi", "csrrsi", "csrrci"}
+)
+
+// disassemble decodes an RV32IM instruction word at pc into assembly, with
+// registers by ABI name and branch and jump targets as addresses. Words it
+// cannot decode are shown as .word.
+func disassemble(word, pc uint32) string {
+	rd := abiRegisterNames[word>>7&0x1f]
+	rs1 := abiRegisterNames[word>>15&0x1f]
+	rs2 := abiRegisterNames[word>>20&0x1f]
+	funct3 := word >> 12 & 0x7
+	funct7 := word >> 25
+
+	// Immediates of each format, sign-extended
+	immI := int32(word) >> 20
+	immS := int32(word)>>25<<5 | int32(word>>7&0x1f)
+	immB := int32(word)>>31<<12 | int32(word>>7&0x1)<<11 | int32(word>>25&0x3f)<<5 | int32(word>>8&0xf)<<1
+	immJ := int32(word)>>31<<20 | int32(word>>12&0xff)<<12 | int32(word>>20&0x1)<<11 | int32(word>>21&0x3ff)<<1
+
+	unknown := fmt.Sprintf(".word 0x%08x", word)
+	switch word & 0x7f {
+	case 0x37:
+		return fmt.Sprintf("lui %s, 0x%x", rd, word>>12)
+	case 0x17:
+		return fmt.Sprintf("auipc %s, 0x%x", rd, word>>12)
+	case 0x6f:
+		return fmt.Sprintf("jal %s, 0x%08x", rd, pc+uint32(immJ))
+	case 0x67:
+		return fmt.Sprintf("jalr %s, %d(%s)", rd, immI, rs1)
+	case 0x63:
+		if mnemonic := branchMnemonics[funct3]; mnemonic != "" {
+			return fmt.Sprintf("%s %s, %s, 0x%08x", mnemonic, rs1, rs2, pc+uint32(immB))
+		}
+	case 0x03:
+		if mnemonic := loadMnemonics[funct3]; mnemonic != "" {
+			return fmt.Sprintf("%s %s, %d(%s)", mnemonic, rd, immI, rs1)
+		}
+	case 0x23:
+		if mnemonic := storeMnemonics[funct3]; mnemonic != "" {
+			return fmt.Sprintf("%s %s, %d(%s)", mnemonic, rs2, immS, rs1)
+		}
+	case 0x13:
+		mnemonic := immMnemonics[funct3]
+		switch {
+		case funct3 == 1 && funct7 == 0, funct3 == 5 && funct7 == 0:
+			return fmt.Sprintf("%s %s, %s, %d", mnemonic, rd, rs1, word>>20&0x1f)
+		case funct3 == 5 && funct7 == 0x20:
+			return fmt.Sprintf("srai %s, %s, %d", rd, rs1, word>>20&0x1f)
+		case funct3 != 1 && funct3 != 5:
+			return fmt.Sprintf("%s %s, %s, %d", mnemonic, rd, rs1, immI)
+		}
+	case 0x33:
+		var mnemonic string
+		switch {
+		case funct7 == 0:
+			mnemonic = regMnemonics[funct3]
+		case funct7 == 1:
+			mnemonic = mulMnemonics[funct3]
+		case funct7 == 0x20 && funct3 == 0:
+			mnemonic = "sub"
+		case funct7 == 0x20 && funct3 == 5:
+			mnemonic = "sra"
+		}
+		if mnemonic != "" {
+			return fmt.Sprintf("%s %s, %s, %s", mnemonic, rd, rs1, rs2)
+		}
+	case 0x0f:
+		if funct3 == 1 {
+			return "fence.i"
+		}
+		return "fence"
+	case 0x73:
+		switch {
+		case word == 0x00000073:
+			return "ecall"
+		case word == 0x00100073:
+			return "ebreak"
+		case csrMnemonics[funct3] != "" && funct3 < 4:
+			return fmt.Sprintf("%s %s, 0x%03x, %s", csrMnemonics[funct3], rd, word>>20, rs1)
+		case csrMnemonics[funct3] != "":
+			return fmt.Sprintf("%s %s, 0x%03x, %d", csrMnemonics[funct3], rd, word>>20, word>>15&0x1f)
+		}
+	}
+	return unknown
+}
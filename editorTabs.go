@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// closedTab remembers a closed file so it can be reopened where it was left
+type closedTab struct {
+	path   string
+	cursor int
+}
+
+const maxClosedTabs = 20
+
+var (
+	editorTabs  *widgets.QTabWidget
+	openEditors []*CodeEditor
+	closedTabs  []closedTab
+)
+
+// createEditorTabs creates the tab widget holding one CodeEditor per open file
+func createEditorTabs() *widgets.QTabWidget {
+	editorTabs = widgets.NewQTabWidget(nil)
+	editorTabs.SetTabsClosable(true)
+	editorTabs.SetMovable(true)
+	editorTabs.SetDocumentMode(true)
+
+	editorTabs.ConnectCurrentChanged(func(index int) {
+		if e := editorAt(index); e != nil {
+			activateEditor(e)
+		}
+	})
+	editorTabs.ConnectTabCloseRequested(func(index int) {
+		if e := editorAt(index); e != nil {
+			closeEditorTab(e)
+		}
+	})
+
+	// Context menu on the tabs
+	tabBar := editorTabs.TabBar()
+	tabBar.SetContextMenuPolicy(core.Qt__CustomContextMenu)
+	tabBar.ConnectCustomContextMenuRequested(func(pos *core.QPoint) {
+		e := editorAt(tabBar.TabAt(pos))
+		if e == nil {
+			return
+		}
+
+		menu := widgets.NewQMenu(nil)
+		menu.AddAction("Close").ConnectTriggered(func(bool) { closeEditorTab(e) })
+		menu.AddAction("Close Others").ConnectTriggered(func(bool) {
+			editorTabs.SetCurrentWidget(e)
+			closeOtherTabs()
+		})
+		reopenAction := menu.AddAction("Reopen Closed Tab")
+		reopenAction.SetEnabled(len(closedTabs) > 0)
+		reopenAction.ConnectTriggered(func(bool) { reopenClosedTab() })
+		menu.Exec2(tabBar.MapToGlobal(pos), nil)
+	})
+
+	// Start with an empty untitled buffer
+	newEditorTab()
+	return editorTabs
+}
+
+// editorAt returns the editor of a tab, or nil
+func editorAt(index int) *CodeEditor {
+	if index < 0 {
+		return nil
+	}
+	widget := editorTabs.Widget(index)
+	for _, e := range openEditors {
+		if widget != nil && e.Pointer() == widget.Pointer() {
+			return e
+		}
+	}
+	return nil
+}
+
+// editorForPath returns the open editor of a file, or nil
+func editorForPath(path string) *CodeEditor {
+	for _, e := range openEditors {
+		if e.filePath != "" && e.filePath == path {
+			return e
+		}
+	}
+	return nil
+}
+
+// newEditorTab adds an empty untitled editor and makes it current
+func newEditorTab() *CodeEditor {
+	e := NewCodeEditor()
+	openEditors = append(openEditors, e)
+	if preferences.EditorSettings.FontFamily != "" {
+		applyPreferencesToCodeEditor(e)
+	}
+
+	// Mark the tab and window while the document has unsaved changes
+	e.Document().ConnectModificationChanged(func(bool) {
+		e.updateTab()
+		if e == editor {
+			mainWindow.SetWindowModified(e.Document().IsModified())
+		}
+	})
+
+	// Keep the outline in step with the active document
+	e.ConnectTextChanged(func() {
+		if e == editor {
+			outlinePanel.scheduleRefresh()
+		}
+	})
+
+	index := editorTabs.AddTab(e, editorTitle(e))
+	editorTabs.SetCurrentIndex(index)
+	activateEditor(e)
+	return e
+}
+
+// editorTitle is the text shown on an editor's tab
+func editorTitle(e *CodeEditor) string {
+	if e.filePath == "" {
+		return "Untitled"
+	}
+	return filepath.Base(e.filePath)
+}
+
+// setFilePath gives the editor a new file, e.g. after Save As
+func (e *CodeEditor) setFilePath(path string) {
+	e.filePath = path
+	e.updateTab()
+	if e == editor {
+		activateEditor(e)
+	}
+}
+
+// updateTab refreshes the tab's title, adding * when there are unsaved changes
+func (e *CodeEditor) updateTab() {
+	index := editorTabs.IndexOf(e)
+	if index < 0 {
+		return
+	}
+
+	title := editorTitle(e)
+	if e.Document().IsModified() {
+		title += "*"
+	}
+	editorTabs.SetTabText(index, title)
+	editorTabs.SetTabToolTip(index, e.filePath)
+}
+
+// activateEditor makes e the editor the rest of the IDE works on
+func activateEditor(e *CodeEditor) {
+	editor = e
+	currentFilePath = e.filePath
+	syntaxHighlighter = e.highlighter
+
+	// [*] is replaced by * while the window is marked modified
+	mainWindow.SetWindowTitle(fmt.Sprintf("RISC-GoV IDE - %s[*]", editorTitle(e)))
+	mainWindow.SetWindowModified(e.Document().IsModified())
+	outlinePanel.refresh()
+}
+
+// debugEditor returns the editor showing the code being debugged, falling
+// back to the active editor
+func debugEditor() *CodeEditor {
+	if debugInfo != nil && debugInfo.editor != nil {
+		return debugInfo.editor
+	}
+	return editor
+}
+
+// isBlank reports whether the editor is an untouched untitled buffer that
+// opening a file may replace
+func (e *CodeEditor) isBlank() bool {
+	return e.filePath == "" && !e.Document().IsModified() && e.Document().IsEmpty()
+}
+
+// maybeSaveEditor asks what to do with unsaved changes before an editor
+// goes away. It returns false if the user cancelled.
+func maybeSaveEditor(e *CodeEditor) bool {
+	if !e.Document().IsModified() {
+		return true
+	}
+
+	editorTabs.SetCurrentWidget(e)
+	answer := widgets.QMessageBox_Warning(mainWindow, "Unsaved Changes",
+		fmt.Sprintf("%s has unsaved changes. Save them?", editorTitle(e)),
+		widgets.QMessageBox__Save|widgets.QMessageBox__Discard|widgets.QMessageBox__Cancel, widgets.QMessageBox__Save)
+
+	switch answer {
+	case widgets.QMessageBox__Save:
+		saveCurrentFile()
+		return !e.Document().IsModified()
+	case widgets.QMessageBox__Discard:
+		return true
+	}
+	return false
+}
+
+// maybeSaveAll asks about every editor with unsaved changes, returning
+// false as soon as the user cancels
+func maybeSaveAll() bool {
+	for _, e := range append([]*CodeEditor{}, openEditors...) {
+		if !maybeSaveEditor(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// closeAllTabs closes every editor without asking, the caller must have
+// called maybeSaveAll first
+func closeAllTabs() {
+	for _, e := range append([]*CodeEditor{}, openEditors...) {
+		e.Document().SetModified(false)
+		closeEditorTab(e)
+	}
+}
+
+// closeEditorTab closes an editor, returning false if the user cancelled
+func closeEditorTab(e *CodeEditor) bool {
+	if debugInfo.isDebugging && debugInfo.editor == e {
+		widgets.QMessageBox_Information(mainWindow, "Debugging",
+			"Stop debugging before closing the file being debugged", widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return false
+	}
+	if !maybeSaveEditor(e) {
+		return false
+	}
+
+	if e.filePath != "" {
+		closedTabs = append(closedTabs, closedTab{path: e.filePath, cursor: e.TextCursor().Position()})
+		if len(closedTabs) > maxClosedTabs {
+			closedTabs = closedTabs[1:]
+		}
+	}
+
+	for i, open := range openEditors {
+		if open == e {
+			openEditors = append(openEditors[:i], openEditors[i+1:]...)
+			break
+		}
+	}
+	e.discardRecovery()
+	editorTabs.RemoveTab(editorTabs.IndexOf(e))
+	e.DeleteLater()
+
+	// There is always at least one editor
+	if len(openEditors) == 0 {
+		newEditorTab()
+	}
+	return true
+}
+
+// closeCurrentTab closes the active editor
+func closeCurrentTab() {
+	closeEditorTab(editor)
+}
+
+// closeOtherTabs closes every editor except the active one
+func closeOtherTabs() {
+	keep := editor
+	for _, e := range append([]*CodeEditor{}, openEditors...) {
+		if e != keep && !closeEditorTab(e) {
+			return
+		}
+	}
+	editorTabs.SetCurrentWidget(keep)
+}
+
+// reopenClosedTab opens the most recently closed file again
+func reopenClosedTab() {
+	for len(closedTabs) > 0 {
+		last := closedTabs[len(closedTabs)-1]
+		closedTabs = closedTabs[:len(closedTabs)-1]
+		if editorForPath(last.path) != nil {
+			continue
+		}
+
+		if !openFile(last.path) {
+			return
+		}
+		cursor := editor.TextCursor()
+		cursor.SetPosition(min(last.cursor, editor.Document().CharacterCount()-1), gui.QTextCursor__MoveAnchor)
+		editor.SetTextCursor(cursor)
+		editor.CenterCursor()
+		return
+	}
+}
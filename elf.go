@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	rcore "github.com/RISC-GoV/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// sourceLocation is a file and 1-based line taken from DWARF line info
+type sourceLocation struct {
+	File string
+	Line int
+}
+
+// elfDebugInfo holds what the debugger knows about a loaded ELF executable
+type elfDebugInfo struct {
+	path     string
+	imageEnd uint32 // End of the highest loaded segment
+	symbols  []programSymbol
+	lines    map[uint32]sourceLocation
+}
+
+// loadedELF is set while the debugger runs an ELF file instead of the open buffer
+var loadedELF *elfDebugInfo
+
+// writeELF writes the program as a static RV32 ELF executable with one
+// loadable segment and section per program section, and a symbol table
+func writeELF(w io.Writer, image *programImage) error {
+	const (
+		headerSize  = 52
+		progSize    = 32
+		sectionSize = 40
+		symbolSize  = 16
+	)
+
+	// Section names, the program's sections first
+	shstrtab := []byte{0}
+	addName := func(name string) uint32 {
+		offset := uint32(len(shstrtab))
+		shstrtab = append(shstrtab, name...)
+		shstrtab = append(shstrtab, 0)
+		return offset
+	}
+	strtab := []byte{0}
+
+	// Symbols point at the section holding their address, or are absolute
+	sectionIndex := func(address uint32) uint16 {
+		for i, section := range image.Sections {
+			if address >= section.Address && address <= section.Address+uint32(len(section.Data)) {
+				return uint16(i + 1)
+			}
+		}
+		return uint16(elf.SHN_ABS)
+	}
+
+	// ELF requires local symbols to come before global ones
+	symbols := append([]programSymbol{}, image.Symbols...)
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return !symbols[i].Global && symbols[j].Global
+	})
+
+	var symtab bytes.Buffer
+	binary.Write(&symtab, binary.LittleEndian, elf.Sym32{}) // Mandatory null symbol
+	firstGlobal := uint32(1)
+	for _, symbol := range symbols {
+		bind := elf.STB_LOCAL
+		if symbol.Global {
+			bind = elf.STB_GLOBAL
+		} else {
+			firstGlobal++
+		}
+		binary.Write(&symtab, binary.LittleEndian, elf.Sym32{
+			Name:  uint32(len(strtab)),
+			Value: symbol.Address,
+			Info:  elf.ST_INFO(bind, elf.STT_NOTYPE),
+			Shndx: sectionIndex(symbol.Address),
+		})
+		strtab = append(strtab, symbol.Name...)
+		strtab = append(strtab, 0)
+	}
+
+	// File layout: header, program headers, section contents, .symtab,
+	// .strtab, .shstrtab, section headers
+	count := len(image.Sections)
+	offset := uint32(headerSize + progSize*count)
+	var programs []elf.Prog32
+	sections := []elf.Section32{{}}
+	for _, section := range image.Sections {
+		offset = (offset + 3) &^ 3
+		size := uint32(len(section.Data))
+		flags, sectionFlags := elf.PF_R|elf.PF_W, elf.SHF_ALLOC|elf.SHF_WRITE
+		if isCodeSection(section.Name) {
+			flags, sectionFlags = elf.PF_R|elf.PF_X, elf.SHF_ALLOC|elf.SHF_EXECINSTR
+		}
+		programs = append(programs, elf.Prog32{
+			Type:   uint32(elf.PT_LOAD),
+			Off:    offset,
+			Vaddr:  section.Address,
+			Paddr:  section.Address,
+			Filesz: size,
+			Memsz:  size,
+			Flags:  uint32(flags),
+			Align:  4,
+		})
+		sections = append(sections, elf.Section32{
+			Name:      addName(section.Name),
+			Type:      uint32(elf.SHT_PROGBITS),
+			Flags:     uint32(sectionFlags),
+			Addr:      section.Address,
+			Off:       offset,
+			Size:      size,
+			Addralign: 4,
+		})
+		offset += size
+	}
+
+	symtabOffset := (offset + 3) &^ 3
+	strtabOffset := symtabOffset + uint32(symtab.Len())
+	symtabName, strtabName, shstrtabName := addName(".symtab"), addName(".strtab"), addName(".shstrtab")
+	shstrtabOffset := strtabOffset + uint32(len(strtab))
+	sectionOffset := (shstrtabOffset + uint32(len(shstrtab)) + 3) &^ 3
+	sections = append(sections,
+		elf.Section32{
+			Name:      symtabName,
+			Type:      uint32(elf.SHT_SYMTAB),
+			Off:       symtabOffset,
+			Size:      uint32(symtab.Len()),
+			Link:      uint32(count + 2), // .strtab
+			Info:      firstGlobal,
+			Addralign: 4,
+			Entsize:   symbolSize,
+		},
+		elf.Section32{
+			Name:      strtabName,
+			Type:      uint32(elf.SHT_STRTAB),
+			Off:       strtabOffset,
+			Size:      uint32(len(strtab)),
+			Addralign: 1,
+		},
+		elf.Section32{
+			Name:      shstrtabName,
+			Type:      uint32(elf.SHT_STRTAB),
+			Off:       shstrtabOffset,
+			Size:      uint32(len(shstrtab)),
+			Addralign: 1,
+		},
+	)
+
+	header := elf.Header32{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_RISCV),
+		Version:   uint32(elf.EV_CURRENT),
+		Entry:     image.Entry,
+		Phoff:     headerSize,
+		Shoff:     sectionOffset,
+		Ehsize:    headerSize,
+		Phentsize: progSize,
+		Phnum:     uint16(count),
+		Shentsize: sectionSize,
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  uint16(len(sections) - 1),
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	header.Ident[elf.EI_OSABI] = byte(elf.ELFOSABI_NONE)
+
+	var out bytes.Buffer
+	pad := func(to uint32) { out.Write(make([]byte, to-uint32(out.Len()))) }
+	binary.Write(&out, binary.LittleEndian, header)
+	for _, program := range programs {
+		binary.Write(&out, binary.LittleEndian, program)
+	}
+	for i, section := range image.Sections {
+		pad(programs[i].Off)
+		out.Write(section.Data)
+	}
+	pad(symtabOffset)
+	out.Write(symtab.Bytes())
+	out.Write(strtab)
+	out.Write(shstrtab)
+	pad(sectionOffset)
+	for _, section := range sections {
+		binary.Write(&out, binary.LittleEndian, section)
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// loadELF copies the loadable segments of an RV32 ELF executable into CPU
+// memory, points the PC at its entry and collects symbols and line info
+func loadELF(cpu *rcore.CPU, path string) (*elfDebugInfo, error) {
+	file, err := elf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ELF file: %v", err)
+	}
+	defer file.Close()
+
+	if file.Class != elf.ELFCLASS32 || file.Machine != elf.EM_RISCV {
+		return nil, fmt.Errorf("not a 32-bit RISC-V executable (%v, %v)", file.Class, file.Machine)
+	}
+	if file.Type != elf.ET_EXEC {
+		return nil, fmt.Errorf("not an executable (%v)", file.Type)
+	}
+
+	var imageEnd uint32
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		if end := uint32(prog.Vaddr + prog.Memsz); end > imageEnd {
+			imageEnd = end
+		}
+
+		data := make([]byte, prog.Memsz) // Bytes past Filesz stay zero (.bss)
+		if _, err := io.ReadFull(prog.Open(), data[:prog.Filesz]); err != nil {
+			return nil, fmt.Errorf("failed to read segment at 0x%08x: %v", prog.Vaddr, err)
+		}
+		if err := writeMemory(cpu, uint32(prog.Vaddr), data); err != nil {
+			return nil, err
+		}
+	}
+	cpu.PC = uint32(file.Entry)
+
+	info := &elfDebugInfo{
+		path:     path,
+		imageEnd: imageEnd,
+		lines:    make(map[uint32]sourceLocation),
+	}
+
+	// Symbols are optional, stripped binaries simply have none
+	if symbols, err := file.Symbols(); err == nil {
+		for _, symbol := range symbols {
+			kind := elf.ST_TYPE(symbol.Info)
+			if symbol.Name == "" || kind == elf.STT_SECTION || kind == elf.STT_FILE {
+				continue
+			}
+			info.symbols = append(info.symbols, programSymbol{
+				Name:    symbol.Name,
+				Address: uint32(symbol.Value),
+				Global:  elf.ST_BIND(symbol.Info) == elf.STB_GLOBAL,
+			})
+		}
+		sort.SliceStable(info.symbols, func(i, j int) bool {
+			return info.symbols[i].Address < info.symbols[j].Address
+		})
+	}
+
+	// So is DWARF line info, only present when built with -g
+	if data, err := file.DWARF(); err == nil {
+		reader := data.Reader()
+		for {
+			entry, err := reader.Next()
+			if err != nil || entry == nil {
+				break
+			}
+			if entry.Tag != dwarf.TagCompileUnit {
+				reader.SkipChildren()
+				continue
+			}
+
+			lineReader, err := data.LineReader(entry)
+			if err == nil && lineReader != nil {
+				var line dwarf.LineEntry
+				for lineReader.Next(&line) == nil {
+					if !line.EndSequence && line.File != nil {
+						info.lines[uint32(line.Address)] = sourceLocation{File: line.File.Name, Line: line.Line}
+					}
+				}
+			}
+			reader.SkipChildren()
+		}
+	}
+
+	return info, nil
+}
+
+// symbolize describes an address as symbol+offset using the nearest preceding symbol
+func (info *elfDebugInfo) symbolize(address uint32) string {
+	index := sort.Search(len(info.symbols), func(i int) bool {
+		return info.symbols[i].Address > address
+	}) - 1
+	if index < 0 {
+		return fmt.Sprintf("0x%08x", address)
+	}
+	symbol := info.symbols[index]
+	if symbol.Address == address {
+		return fmt.Sprintf("0x%08x <%s>", address, symbol.Name)
+	}
+	return fmt.Sprintf("0x%08x <%s+%d>", address, symbol.Name, address-symbol.Address)
+}
+
+// hasBreakpoint reports whether a breakpoint is set on the source line of address
+func (info *elfDebugInfo) hasBreakpoint(address uint32) bool {
+	location, ok := info.lines[address]
+	if !ok {
+		return false
+	}
+	e := editorForPath(location.File)
+	return e != nil && e.breakpoints[location.Line-1]
+}
+
+// highlight looks up the source line of address and queues it to be shown
+// on the GUI thread, as it is called from the debugger's goroutines
+func (info *elfDebugInfo) highlight(address uint32) {
+	location, ok := info.lines[address]
+	if !ok {
+		debugLog.Log(fmt.Sprintf("PC = %s", info.symbolize(address)))
+		return
+	}
+	if _, err := os.Stat(location.File); err != nil {
+		debugLog.Log(fmt.Sprintf("PC = %s (%s:%d)", info.symbolize(address), location.File, location.Line))
+		return
+	}
+	postHighlight(location)
+}
+
+var (
+	// pendingHighlight is the source line the GUI thread shows next
+	pendingHighlight     *sourceLocation
+	pendingHighlightLock sync.Mutex
+)
+
+// postHighlight queues a source line to be highlighted by flushHighlight
+func postHighlight(location sourceLocation) {
+	pendingHighlightLock.Lock()
+	defer pendingHighlightLock.Unlock()
+	pendingHighlight = &location
+}
+
+// flushHighlight shows the last queued source line, opening its file if
+// needed. It runs on the GUI thread with the output panes' flush.
+func flushHighlight() {
+	pendingHighlightLock.Lock()
+	location := pendingHighlight
+	pendingHighlight = nil
+	pendingHighlightLock.Unlock()
+	if location == nil || !debugInfo.isDebugging {
+		return
+	}
+
+	if debugEditor().filePath != location.File {
+		if !openFile(location.File) {
+			return
+		}
+		debugInfo.editor = editor
+	}
+
+	currentHighline = location.Line - 1
+	debugEditor().showHighlightedLine()
+}
+
+func debugELFDialog() {
+	filePath := widgets.QFileDialog_GetOpenFileName(mainWindow, "Debug ELF Executable", currentProjectPath,
+		"ELF Executables (*.elf);;All Files (*)", "", 0)
+	if filePath == "" {
+		return
+	}
+
+	// Stop any existing debug session first to ensure clean state
+	if debugInfo.isDebugging {
+		stopDebugging()
+	}
+
+	cpu := rcore.NewCPU(rcore.NewMemory())
+	rcore.Kernel.Init()
+	info, err := loadELF(cpu, filePath)
+	if err != nil {
+		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Failed to load %s:\n%v", filepath.Base(filePath), err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	// Pass arguments and redirect I/O as configured
+	if projectSettingsPath == "" {
+		LoadProjectSettings(projectRoot())
+	}
+	session := newProgramSession(cpu)
+	if err := applyRunConfiguration(session, filePath); err != nil {
+		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Failed to apply run configuration:\n%v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	session.activate()
+
+	debugLog.Clear()
+	debugLog.reveal()
+	debugLog.Log(fmt.Sprintf("Loaded %s (%d symbols, %d line entries)\nEntry point: %s",
+		filepath.Base(filePath), len(info.symbols), len(info.lines), info.symbolize(uint32(cpu.PC))))
+
+	// Start debug session with the ELF image
+	loadedELF = info
+	debugInfo.isDebugging = true
+	debugInfo.cpu = cpu
+	debugInfo.session = session
+	debugInfo.symbols = info.symbols
+	debugInfo.imageEnd = info.imageEnd
+	showDebugWindows()
+
+	updateRegistersDisplay()
+	loadedELF.highlight(uint32(cpu.PC))
+	debugLog.Log("Debug session started. Use Step or Continue.")
+}
+
+func exportELFDialog() {
+	if currentFilePath == "" {
+		widgets.QMessageBox_Information(mainWindow, "No File", "No file is currently open to export", widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	outputDir := filepath.Join(filepath.Dir(currentFilePath), ".riscgov_ide/assembling")
+	defaultPath := currentFilePath[:len(currentFilePath)-len(filepath.Ext(currentFilePath))] + ".elf"
+	filePath := widgets.QFileDialog_GetSaveFileName(mainWindow, "Export ELF Executable", defaultPath,
+		"ELF Executables (*.elf);;All Files (*)", "", 0)
+	if filePath == "" {
+		return
+	}
+
+	if !assembleForExport(outputDir) {
+		return
+	}
+
+	image, err := buildProgramImage(currentFilePath, filepath.Join(outputDir, "output.exe"))
+	if err == nil {
+		err = writeArtifact(filePath, image, writeELF)
+	}
+	if err != nil {
+		buildLog.Log(fmt.Sprintf("ELF export failed: %v", err))
+		buildLog.reveal()
+		return
+	}
+	buildLog.Log(fmt.Sprintf("Exported %s", filePath))
+}
+
+// showHighlightedLine scrolls to currentHighline and repaints the gutter
+func (e *CodeEditor) showHighlightedLine() {
+	e.revealLine(currentHighline)
+	block := e.Document().FindBlockByNumber(currentHighline)
+	cursor := e.TextCursor()
+	cursor.SetPosition(block.Position(), gui.QTextCursor__MoveAnchor)
+	e.SetTextCursor(cursor)
+	e.CenterCursor()
+
+	// Redraw line number area to show highlight
+	e.lineNumberArea.Update()
+}
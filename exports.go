@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	rcore "github.com/RISC-GoV/core"
+	assembler "github.com/RISC-GoV/risc-assembler"
+	"github.com/therecipe/qt/widgets"
+)
+
+// listingEntry is one source line of the listing with the bytes it assembled to
+type listingEntry struct {
+	Address uint32
+	Bytes   []byte
+	Code    bool // Instructions, shown as words rather than bytes
+	Line    int  // 1-based source line
+	Source  string
+}
+
+// programSymbol is a label and the address it resolves to
+type programSymbol struct {
+	Name    string
+	Address uint32
+	Global  bool
+}
+
+// programSection is one section of the assembled program
+type programSection struct {
+	Name    string
+	Address uint32
+	Data    []byte
+}
+
+// programImage is the assembled program together with the information
+// needed to relate it back to the source
+type programImage struct {
+	Entry    uint32
+	Sections []programSection // Sorted by address
+	Listing  []listingEntry
+	Symbols  []programSymbol
+}
+
+// End returns the address just past the highest section
+func (image *programImage) End() uint32 {
+	var end uint32
+	for _, section := range image.Sections {
+		end = max(end, section.Address+uint32(len(section.Data)))
+	}
+	return end
+}
+
+// isCodeSection reports whether a section holds instructions
+func isCodeSection(name string) bool {
+	return strings.HasPrefix(name, ".text")
+}
+
+// buildProgramImage lays the source out as the assembler does, each
+// section placed after the previous one from address 0 in the order they
+// first appear, and takes the bytes and the entry point from loading the
+// assembler's output. Matching the source lines to the bytes they
+// produced gives the listing.
+func buildProgramImage(sourcePath, exePath string) (*programImage, error) {
+	source, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %v", err)
+	}
+
+	cpu := rcore.NewCPU(rcore.NewMemory())
+	if err := cpu.LoadFile(exePath); err != nil {
+		return nil, fmt.Errorf("failed to load program: %v", err)
+	}
+	image := &programImage{Entry: uint32(cpu.PC)}
+
+	// Size every statement at its offset within its section
+	type placement struct {
+		section      string
+		offset, size uint32
+	}
+	lines := strings.Split(string(source), "\n")
+	statements := parseAsmLines(lines)
+	placements := make([]placement, len(statements))
+	sizes := map[string]uint32{".text": 0}
+	order := []string{".text"}
+	globals := make(map[string]bool)
+	current := ".text"
+	for i, statement := range statements {
+		if name, ok := sectionSwitch(statement); ok {
+			current = name
+			if _, seen := sizes[name]; !seen {
+				sizes[name] = 0
+				order = append(order, name)
+			}
+		}
+		if mnemonic := statement.Mnemonic(); (mnemonic == ".globl" || mnemonic == ".global") && len(statement.Fields) > 1 {
+			for _, name := range strings.Split(strings.Join(statement.Fields[1:], ""), ",") {
+				globals[name] = true
+			}
+		}
+		size := statementSize(statement, sizes[current])
+		placements[i] = placement{section: current, offset: sizes[current], size: size}
+		sizes[current] += size
+	}
+
+	// Place the sections word-aligned one after another and read their bytes
+	bases := make(map[string]uint32)
+	var address uint32
+	for _, name := range order {
+		bases[name] = address
+		if sizes[name] == 0 {
+			continue
+		}
+		data := make([]byte, sizes[name])
+		for i := range data {
+			if data[i], err = cpu.Memory.ReadByte(address + uint32(i)); err != nil {
+				return nil, fmt.Errorf("failed to read section %s at 0x%08x: %v", name, address+uint32(i), err)
+			}
+		}
+		image.Sections = append(image.Sections, programSection{Name: name, Address: address, Data: data})
+		address = (address + sizes[name] + 3) &^ 3
+	}
+
+	for i, statement := range statements {
+		placed := placements[i]
+		address := bases[placed.section] + placed.offset
+		if statement.Label != "" {
+			image.Symbols = append(image.Symbols, programSymbol{Name: statement.Label, Address: address, Global: globals[statement.Label]})
+		}
+		image.Listing = append(image.Listing, listingEntry{
+			Address: address,
+			Bytes:   image.read(address, placed.size),
+			Code:    isCodeSection(placed.section) && isInstruction(statement.Mnemonic()),
+			Line:    i + 1,
+			Source:  lines[i],
+		})
+	}
+	sort.SliceStable(image.Symbols, func(i, j int) bool {
+		return image.Symbols[i].Address < image.Symbols[j].Address
+	})
+
+	return image, nil
+}
+
+// read returns the bytes of the program between address and address+size
+func (image *programImage) read(address, size uint32) []byte {
+	if size == 0 {
+		return nil
+	}
+	for _, section := range image.Sections {
+		if address >= section.Address && address+size <= section.Address+uint32(len(section.Data)) {
+			offset := address - section.Address
+			return section.Data[offset : offset+size]
+		}
+	}
+	return nil
+}
+
+// readWord reads a little-endian 32-bit word from CPU memory
+func readWord(cpu *rcore.CPU, address uint32) (uint32, error) {
+	var buf [4]byte
+	for i := range buf {
+		value, err := cpu.Memory.ReadByte(address + uint32(i))
+		if err != nil {
+			return 0, fmt.Errorf("failed to read memory at 0x%08x: %v", address+uint32(i), err)
+		}
+		buf[i] = value
+	}
+	return binary.LittleEndian.Uint32(buf[:]), nil
+}
+
+// sectionSwitch reports the section a directive switches to
+func sectionSwitch(line asmLine) (string, bool) {
+	switch line.Mnemonic() {
+	case ".text", ".data", ".bss", ".rodata":
+		return line.Mnemonic(), true
+	case ".section":
+		if len(line.Fields) > 1 {
+			return strings.TrimSuffix(line.Fields[1], ","), true
+		}
+	}
+	return "", false
+}
+
+// statementSize returns how many bytes a statement occupies at address:
+// instructions, data directives and the padding of alignment directives
+func statementSize(line asmLine, address uint32) uint32 {
+	if count := instructionWordCount(line.Fields); count > 0 {
+		return uint32(4 * count)
+	}
+
+	// Operands are taken from the code so strings keep their spaces
+	code := strings.TrimSpace(line.Code)
+	if line.Label != "" {
+		code = strings.TrimSpace(code[strings.Index(code, ":")+1:])
+	}
+	operands := strings.TrimSpace(strings.TrimPrefix(code, line.Mnemonic()))
+	values := len(operandNames(operands))
+	number := func() uint32 {
+		first, _, _ := strings.Cut(operands, ",")
+		n, _ := strconv.ParseUint(strings.TrimSpace(first), 0, 32)
+		return uint32(n)
+	}
+	padding := func(alignment uint32) uint32 {
+		if alignment == 0 {
+			return 0
+		}
+		return (alignment - address%alignment) % alignment
+	}
+
+	switch line.Mnemonic() {
+	case ".byte":
+		return uint32(values)
+	case ".half", ".2byte":
+		return uint32(2 * values)
+	case ".word", ".4byte":
+		return uint32(4 * values)
+	case ".dword", ".8byte":
+		return uint32(8 * values)
+	case ".zero", ".space":
+		return number()
+	case ".align", ".p2align":
+		return padding(1 << number())
+	case ".balign":
+		return padding(number())
+	case ".string", ".asciz", ".ascii":
+		text, err := strconv.Unquote(operands)
+		if err != nil {
+			return 0
+		}
+		if line.Mnemonic() == ".ascii" {
+			return uint32(len(text))
+		}
+		return uint32(len(text) + 1)
+	}
+	return 0
+}
+
+// writeListing writes address, machine code and source for every line
+func writeListing(w io.Writer, image *programImage) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; Entry point: 0x%08x\n", image.Entry)
+	fmt.Fprintf(bw, "; %-8s  %-8s  %5s  %s\n", "Address", "Code", "Line", "Source")
+
+	for _, entry := range image.Listing {
+		if len(entry.Bytes) == 0 {
+			fmt.Fprintf(bw, "  %-8s  %-8s  %5d  %s\n", "", "", entry.Line, entry.Source)
+			continue
+		}
+		for offset := 0; offset < len(entry.Bytes); offset += 4 {
+			chunk := entry.Bytes[offset:min(offset+4, len(entry.Bytes))]
+			code := fmt.Sprintf("%x", chunk)
+			if entry.Code && len(chunk) == 4 {
+				code = fmt.Sprintf("%08x", binary.LittleEndian.Uint32(chunk))
+			}
+			source := entry.Source
+			if offset > 0 {
+				source = "" // Continuation of an expanded pseudo-instruction or of data
+			}
+			fmt.Fprintf(bw, "  %08x  %-8s  %5d  %s\n", entry.Address+uint32(offset), code, entry.Line, source)
+		}
+	}
+	return bw.Flush()
+}
+
+// writeSymbolMap writes every label with its address, sorted by address
+func writeSymbolMap(w io.Writer, image *programImage) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; %-8s  %-6s  %s\n", "Address", "Scope", "Symbol")
+	for _, symbol := range image.Symbols {
+		scope := "local"
+		if symbol.Global {
+			scope = "global"
+		}
+		fmt.Fprintf(bw, "  %08x  %-6s  %s\n", symbol.Address, scope, symbol.Name)
+	}
+	return bw.Flush()
+}
+
+// maxBinGap is the largest gap between sections a raw image fills with
+// zeros. Sections further apart need the HEX, memory or ELF export.
+const maxBinGap = 1 << 20
+
+// flatten lays the sections out as one block of memory starting at the
+// lowest section, the gaps between sections filled with zeros
+func (image *programImage) flatten() (uint32, []byte, error) {
+	if len(image.Sections) == 0 {
+		return 0, nil, nil
+	}
+	base := image.Sections[0].Address
+	end := base
+	for _, section := range image.Sections {
+		if section.Address > end && section.Address-end > maxBinGap {
+			return 0, nil, fmt.Errorf("section %s at 0x%08x is %d bytes past the previous one, more than a raw image fills (%d)",
+				section.Name, section.Address, section.Address-end, maxBinGap)
+		}
+		end = max(end, section.Address+uint32(len(section.Data)))
+	}
+
+	data := make([]byte, end-base)
+	for _, section := range image.Sections {
+		copy(data[section.Address-base:], section.Data)
+	}
+	return base, data, nil
+}
+
+// writeBin writes the raw memory image, code and data, from the lowest section
+func writeBin(w io.Writer, image *programImage) error {
+	_, data, err := image.flatten()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeIntelHex writes every section as Intel HEX records
+func writeIntelHex(w io.Writer, image *programImage) error {
+	bw := bufio.NewWriter(w)
+
+	record := func(recordType byte, address uint16, data []byte) {
+		sum := byte(len(data)) + byte(address>>8) + byte(address) + recordType
+		fmt.Fprintf(bw, ":%02X%04X%02X", len(data), address, recordType)
+		for _, b := range data {
+			fmt.Fprintf(bw, "%02X", b)
+			sum += b
+		}
+		fmt.Fprintf(bw, "%02X\n", byte(-int(sum)))
+	}
+
+	upper := uint32(0)
+	for _, section := range image.Sections {
+		for offset := 0; offset < len(section.Data); {
+			address := section.Address + uint32(offset)
+
+			// Emit an extended linear address record when crossing 64K
+			if address>>16 != upper {
+				upper = address >> 16
+				record(0x04, 0, []byte{byte(upper >> 8), byte(upper)})
+			}
+
+			// Records hold up to 16 bytes and end at the next 64K boundary
+			// so their 16-bit addresses do not wrap
+			length := min(16, len(section.Data)-offset, int(0x10000-address&0xffff))
+			record(0x00, uint16(address), section.Data[offset:offset+length])
+			offset += length
+		}
+	}
+
+	// Start linear address and end of file
+	record(0x05, 0, binary.BigEndian.AppendUint32(nil, image.Entry))
+	record(0x01, 0, nil)
+	return bw.Flush()
+}
+
+// writeMemInit writes one 32-bit word per line for Verilog $readmemh, each
+// section starting with the word address it is loaded at
+func writeMemInit(w io.Writer, image *programImage) error {
+	bw := bufio.NewWriter(w)
+	for _, section := range image.Sections {
+		fmt.Fprintf(bw, "@%08x\n", section.Address/4)
+		for offset := 0; offset < len(section.Data); offset += 4 {
+			var word [4]byte // The last word of a section is padded with zeros
+			copy(word[:], section.Data[offset:])
+			fmt.Fprintf(bw, "%08x\n", binary.LittleEndian.Uint32(word[:]))
+		}
+	}
+	return bw.Flush()
+}
+
+// writeArtifact creates path and fills it using write, removing it again
+// if write fails
+func writeArtifact(path string, image *programImage, write func(io.Writer, *programImage) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file, image); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	return file.Close()
+}
+
+// assembleForExport saves the current file and assembles it into outputDir,
+// reporting any failure to the user
+func assembleForExport(outputDir string) bool {
+	saveCurrentFile()
+
+	// Create hidden directory for assembled output
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		log.Printf("Error creating output directory: %v", err)
+		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Failed to create output directory: %v", err), widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return false
+	}
+
+	buildLog.Clear()
+	buildLog.Log("Assembling code...")
+
+	asm := assembler.Assembler{}
+	if err := asm.Assemble(currentFilePath, outputDir); err != nil {
+		buildLog.Log(fmt.Sprintf("Assembly failed: %v", err))
+		buildLog.reveal()
+		return false
+	}
+	return true
+}
+
+func exportArtifacts() {
+	if currentFilePath == "" {
+		widgets.QMessageBox_Information(mainWindow, "No File", "No file is currently open to export", widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	if projectSettingsPath == "" {
+		LoadProjectSettings(projectRoot())
+	}
+	config := activeBuildConfiguration()
+	if err := checkConfigurationName(config.Name); err != nil {
+		widgets.QMessageBox_Warning(mainWindow, "Invalid Configuration", fmt.Sprintf("Cannot export: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	outputDir := filepath.Join(filepath.Dir(currentFilePath), ".riscgov_ide/assembling")
+	if !assembleForExport(outputDir) {
+		return
+	}
+
+	image, err := buildProgramImage(currentFilePath, filepath.Join(outputDir, "output.exe"))
+	if err != nil {
+		buildLog.Log(fmt.Sprintf("Export failed: %v", err))
+		buildLog.reveal()
+		return
+	}
+
+	// Artifacts go next to the source, one folder per configuration
+	exportDir := filepath.Join(filepath.Dir(currentFilePath), ".riscgov_ide/build", config.Name)
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		buildLog.Log(fmt.Sprintf("Failed to create export directory: %v", err))
+		buildLog.reveal()
+		return
+	}
+
+	baseName := strings.TrimSuffix(filepath.Base(currentFilePath), filepath.Ext(currentFilePath))
+	artifacts := []struct {
+		enabled bool
+		ext     string
+		write   func(io.Writer, *programImage) error
+	}{
+		{config.ExportListing, ".lst", writeListing},
+		{config.ExportSymbols, ".map", writeSymbolMap},
+		{config.ExportBin, ".bin", writeBin},
+		{config.ExportHex, ".hex", writeIntelHex},
+		{config.ExportMemInit, ".mem", writeMemInit},
+		{config.ExportELF, ".elf", writeELF},
+	}
+
+	var written []string
+	for _, artifact := range artifacts {
+		if !artifact.enabled {
+			continue
+		}
+		path := filepath.Join(exportDir, baseName+artifact.ext)
+		if err := writeArtifact(path, image, artifact.write); err != nil {
+			buildLog.Log(fmt.Sprintf("Failed to write %s: %v", path, err))
+			buildLog.reveal()
+			return
+		}
+		written = append(written, path)
+	}
+
+	if len(written) == 0 {
+		buildLog.Log(fmt.Sprintf("Assembly successful. No artifacts are enabled for the %s configuration.", config.Name))
+		return
+	}
+	buildLog.Log(fmt.Sprintf("Assembly successful.\nExported %d artifact(s):\n%s", len(written), strings.Join(written, "\n")))
+}
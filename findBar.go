@@ -0,0 +1,444 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// searchOptions are the toggles shared by the Find bar and Find in Project
+type searchOptions struct {
+	matchCase bool
+	wholeWord bool
+	regex     bool
+}
+
+// textMatch is one match in a document, as Qt cursor positions
+type textMatch struct {
+	start, end int
+	byteStart  int // Byte offsets into the searched text
+	byteEnd    int
+	submatches []int // Byte offsets of the groups, for expanding replacements
+}
+
+// compileSearch turns the search text into a regular expression. Without
+// the regex option the text is matched literally.
+func compileSearch(text string, options searchOptions) (*regexp.Regexp, error) {
+	pattern := text
+	if !options.regex {
+		pattern = regexp.QuoteMeta(text)
+	}
+	if options.wholeWord {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if !options.matchCase {
+		pattern = `(?i)` + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+	return re, nil
+}
+
+// utf16Length is the number of UTF-16 code units in s, which is how Qt
+// counts text positions
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// findMatches lists the non-empty matches of re in text
+func findMatches(re *regexp.Regexp, text string) []textMatch {
+	var matches []textMatch
+	position, offset := 0, 0
+	for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		position += utf16Length(text[offset:loc[0]])
+		start := position
+		position += utf16Length(text[loc[0]:loc[1]])
+		offset = loc[1]
+		matches = append(matches, textMatch{start: start, end: position, byteStart: loc[0], byteEnd: loc[1], submatches: loc})
+	}
+	return matches
+}
+
+// replacementFor expands the replacement text for one match, $1 style
+// groups are only expanded in regex mode
+func replacementFor(re *regexp.Regexp, text string, match textMatch, replacement string, options searchOptions) string {
+	if !options.regex {
+		return replacement
+	}
+	return string(re.ExpandString(nil, replacement, text, match.submatches))
+}
+
+// FindBar is the incremental find and replace bar above the editor tabs
+type FindBar struct {
+	*widgets.QWidget
+	findInput    *widgets.QLineEdit
+	replaceInput *widgets.QLineEdit
+	replaceRow   *widgets.QWidget
+	matchCase    *widgets.QCheckBox
+	wholeWord    *widgets.QCheckBox
+	regex        *widgets.QCheckBox
+	inSelection  *widgets.QCheckBox
+	statusLabel  *widgets.QLabel
+	searchAnchor int // Where incremental search starts from
+
+	// The selection In Selection searches, a cursor so it follows edits
+	scope       *gui.QTextCursor
+	scopeEditor *CodeEditor
+}
+
+var findBar *FindBar
+
+// NewFindBar creates the hidden find bar
+func NewFindBar() *FindBar {
+	bar := &FindBar{QWidget: widgets.NewQWidget(nil, 0)}
+
+	// Find row
+	findRow := widgets.NewQHBoxLayout()
+	findRow.SetContentsMargins(0, 0, 0, 0)
+
+	bar.findInput = widgets.NewQLineEdit(nil)
+	bar.findInput.SetPlaceholderText("Find")
+	bar.findInput.SetClearButtonEnabled(true)
+	bar.findInput.ConnectTextEdited(func(string) { bar.findIncremental() })
+	bar.findInput.ConnectReturnPressed(func() {
+		backward := gui.QGuiApplication_KeyboardModifiers()&core.Qt__ShiftModifier != 0
+		bar.find(backward)
+	})
+	findRow.AddWidget(bar.findInput, 1, 0)
+
+	bar.matchCase = widgets.NewQCheckBox2("Match Case", nil)
+	bar.wholeWord = widgets.NewQCheckBox2("Whole Word", nil)
+	bar.regex = widgets.NewQCheckBox2("Regex", nil)
+	for _, check := range []*widgets.QCheckBox{bar.matchCase, bar.wholeWord, bar.regex} {
+		check.ConnectToggled(func(bool) { bar.findIncremental() })
+		findRow.AddWidget(check, 0, 0)
+	}
+
+	bar.inSelection = widgets.NewQCheckBox2("In Selection", nil)
+	bar.inSelection.SetToolTip("Find and replace only within the text selected when this is turned on")
+	bar.inSelection.ConnectToggled(func(checked bool) {
+		if checked && !bar.setScope() {
+			bar.inSelection.SetChecked(false)
+			return
+		}
+		if !checked {
+			bar.scope = nil
+		}
+		bar.findIncremental()
+	})
+	findRow.AddWidget(bar.inSelection, 0, 0)
+
+	previousButton := widgets.NewQPushButton2("Previous", nil)
+	previousButton.ConnectClicked(func(bool) { bar.find(true) })
+	findRow.AddWidget(previousButton, 0, 0)
+
+	nextButton := widgets.NewQPushButton2("Next", nil)
+	nextButton.ConnectClicked(func(bool) { bar.find(false) })
+	findRow.AddWidget(nextButton, 0, 0)
+
+	bar.statusLabel = widgets.NewQLabel(nil, 0)
+	bar.statusLabel.SetMinimumWidth(90)
+	findRow.AddWidget(bar.statusLabel, 0, 0)
+
+	closeButton := widgets.NewQPushButton2("Close", nil)
+	closeButton.ConnectClicked(func(bool) { bar.close() })
+	findRow.AddWidget(closeButton, 0, 0)
+
+	// Replace row
+	bar.replaceRow = widgets.NewQWidget(nil, 0)
+	replaceLayout := widgets.NewQHBoxLayout()
+	replaceLayout.SetContentsMargins(0, 0, 0, 0)
+
+	bar.replaceInput = widgets.NewQLineEdit(nil)
+	bar.replaceInput.SetPlaceholderText("Replace ($1 inserts a group in regex mode)")
+	bar.replaceInput.ConnectReturnPressed(func() { bar.replace() })
+	replaceLayout.AddWidget(bar.replaceInput, 1, 0)
+
+	replaceButton := widgets.NewQPushButton2("Replace", nil)
+	replaceButton.ConnectClicked(func(bool) { bar.replace() })
+	replaceLayout.AddWidget(replaceButton, 0, 0)
+
+	replaceAllButton := widgets.NewQPushButton2("Replace All", nil)
+	replaceAllButton.ConnectClicked(func(bool) { bar.replaceAll() })
+	replaceLayout.AddWidget(replaceAllButton, 0, 0)
+	bar.replaceRow.SetLayout(replaceLayout)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.SetContentsMargins(2, 2, 2, 2)
+	layout.AddLayout(findRow, 0)
+	layout.AddWidget(bar.replaceRow, 0, 0)
+	bar.SetLayout(layout)
+
+	// Escape closes the bar and returns to the editor
+	escape := widgets.NewQShortcut2(gui.NewQKeySequence2("Esc", gui.QKeySequence__NativeText), bar, "", "", core.Qt__WidgetWithChildrenShortcut)
+	escape.ConnectActivated(func() { bar.close() })
+
+	bar.SetSizePolicy2(widgets.QSizePolicy__Preferred, widgets.QSizePolicy__Fixed)
+	bar.SetVisible(false)
+	return bar
+}
+
+// open shows the bar, seeded with the editor's selection
+func (bar *FindBar) open(withReplace bool) {
+	bar.replaceRow.SetVisible(withReplace)
+	bar.SetVisible(true)
+
+	// A selection spanning lines is searched in rather than searched for
+	cursor := editor.TextCursor()
+	selected := cursor.SelectedText()
+	multiline := containsParagraphSeparator(selected)
+	if selected != "" && !multiline {
+		bar.findInput.SetText(selected)
+	}
+	if multiline && bar.inSelection.IsChecked() {
+		bar.setScope()
+	}
+	bar.inSelection.SetChecked(multiline)
+	bar.searchAnchor = cursor.SelectionStart()
+	bar.findInput.SetFocus2()
+	bar.findInput.SelectAll()
+	bar.updateStatus()
+}
+
+// close hides the bar and gives focus back to the editor
+func (bar *FindBar) close() {
+	bar.SetVisible(false)
+	bar.findInput.SetStyleSheet("")
+	editor.SetFocus2()
+}
+
+// setScope limits the search to the editor's selection, reporting false
+// if nothing is selected
+func (bar *FindBar) setScope() bool {
+	cursor := editor.TextCursor()
+	if !cursor.HasSelection() {
+		return false
+	}
+	bar.scope = cursor
+	bar.scopeEditor = editor
+	return true
+}
+
+// inScope keeps the matches inside the In Selection scope
+func (bar *FindBar) inScope(matches []textMatch) []textMatch {
+	if bar.scope == nil {
+		return matches
+	}
+	if bar.scopeEditor != editor {
+		// Another tab is active, its selection was never chosen
+		bar.scope = nil
+		bar.inSelection.BlockSignals(true)
+		bar.inSelection.SetChecked(false)
+		bar.inSelection.BlockSignals(false)
+		return matches
+	}
+
+	start, end := bar.scope.SelectionStart(), bar.scope.SelectionEnd()
+	var scoped []textMatch
+	for _, match := range matches {
+		if match.start >= start && match.end <= end {
+			scoped = append(scoped, match)
+		}
+	}
+	return scoped
+}
+
+// containsParagraphSeparator reports whether a selection spans lines
+func containsParagraphSeparator(text string) bool {
+	for _, r := range text {
+		if r == '\u2029' || r == '\n' {
+			return true
+		}
+	}
+	return false
+}
+
+// options returns the state of the toggles
+func (bar *FindBar) options() searchOptions {
+	return searchOptions{
+		matchCase: bar.matchCase.IsChecked(),
+		wholeWord: bar.wholeWord.IsChecked(),
+		regex:     bar.regex.IsChecked(),
+	}
+}
+
+// matches finds the search text in the active editor
+func (bar *FindBar) matches() (*regexp.Regexp, string, []textMatch, error) {
+	if bar.findInput.Text() == "" {
+		return nil, "", nil, nil
+	}
+	re, err := compileSearch(bar.findInput.Text(), bar.options())
+	if err != nil {
+		return nil, "", nil, err
+	}
+	text := editor.ToPlainText()
+	return re, text, bar.inScope(findMatches(re, text)), nil
+}
+
+// findIncremental selects the first match at or after where the search started
+func (bar *FindBar) findIncremental() {
+	_, _, matches, err := bar.matches()
+	if err != nil || len(matches) == 0 {
+		bar.showResult(err, matches, -1)
+		return
+	}
+
+	index := 0
+	for i, match := range matches {
+		if match.start >= bar.searchAnchor {
+			index = i
+			break
+		}
+	}
+	bar.selectMatch(matches, index)
+}
+
+// find selects the next or previous match, wrapping around the document
+func (bar *FindBar) find(backward bool) {
+	_, _, matches, err := bar.matches()
+	if err != nil || len(matches) == 0 {
+		bar.showResult(err, matches, -1)
+		return
+	}
+
+	cursor := editor.TextCursor()
+	index := -1
+	if backward {
+		for i := len(matches) - 1; i >= 0; i-- {
+			if matches[i].end <= cursor.SelectionStart() && matches[i].start < cursor.SelectionStart() {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			index = len(matches) - 1
+		}
+	} else {
+		for i, match := range matches {
+			if match.start >= cursor.SelectionEnd() && !(match.start == cursor.SelectionStart() && match.end == cursor.SelectionEnd()) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			index = 0
+		}
+	}
+	bar.selectMatch(matches, index)
+	bar.searchAnchor = matches[index].start
+}
+
+// selectMatch selects a match in the editor and shows its number
+func (bar *FindBar) selectMatch(matches []textMatch, index int) {
+	cursor := editor.TextCursor()
+	cursor.SetPosition(matches[index].start, gui.QTextCursor__MoveAnchor)
+	cursor.SetPosition(matches[index].end, gui.QTextCursor__KeepAnchor)
+	editor.SetTextCursor(cursor)
+	editor.EnsureCursorVisible()
+	bar.showResult(nil, matches, index)
+}
+
+// showResult shows the match count, colouring the input when nothing matched
+func (bar *FindBar) showResult(err error, matches []textMatch, index int) {
+	switch {
+	case err != nil:
+		bar.findInput.SetStyleSheet(errorInputStyle())
+		bar.statusLabel.SetText("Invalid regex")
+		bar.statusLabel.SetToolTip(err.Error())
+	case bar.findInput.Text() == "":
+		bar.findInput.SetStyleSheet("")
+		bar.statusLabel.SetText("")
+	case len(matches) == 0:
+		bar.findInput.SetStyleSheet(errorInputStyle())
+		bar.statusLabel.SetText("No results")
+	case index < 0:
+		bar.findInput.SetStyleSheet("")
+		bar.statusLabel.SetText(fmt.Sprintf("%d matches", len(matches)))
+	default:
+		bar.findInput.SetStyleSheet("")
+		bar.statusLabel.SetText(fmt.Sprintf("%d of %d", index+1, len(matches)))
+	}
+	if err == nil {
+		bar.statusLabel.SetToolTip("")
+	}
+}
+
+// updateStatus refreshes the match count without moving the selection
+func (bar *FindBar) updateStatus() {
+	_, _, matches, err := bar.matches()
+	cursor := editor.TextCursor()
+	index := -1
+	for i, match := range matches {
+		if match.start == cursor.SelectionStart() && match.end == cursor.SelectionEnd() {
+			index = i
+		}
+	}
+	bar.showResult(err, matches, index)
+}
+
+// replace replaces the selected match and moves on to the next one
+func (bar *FindBar) replace() {
+	re, text, matches, err := bar.matches()
+	if err != nil || len(matches) == 0 {
+		bar.showResult(err, matches, -1)
+		return
+	}
+
+	cursor := editor.TextCursor()
+	for _, match := range matches {
+		if match.start == cursor.SelectionStart() && match.end == cursor.SelectionEnd() {
+			cursor.InsertText(replacementFor(re, text, match, bar.replaceInput.Text(), bar.options()))
+			editor.SetTextCursor(cursor)
+			break
+		}
+	}
+	bar.find(false)
+}
+
+// replaceAll replaces every match as a single undo step
+func (bar *FindBar) replaceAll() {
+	re, text, matches, err := bar.matches()
+	if err != nil || len(matches) == 0 {
+		bar.showResult(err, matches, -1)
+		return
+	}
+
+	replacements := make([]string, len(matches))
+	for i, match := range matches {
+		replacements[i] = replacementFor(re, text, match, bar.replaceInput.Text(), bar.options())
+	}
+	editor.replaceMatches(matches, replacements)
+
+	bar.findInput.SetStyleSheet("")
+	bar.statusLabel.SetText(fmt.Sprintf("Replaced %d", len(matches)))
+}
+
+// replaceMatches replaces each match with its replacement as a single undo step
+func (e *CodeEditor) replaceMatches(matches []textMatch, replacements []string) {
+	cursor := e.TextCursor()
+	cursor.BeginEditBlock()
+	// Go backwards so the positions of earlier matches stay valid
+	for i := len(matches) - 1; i >= 0; i-- {
+		cursor.SetPosition(matches[i].start, gui.QTextCursor__MoveAnchor)
+		cursor.SetPosition(matches[i].end, gui.QTextCursor__KeepAnchor)
+		cursor.InsertText(replacements[i])
+	}
+	cursor.EndEditBlock()
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+)
+
+// isSectionDirective reports whether a directive starts a new section
+func isSectionDirective(mnemonic string) bool {
+	switch mnemonic {
+	case ".text", ".data", ".bss", ".rodata", ".section":
+		return true
+	}
+	return false
+}
+
+// foldRegions finds the foldable regions of a source text, mapping the
+// first line of each to its last (0-based, inclusive). A label folds up to
+// the next label, a section up to the next section, .macro and .rept
+// blocks up to their end, and runs of comment lines as a whole.
+func foldRegions(text string) map[int]int {
+	lines := strings.Split(text, "\n")
+	regions := make(map[int]int)
+	add := func(start, end int) {
+		// Blank lines between regions stay visible
+		for end > start && strings.TrimSpace(lines[end]) == "" {
+			end--
+		}
+		if end > start && end > regions[start] {
+			regions[start] = end
+		}
+	}
+
+	type openBlock struct {
+		line int
+		end  string
+	}
+	var blocks []openBlock
+	sectionStart, labelStart, commentStart := -1, -1, -1
+	inMacro := func() bool {
+		for _, block := range blocks {
+			if block.end == ".endm" {
+				return true
+			}
+		}
+		return false
+	}
+
+	inBlock := false
+	for i, line := range lines {
+		startsInBlock := inBlock
+		var statement asmLine
+		statement, inBlock = parseAsmLine(line, inBlock)
+		mnemonic := statement.Mnemonic()
+
+		// Runs of comment lines, including blank lines within /* */
+		if len(statement.Fields) == 0 && statement.Label == "" && (statement.Comment != "" || startsInBlock) {
+			if commentStart < 0 {
+				commentStart = i
+			}
+		} else {
+			if commentStart >= 0 {
+				add(commentStart, i-1)
+			}
+			commentStart = -1
+		}
+
+		switch mnemonic {
+		case ".macro":
+			blocks = append(blocks, openBlock{line: i, end: ".endm"})
+		case ".rept", ".irp", ".irpc":
+			blocks = append(blocks, openBlock{line: i, end: ".endr"})
+		case ".endm", ".endr":
+			for j := len(blocks) - 1; j >= 0; j-- {
+				if blocks[j].end == mnemonic {
+					add(blocks[j].line, i)
+					blocks = blocks[:j]
+					break
+				}
+			}
+		}
+		if inMacro() {
+			continue
+		}
+
+		if isSectionDirective(mnemonic) {
+			if labelStart >= 0 {
+				add(labelStart, i-1)
+				labelStart = -1
+			}
+			if sectionStart >= 0 {
+				add(sectionStart, i-1)
+			}
+			sectionStart = i
+		}
+		if statement.Label != "" {
+			if labelStart >= 0 {
+				add(labelStart, i-1)
+			}
+			labelStart = i
+		}
+	}
+
+	last := len(lines) - 1
+	for _, start := range []int{commentStart, labelStart, sectionStart} {
+		if start >= 0 {
+			add(start, last)
+		}
+	}
+	return regions
+}
+
+// foldMarkerWidth is the width of the fold marker column of the gutter
+func (e *CodeEditor) foldMarkerWidth() int {
+	return e.FontMetrics().Height()
+}
+
+// regions returns the fold regions of the document, recomputed only after
+// it changed
+func (e *CodeEditor) regions() map[int]int {
+	if revision := e.Document().Revision(); e.foldRegions == nil || revision != e.foldRevision {
+		e.foldRegions = foldRegions(e.ToPlainText())
+		e.foldRevision = revision
+	}
+	return e.foldRegions
+}
+
+// setLinesVisible shows or hides the lines from first to last
+func (e *CodeEditor) setLinesVisible(first, last int, visible bool) {
+	document := e.Document()
+	start := document.FindBlockByNumber(first)
+	if !start.IsValid() {
+		return
+	}
+	block := start
+	end := start
+	for block.IsValid() && block.BlockNumber() <= last {
+		block.SetVisible(visible)
+		if visible {
+			block.SetLineCount(max(1, block.Layout().LineCount()))
+		} else {
+			block.SetLineCount(0)
+		}
+		end = block
+		block = block.Next()
+	}
+	document.MarkContentsDirty(start.Position(), end.Position()+end.Length()-start.Position())
+	e.Viewport().Update()
+	e.lineNumberArea.Update()
+}
+
+// fold hides the region starting at line, keeping the line itself
+func (e *CodeEditor) fold(line int) {
+	end, ok := e.regions()[line]
+	if !ok || e.folds[line] {
+		return
+	}
+	e.folds[line] = true
+
+	// Keep the cursor out of the hidden lines
+	if cursorLine := e.TextCursor().BlockNumber(); cursorLine > line && cursorLine <= end {
+		cursor := e.TextCursor()
+		cursor.SetPosition(e.Document().FindBlockByNumber(line).Position(), gui.QTextCursor__MoveAnchor)
+		cursor.MovePosition(gui.QTextCursor__EndOfBlock, gui.QTextCursor__MoveAnchor, 1)
+		e.SetTextCursor(cursor)
+	}
+	e.setLinesVisible(line+1, end, false)
+}
+
+// unfold shows the region starting at line again, leaving the regions
+// folded inside it folded
+func (e *CodeEditor) unfold(line int) {
+	if !e.folds[line] {
+		return
+	}
+	delete(e.folds, line)
+	end := e.regions()[line]
+	e.setLinesVisible(line+1, end, true)
+	for inner := range e.folds {
+		if inner > line && inner <= end {
+			e.setLinesVisible(inner+1, e.regions()[inner], false)
+		}
+	}
+}
+
+// toggleFold folds or unfolds the region starting at line and remembers
+// the state for the file
+func (e *CodeEditor) toggleFold(line int) {
+	if e.folds[line] {
+		e.unfold(line)
+	} else {
+		e.fold(line)
+	}
+	e.saveFolds()
+}
+
+// foldAtCursor folds the innermost region around the cursor
+func (e *CodeEditor) foldAtCursor() {
+	cursorLine := e.TextCursor().BlockNumber()
+	best := -1
+	for start, end := range e.regions() {
+		if start <= cursorLine && cursorLine <= end && start > best && !e.folds[start] {
+			best = start
+		}
+	}
+	if best >= 0 {
+		e.fold(best)
+		e.saveFolds()
+	}
+}
+
+// unfoldAtCursor unfolds the region folded on the cursor's line
+func (e *CodeEditor) unfoldAtCursor() {
+	if line := e.TextCursor().BlockNumber(); e.folds[line] {
+		e.unfold(line)
+		e.saveFolds()
+	}
+}
+
+// foldAll folds every region, outermost first
+func (e *CodeEditor) foldAll() {
+	for start := range e.regions() {
+		e.fold(start)
+	}
+	e.saveFolds()
+}
+
+// unfoldAll shows every line again
+func (e *CodeEditor) unfoldAll() {
+	e.folds = make(map[int]bool)
+	e.setLinesVisible(0, e.Document().BlockCount()-1, true)
+	e.saveFolds()
+}
+
+// revealLine unfolds the regions hiding a line
+func (e *CodeEditor) revealLine(line int) {
+	revealed := false
+	for start := range e.folds {
+		if start < line && line <= e.regions()[start] {
+			e.unfold(start)
+			revealed = true
+		}
+	}
+	if revealed {
+		e.saveFolds()
+	}
+}
+
+// refreshFolds follows the folds after an edit: lines added or removed
+// above a fold move it, and a fold whose region went away is opened
+func (e *CodeEditor) refreshFolds() {
+	revision := e.Document().Revision()
+	if len(e.folds) == 0 || revision == e.refreshedRevision {
+		return
+	}
+	e.refreshedRevision = revision
+
+	// A fold starts at each visible line followed by hidden ones
+	regions := e.regions()
+	folds := make(map[int]bool)
+	orphaned := false
+	for block := e.Document().FirstBlock(); block.IsValid(); block = block.Next() {
+		if next := block.Next(); block.IsVisible() && next.IsValid() && !next.IsVisible() {
+			if _, ok := regions[block.BlockNumber()]; ok {
+				folds[block.BlockNumber()] = true
+			} else {
+				orphaned = true
+			}
+		}
+	}
+	if !orphaned && len(folds) == len(e.folds) {
+		changed := false
+		for line := range folds {
+			changed = changed || !e.folds[line]
+		}
+		if !changed {
+			return
+		}
+	}
+
+	// Show everything, then hide what is still folded
+	e.folds = folds
+	e.setLinesVisible(0, e.Document().BlockCount()-1, true)
+	for start := range e.folds {
+		e.setLinesVisible(start+1, regions[start], false)
+	}
+	e.saveFolds()
+}
+
+// hiddenBreakpoint reports whether a folded region starting at line hides
+// a breakpoint
+func (e *CodeEditor) hiddenBreakpoint(line int) bool {
+	if !e.folds[line] {
+		return false
+	}
+	end := e.regions()[line]
+	for breakpoint := range e.breakpoints {
+		if breakpoint > line && breakpoint <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// foldKey is how a file's folds are stored in the project settings
+func foldKey(path string) string {
+	if currentProjectPath != "" {
+		if relative, err := filepath.Rel(currentProjectPath, path); err == nil && !strings.HasPrefix(relative, "..") {
+			return filepath.ToSlash(relative)
+		}
+	}
+	return path
+}
+
+// saveFolds remembers the folded regions of the editor's file
+func (e *CodeEditor) saveFolds() {
+	if e.filePath == "" {
+		return
+	}
+	key := foldKey(e.filePath)
+	if projectSettings.Folds == nil {
+		projectSettings.Folds = make(map[string][]int)
+	}
+
+	lines := make([]int, 0, len(e.folds))
+	for line := range e.folds {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	if len(lines) == 0 {
+		delete(projectSettings.Folds, key)
+	} else {
+		projectSettings.Folds[key] = lines
+	}
+	// Without a project the folds are only kept for this session
+	SaveProjectSettings()
+}
+
+// restoreFolds folds the regions that were folded when the file was last open
+func (e *CodeEditor) restoreFolds() {
+	if e.filePath == "" {
+		return
+	}
+	for _, line := range projectSettings.Folds[foldKey(e.filePath)] {
+		e.fold(line)
+	}
+}
+
+// paintFoldMarker draws the fold marker of a line in the gutter: a box with
+// + when folded and - when it can be folded, in red when the fold hides a
+// breakpoint
+func (e *CodeEditor) paintFoldMarker(painter *gui.QPainter, line, top, height int) {
+	if _, ok := e.regions()[line]; !ok {
+		return
+	}
+
+	color := gui.NewQColor6(activeTheme.Gutter.FoldMarker)
+	if e.hiddenBreakpoint(line) {
+		color = gui.NewQColor6(activeTheme.Gutter.Breakpoint)
+	}
+	pen := gui.NewQPen()
+	pen.SetColor(color)
+	painter.SetPen(pen)
+	painter.SetBrush2(core.Qt__NoBrush)
+
+	size := height / 2
+	x := e.lineNumberArea.Width() - e.foldMarkerWidth() + (e.foldMarkerWidth()-size)/2
+	y := top + (height-size)/2
+	painter.DrawRect2(x, y, size, size)
+	painter.DrawLine3(x+2, y+size/2, x+size-2, y+size/2)
+	if e.folds[line] {
+		painter.DrawLine3(x+size/2, y+2, x+size/2, y+size-2)
+	}
+}
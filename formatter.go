@@ -0,0 +1,258 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/therecipe/qt/gui"
+)
+
+// FormatterSettings control how Format Document lays out assembly. They
+// are set in the preferences and can be overridden per project.
+type FormatterSettings struct {
+	MnemonicColumn int    `json:"mnemonicColumn"` // Column of mnemonics and directives
+	OperandColumn  int    `json:"operandColumn"`  // 0 puts operands one space after the mnemonic
+	CommentColumn  int    `json:"commentColumn"`  // 0 puts comments one space after the code
+	RegisterNames  string `json:"registerNames"`  // "abi", "x" or "" to keep them as written
+	HexDigits      string `json:"hexDigits"`      // "lower", "upper" or "" to keep them as written
+	FormatOnSave   bool   `json:"formatOnSave"`
+}
+
+// Register name styles
+const (
+	registerNamesABI = "abi"
+	registerNamesX   = "x"
+)
+
+// defaultFormatterSettings aligns to the usual 8 column tab stops
+func defaultFormatterSettings() FormatterSettings {
+	return FormatterSettings{
+		MnemonicColumn: 8,
+		OperandColumn:  16,
+		CommentColumn:  40,
+	}
+}
+
+// formatterSettings returns the project's formatter settings if it has
+// any, otherwise the user's
+func formatterSettings() FormatterSettings {
+	if projectSettings.Formatter != nil {
+		return *projectSettings.Formatter
+	}
+	return userFormatterSettings()
+}
+
+// userFormatterSettings returns the formatter settings of the preferences,
+// the defaults until the user changes them
+func userFormatterSettings() FormatterSettings {
+	if preferences.Formatter == nil {
+		return defaultFormatterSettings()
+	}
+	return *preferences.Formatter
+}
+
+var (
+	reHexLiteral    = regexp.MustCompile(`^0[xX][0-9a-fA-F]+$`)
+	reBinaryLiteral = regexp.MustCompile(`^0[bB][01]+$`)
+)
+
+// splitOperands splits an operand list at the commas that are not inside
+// strings, character literals or parentheses
+func splitOperands(text string) []string {
+	var operands []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			operands = append(operands, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(text[start:]); rest != "" || len(operands) > 0 {
+		operands = append(operands, rest)
+	}
+	return operands
+}
+
+// formatAssembly lays out every line: labels at column 0, mnemonics,
+// operands and comments at the configured columns
+func formatAssembly(text string, settings FormatterSettings) string {
+	lines := strings.Split(text, "\n")
+	inBlock := false
+	for i, line := range lines {
+		lines[i], inBlock = formatLine(line, inBlock, settings)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// padTo pads a line to a column, or adds one space if it is already there
+func padTo(builder *strings.Builder, column int) {
+	width := utf8.RuneCountInString(builder.String())
+	if width < column {
+		builder.WriteString(strings.Repeat(" ", column-width))
+	} else if width > 0 {
+		builder.WriteString(" ")
+	}
+}
+
+// formatLine formats a single source line, given whether it starts inside
+// a /* */ comment, and returns whether it ends inside one. Lines touching
+// block comments are left as written.
+func formatLine(line string, inBlock bool, settings FormatterSettings) (string, bool) {
+	code, comment, endsInBlock := stripComment(line, inBlock)
+	if inBlock || endsInBlock || strings.Contains(comment, "/*") {
+		return line, endsInBlock
+	}
+	code = strings.TrimSpace(code)
+	comment = strings.TrimSpace(comment)
+
+	// Comments on their own stay at column 0 or move to the mnemonics
+	if code == "" {
+		if comment == "" {
+			return "", false
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return strings.Repeat(" ", settings.MnemonicColumn) + comment, false
+		}
+		return comment, false
+	}
+
+	var builder strings.Builder
+	if colon := strings.Index(code, ":"); colon > 0 && isSymbolName(strings.TrimSpace(code[:colon])) {
+		builder.WriteString(strings.TrimSpace(code[:colon]) + ":")
+		code = strings.TrimSpace(code[colon+1:])
+	}
+
+	if code != "" {
+		padTo(&builder, settings.MnemonicColumn)
+		mnemonic := strings.Fields(code)[0]
+		builder.WriteString(mnemonic)
+		if operands := splitOperands(strings.TrimSpace(code[len(mnemonic):])); len(operands) > 0 {
+			for i, operand := range operands {
+				operands[i] = normaliseOperand(operand, isInstruction(mnemonic), settings)
+			}
+			padTo(&builder, settings.OperandColumn)
+			builder.WriteString(strings.Join(operands, ", "))
+		}
+	}
+
+	if comment != "" {
+		padTo(&builder, settings.CommentColumn)
+		builder.WriteString(comment)
+	}
+	return builder.String(), false
+}
+
+// normaliseOperand rewrites the register names and number literals of an
+// operand, leaving strings and character literals alone
+func normaliseOperand(operand string, registers bool, settings FormatterSettings) string {
+	var builder strings.Builder
+	var quote byte
+	for i := 0; i < len(operand); {
+		c := operand[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(operand) {
+				builder.WriteByte(c)
+				i++
+				c = operand[i]
+			} else if c == quote {
+				quote = 0
+			}
+			builder.WriteByte(c)
+			i++
+		case c == '"' || c == '\'':
+			quote = c
+			builder.WriteByte(c)
+			i++
+		case isSymbolChar(c):
+			end := i
+			for end < len(operand) && isSymbolChar(operand[end]) {
+				end++
+			}
+			builder.WriteString(normaliseWord(operand[i:end], registers, settings))
+			i = end
+		case c == ' ' || c == '\t':
+			// No spaces just inside parentheses: 8(sp), not 8( sp )
+			written := builder.String()
+			next := strings.TrimLeft(operand[i:], " \t")
+			if !strings.HasSuffix(written, "(") && !strings.HasPrefix(next, ")") {
+				builder.WriteByte(c)
+			}
+			i++
+		default:
+			builder.WriteByte(c)
+			i++
+		}
+	}
+	return builder.String()
+}
+
+// normaliseWord rewrites a single register name or number literal
+func normaliseWord(word string, registers bool, settings FormatterSettings) string {
+	switch {
+	case reHexLiteral.MatchString(word):
+		digits := word[2:]
+		switch settings.HexDigits {
+		case "lower":
+			digits = strings.ToLower(digits)
+		case "upper":
+			digits = strings.ToUpper(digits)
+		}
+		return "0x" + digits
+	case reBinaryLiteral.MatchString(word):
+		return "0b" + word[2:]
+	case registers && !strings.HasPrefix(word, "$"):
+		number, ok := registerNumber(word)
+		if !ok || number == registerPC {
+			return word
+		}
+		switch settings.RegisterNames {
+		case registerNamesABI:
+			if word != "fp" {
+				return abiRegisterNames[number]
+			}
+		case registerNamesX:
+			return "x" + strconv.Itoa(number)
+		}
+	}
+	return word
+}
+
+// formatDocument formats the active editor's text as one undo step,
+// changing only the lines that need it so the cursor and breakpoints stay
+func formatDocument(e *CodeEditor) {
+	settings := formatterSettings()
+	document := e.Document()
+	cursor := e.TextCursor()
+	cursor.BeginEditBlock()
+	inBlock := false
+	for block := document.FirstBlock(); block.IsValid(); block = block.Next() {
+		text := block.Text()
+		var formatted string
+		formatted, inBlock = formatLine(text, inBlock, settings)
+		if formatted == text {
+			continue
+		}
+		cursor.SetPosition(block.Position(), gui.QTextCursor__MoveAnchor)
+		cursor.MovePosition(gui.QTextCursor__EndOfBlock, gui.QTextCursor__KeepAnchor, 1)
+		cursor.InsertText(formatted)
+	}
+	cursor.EndEditBlock()
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	assembler "github.com/RISC-GoV/risc-assembler"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// instructionFormats names the encoding formats in the order the
+// assembler numbers its instruction types
+var instructionFormats = [...]string{"R", "I", "S", "B", "U", "J"}
+
+// instructionFormat returns the format the assembler encodes a base
+// instruction in, or "" if it is not a base instruction
+func instructionFormat(mnemonic string) string {
+	opType, ok := assembler.InstructionToOpType[mnemonic]
+	if !ok || int(opType) < 0 || int(opType) >= len(instructionFormats) {
+		return ""
+	}
+	return instructionFormats[int(opType)]
+}
+
+// instructionSemantics explains what each instruction of RV32I, Zicsr and
+// RV32M does
+var instructionSemantics = map[string]string{
+	"lui":   "rd = imm << 12",
+	"auipc": "rd = pc + (imm << 12)",
+	"jal":   "rd = pc + 4; pc += offset",
+	"jalr":  "rd = pc + 4; pc = (rs1 + offset) & ~1",
+
+	"beq":  "if (rs1 == rs2) pc += offset",
+	"bne":  "if (rs1 != rs2) pc += offset",
+	"blt":  "if (rs1 < rs2, signed) pc += offset",
+	"bge":  "if (rs1 >= rs2, signed) pc += offset",
+	"bltu": "if (rs1 < rs2, unsigned) pc += offset",
+	"bgeu": "if (rs1 >= rs2, unsigned) pc += offset",
+
+	"lb":  "rd = sext(M[rs1 + offset][7:0])",
+	"lh":  "rd = sext(M[rs1 + offset][15:0])",
+	"lw":  "rd = M[rs1 + offset][31:0]",
+	"lbu": "rd = zext(M[rs1 + offset][7:0])",
+	"lhu": "rd = zext(M[rs1 + offset][15:0])",
+	"sb":  "M[rs1 + offset] = rs2[7:0]",
+	"sh":  "M[rs1 + offset] = rs2[15:0]",
+	"sw":  "M[rs1 + offset] = rs2[31:0]",
+
+	"addi":  "rd = rs1 + imm",
+	"slti":  "rd = (rs1 < imm, signed) ? 1 : 0",
+	"sltiu": "rd = (rs1 < imm, unsigned) ? 1 : 0",
+	"xori":  "rd = rs1 ^ imm",
+	"ori":   "rd = rs1 | imm",
+	"andi":  "rd = rs1 & imm",
+	"slli":  "rd = rs1 << shamt",
+	"srli":  "rd = rs1 >> shamt (logical)",
+	"srai":  "rd = rs1 >> shamt (arithmetic)",
+
+	"add":  "rd = rs1 + rs2",
+	"sub":  "rd = rs1 - rs2",
+	"sll":  "rd = rs1 << rs2[4:0]",
+	"slt":  "rd = (rs1 < rs2, signed) ? 1 : 0",
+	"sltu": "rd = (rs1 < rs2, unsigned) ? 1 : 0",
+	"xor":  "rd = rs1 ^ rs2",
+	"srl":  "rd = rs1 >> rs2[4:0] (logical)",
+	"sra":  "rd = rs1 >> rs2[4:0] (arithmetic)",
+	"or":   "rd = rs1 | rs2",
+	"and":  "rd = rs1 & rs2",
+
+	"fence":   "Order memory accesses before and after the fence",
+	"fence.i": "Synchronise the instruction and data streams",
+	"ecall":   "Request a service from the environment, a7 selects it",
+	"ebreak":  "Transfer control to the debugger",
+
+	"csrrw":  "t = CSR; CSR = rs1; rd = t",
+	"csrrs":  "t = CSR; CSR = t | rs1; rd = t",
+	"csrrc":  "t = CSR; CSR = t & ~rs1; rd = t",
+	"csrrwi": "rd = CSR; CSR = uimm",
+	"csrrsi": "t = CSR; CSR = t | uimm; rd = t",
+	"csrrci": "t = CSR; CSR = t & ~uimm; rd = t",
+
+	"mul":    "rd = (rs1 * rs2)[31:0]",
+	"mulh":   "rd = (rs1 * rs2, signed × signed)[63:32]",
+	"mulhsu": "rd = (rs1 * rs2, signed × unsigned)[63:32]",
+	"mulhu":  "rd = (rs1 * rs2, unsigned × unsigned)[63:32]",
+	"div":    "rd = rs1 / rs2 (signed)",
+	"divu":   "rd = rs1 / rs2 (unsigned)",
+	"rem":    "rd = rs1 % rs2 (signed)",
+	"remu":   "rd = rs1 % rs2 (unsigned)",
+}
+
+// pseudoSemantics explains what each pseudo-instruction does
+var pseudoSemantics = map[string]string{
+	"nop": "Do nothing", "li": "rd = imm", "la": "rd = address of symbol", "mv": "rd = rs",
+	"not": "rd = ~rs", "neg": "rd = -rs", "seqz": "rd = (rs == 0) ? 1 : 0", "snez": "rd = (rs != 0) ? 1 : 0",
+	"sltz": "rd = (rs < 0) ? 1 : 0", "sgtz": "rd = (rs > 0) ? 1 : 0",
+	"beqz": "if (rs == 0) goto label", "bnez": "if (rs != 0) goto label", "blez": "if (rs <= 0) goto label",
+	"bgez": "if (rs >= 0) goto label", "bltz": "if (rs < 0) goto label", "bgtz": "if (rs > 0) goto label",
+	"bgt": "if (rs > rt, signed) goto label", "ble": "if (rs <= rt, signed) goto label",
+	"bgtu": "if (rs > rt, unsigned) goto label", "bleu": "if (rs <= rt, unsigned) goto label",
+	"j": "goto label", "jr": "pc = rs", "ret": "Return: pc = ra",
+	"call": "ra = pc + 4; goto symbol", "tail": "goto symbol without saving a return address",
+}
+
+// immediateRanges is the range of the immediate of each instruction format
+var immediateRanges = map[string]string{
+	"I": "-2048 to 2047 (12-bit signed)",
+	"S": "-2048 to 2047 (12-bit signed)",
+	"B": "-4096 to 4094, even (13-bit signed offset)",
+	"U": "0 to 1048575 (20-bit upper immediate)",
+	"J": "-1048576 to 1048574, even (21-bit signed offset)",
+}
+
+// encodingLayouts shows the fields of each format from bit 31 down to bit 0
+var encodingLayouts = map[string]string{
+	"R": "funct7 | rs2 | rs1 | funct3 | rd | opcode",
+	"I": "imm[11:0] | rs1 | funct3 | rd | opcode",
+	"S": "imm[11:5] | rs2 | rs1 | funct3 | imm[4:0] | opcode",
+	"B": "imm[12|10:5] | rs2 | rs1 | funct3 | imm[4:1|11] | opcode",
+	"U": "imm[31:12] | rd | opcode",
+	"J": "imm[20|10:1|11|19:12] | rd | opcode",
+}
+
+// immediateRange returns the allowed immediate values of an instruction
+func immediateRange(mnemonic, format string) string {
+	switch mnemonic {
+	case "slli", "srli", "srai":
+		return "shamt 0 to 31"
+	case "csrrw", "csrrs", "csrrc":
+		return "csr 0 to 4095"
+	case "csrrwi", "csrrsi", "csrrci":
+		return "csr 0 to 4095, uimm 0 to 31"
+	case "ecall", "ebreak", "fence", "fence.i":
+		return ""
+	}
+	return immediateRanges[format]
+}
+
+// pseudoExpansion asks the assembler how a pseudo-instruction expands,
+// using the operand names of its signature as placeholders
+func pseudoExpansion(mnemonic string) (lines []string) {
+	expand, ok := assembler.PseudoToInstruction[mnemonic]
+	if !ok {
+		return nil
+	}
+
+	// Some expansions parse their operands, try symbolic names first and
+	// small numbers after that
+	for _, numeric := range []bool{false, true} {
+		fields := []string{mnemonic}
+		for _, operand := range operandNames(instructionSignatures[mnemonic]) {
+			if numeric && (operand == "imm" || operand == "offset") {
+				operand = "1"
+			}
+			fields = append(fields, operand)
+		}
+
+		lines = tryExpand(expand, fields)
+		if len(lines) > 0 {
+			return lines
+		}
+	}
+	return nil
+}
+
+// tryExpand runs an expansion, treating a panic as no expansion
+func tryExpand[T any](expand func([]string) []T, fields []string) (lines []string) {
+	defer func() {
+		if recover() != nil {
+			lines = nil
+		}
+	}()
+	for _, instruction := range expand(fields) {
+		lines = append(lines, formatInstruction(instruction))
+	}
+	return lines
+}
+
+// formatInstruction prints one instruction of an expansion
+func formatInstruction(instruction any) string {
+	switch parts := instruction.(type) {
+	case []string:
+		if len(parts) == 0 {
+			return ""
+		}
+		return parts[0] + " " + strings.Join(parts[1:], ", ")
+	case string:
+		return parts
+	}
+	return fmt.Sprint(instruction)
+}
+
+// helpMarkup renders instruction help as Qt rich text or as Markdown
+type helpMarkup struct {
+	bold      func(string) string
+	code      func(string) string
+	text      func(string) string
+	lineBreak string
+	indent    string
+}
+
+var richTextHelp = helpMarkup{
+	bold:      func(s string) string { return "<b>" + html.EscapeString(s) + "</b>" },
+	code:      func(s string) string { return "<tt>" + html.EscapeString(s) + "</tt>" },
+	text:      html.EscapeString,
+	lineBreak: "<br>",
+	indent:    "&nbsp;&nbsp;",
+}
+
+var markdownHelp = helpMarkup{
+	bold:      func(s string) string { return "**" + markdownEscaper.Replace(s) + "**" },
+	code:      func(s string) string { return "`" + s + "`" },
+	text:      markdownEscaper.Replace,
+	lineBreak: "  \n",
+}
+
+// markdownEscaper escapes the characters Markdown would treat as formatting
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`)
+
+// instructionHelp describes a mnemonic as rich text for a tooltip, or
+// returns "" if the assembler does not know it
+func instructionHelp(mnemonic string) string {
+	return formatInstructionHelp(mnemonic, richTextHelp)
+}
+
+// formatInstructionHelp describes a mnemonic in the given markup
+func formatInstructionHelp(mnemonic string, m helpMarkup) string {
+	if !isInstruction(mnemonic) {
+		return ""
+	}
+
+	var text strings.Builder
+	text.WriteString(m.bold(mnemonic))
+	if signature := instructionSignatures[mnemonic]; signature != "" {
+		text.WriteString(" " + m.text(signature))
+	}
+
+	if format := instructionFormat(mnemonic); format != "" {
+		fmt.Fprintf(&text, "%s%s-type: %s", m.lineBreak, format, m.text(instructionSemantics[mnemonic]))
+		if immediate := immediateRange(mnemonic, format); immediate != "" {
+			fmt.Fprintf(&text, "%sImmediate: %s", m.lineBreak, m.text(immediate))
+		}
+		fmt.Fprintf(&text, "%sEncoding: %s", m.lineBreak, m.code(encodingLayouts[format]))
+	}
+
+	if _, isPseudo := assembler.PseudoToInstruction[mnemonic]; isPseudo {
+		text.WriteString(m.lineBreak + "Pseudo-instruction")
+		if semantics := pseudoSemantics[mnemonic]; semantics != "" {
+			fmt.Fprintf(&text, ": %s", m.text(semantics))
+		}
+		if expansion := pseudoExpansion(mnemonic); len(expansion) > 0 {
+			text.WriteString(m.lineBreak + "Expands to:")
+			for _, line := range expansion {
+				text.WriteString(m.lineBreak + m.indent + m.code(line))
+			}
+		}
+	}
+	return text.String()
+}
+
+// wordAt returns the mnemonic-like word around a column of a line, which
+// starts inside a /* */ comment if inBlock is set, and whether it is the
+// statement's mnemonic
+func wordAt(line string, column int, inBlock bool) (string, bool) {
+	if column > len(line) {
+		return "", false
+	}
+	start, end := column, column
+	for start > 0 && isSymbolChar(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isSymbolChar(line[end]) {
+		end++
+	}
+	if start == end {
+		return "", false
+	}
+
+	code, _, _ := stripComment(line, inBlock)
+	mnemonic, at := mnemonicStart(code)
+	return line[start:end], mnemonic != "" && start == at && end == at+len(mnemonic)
+}
+
+// mnemonicStart finds the mnemonic of a statement and its byte offset,
+// skipping a label in front of it
+func mnemonicStart(code string) (string, int) {
+	offset := 0
+	if colon := strings.Index(code, ":"); colon > 0 && isSymbolName(strings.TrimSpace(code[:colon])) {
+		offset = colon + 1
+	}
+	fields := strings.Fields(code[offset:])
+	if len(fields) == 0 {
+		return "", -1
+	}
+	return fields[0], offset + strings.Index(code[offset:], fields[0])
+}
+
+// viewportEvent shows instruction help when the mouse rests on a mnemonic
+func (e *CodeEditor) viewportEvent(event *core.QEvent) bool {
+	if event.Type() != core.QEvent__ToolTip {
+		return e.ViewportEventDefault(event)
+	}
+
+	help := gui.NewQHelpEventFromPointer(event.Pointer())
+	cursor := e.CursorForPosition(help.Pos())
+	line := cursor.Block().Text()
+	column := len(string([]rune(line)[:min(cursor.PositionInBlock(), len([]rune(line)))]))
+
+	if word, isMnemonic := wordAt(line, column, startsInBlockComment(cursor.Block())); isMnemonic {
+		if text := instructionHelp(word); text != "" {
+			widgets.QToolTip_ShowText2(help.GlobalPos(), text, e.Viewport())
+			return true
+		}
+	}
+	widgets.QToolTip_HideText()
+	event.Ignore()
+	return true
+}
+
+// updateSignatureHelp shows the operands of the instruction being typed,
+// with the current operand underlined
+func (e *CodeEditor) updateSignatureHelp() {
+	cursor := e.TextCursor()
+	block := cursor.Block().Text()
+	before := string([]rune(block)[:min(cursor.PositionInBlock(), len([]rune(block)))])
+
+	// A shorter code means the cursor is in a comment
+	code, _, _ := stripComment(before, startsInBlockComment(cursor.Block()))
+	mnemonic, at := mnemonicStart(code)
+	signature, known := instructionSignatures[mnemonic]
+	operands := operandNames(signature)
+	if len(code) < len(before) || !known || len(operands) == 0 || !isInstruction(mnemonic) ||
+		!strings.ContainsAny(code[at+len(mnemonic):], " \t") {
+		e.signatureLabel.Hide()
+		return
+	}
+
+	index := strings.Count(code[at:], ",")
+	parts := make([]string, len(operands))
+	for i, operand := range operands {
+		parts[i] = html.EscapeString(operand)
+		if i == index {
+			parts[i] = "<u><b>" + parts[i] + "</b></u>"
+		}
+	}
+	text := fmt.Sprintf("<b>%s</b> %s", html.EscapeString(mnemonic), strings.Join(parts, ", "))
+	if semantics := instructionSemantics[mnemonic]; semantics != "" {
+		text += " &nbsp; " + html.EscapeString(semantics)
+	} else if semantics := pseudoSemantics[mnemonic]; semantics != "" {
+		text += " &nbsp; " + html.EscapeString(semantics)
+	}
+	e.signatureLabel.SetText(text)
+	e.signatureLabel.AdjustSize()
+
+	// Show it just above the line being edited
+	rect := e.CursorRect(cursor)
+	position := e.Viewport().MapToGlobal(rect.TopLeft())
+	e.signatureLabel.Move2(position.X(), position.Y()-e.signatureLabel.Height()-2)
+	e.signatureLabel.Show()
+}
+
+// setupInstructionHelp creates the hover and signature help of the editor
+func (e *CodeEditor) setupInstructionHelp() {
+	e.signatureLabel = widgets.NewQLabel(e, core.Qt__ToolTip)
+	e.signatureLabel.SetTextFormat(core.Qt__RichText)
+	e.signatureLabel.SetMargin(3)
+	e.signatureLabel.SetStyleSheet("QLabel { border: 1px solid palette(mid); background: palette(tool-tip-base); color: palette(tool-tip-text); }")
+	e.signatureLabel.Hide()
+
+	e.ConnectViewportEvent(e.viewportEvent)
+	e.ConnectFocusOutEvent(func(event *gui.QFocusEvent) {
+		e.signatureLabel.Hide()
+		e.FocusOutEventDefault(event)
+	})
+}
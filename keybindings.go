@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// KeybindingSettings choose the keys commands are bound to: a preset, with
+// the user's own changes on top
+type KeybindingSettings struct {
+	Preset    string            `json:"preset,omitempty"`    // Empty is the default bindings
+	Overrides map[string]string `json:"overrides,omitempty"` // By command id, "" unbinds the command
+}
+
+// keybindingPresetNames lists the presets in the order they are offered
+var keybindingPresetNames = []string{"Default", "VS Code", "Emacs"}
+
+// keybindingPresets change the default bindings to those of other editors.
+// Commands a preset leaves out keep their default binding.
+var keybindingPresets = map[string]map[string]string{
+	"VS Code": {
+		"run.assemble":        "Ctrl+Shift+B",
+		"run.run":             "Ctrl+F5",
+		"run.debug":           "F5",
+		"run.exportArtifacts": "",
+		"debug.continue":      "F8",
+		"debug.stop":          "Shift+F5",
+		"debug.hotReload":     "Ctrl+Shift+F5",
+		"debug.step":          "F10",
+		"edit.redo":           "Ctrl+Shift+Z",
+	},
+	// Qt reports the Shift of shifted punctuation, so C-? is Ctrl+Shift+?
+	"Emacs": {
+		"file.new":            "",
+		"file.open":           "Ctrl+X, Ctrl+F",
+		"file.save":           "Ctrl+X, Ctrl+S",
+		"file.saveAs":         "Ctrl+X, Ctrl+W",
+		"file.closeTab":       "Ctrl+X, K",
+		"file.exit":           "Ctrl+X, Ctrl+C",
+		"edit.undo":           "Ctrl+/",
+		"edit.redo":           "Ctrl+Shift+?",
+		"edit.cut":            "Ctrl+W",
+		"edit.copy":           "Alt+W",
+		"edit.paste":          "Ctrl+Y",
+		"edit.find":           "Ctrl+S",
+		"edit.findPrevious":   "Ctrl+R",
+		"edit.replace":        "Alt+Shift+%",
+		"edit.goToDefinition": "Alt+.",
+		"edit.findReferences": "Alt+Shift+?",
+		"edit.goToLine":       "Alt+G, G",
+		"edit.commandPalette": "Alt+X",
+		"run.assemble":        "Ctrl+C, Ctrl+C",
+		"run.run":             "Ctrl+C, Ctrl+R",
+		"run.debug":           "Ctrl+C, Ctrl+D",
+	},
+}
+
+// presetBinding is a command's binding in a preset, before the user's changes
+func (s KeybindingSettings) presetBinding(c *command) string {
+	if key, ok := keybindingPresets[s.Preset][c.id]; ok {
+		return key
+	}
+	return c.shortcut
+}
+
+// binding is the key a command is bound to
+func (s KeybindingSettings) binding(c *command) string {
+	if key, ok := s.Overrides[c.id]; ok {
+		return key
+	}
+	return s.presetBinding(c)
+}
+
+// bind changes a command's binding, forgetting the change if it matches
+// the preset again
+func (s *KeybindingSettings) bind(c *command, key string) {
+	if key == normalizeKeySequence(s.presetBinding(c)) {
+		delete(s.Overrides, c.id)
+		return
+	}
+	if s.Overrides == nil {
+		s.Overrides = make(map[string]string)
+	}
+	s.Overrides[c.id] = key
+}
+
+// conflicts lists the other commands whose binding clashes with a key
+func (s KeybindingSettings) conflicts(c *command, key string) []*command {
+	var clashes []*command
+	for _, other := range commands {
+		if other != c && keybindingConflict(key, normalizeKeySequence(s.binding(other))) {
+			clashes = append(clashes, other)
+		}
+	}
+	return clashes
+}
+
+func SetKeybindings(settings KeybindingSettings) {
+	preferences.Keybindings = settings
+	SavePreferences()
+	applyKeybindings()
+}
+
+// commandLabel names a command with its category, as in "File: Save"
+func commandLabel(c *command) string {
+	return c.category + ": " + c.title
+}
+
+// editedKeybindings are the bindings being changed in the preferences dialog
+var editedKeybindings KeybindingSettings
+
+func createKeybindingsSettingsTab() *widgets.QWidget {
+	tab := widgets.NewQWidget(nil, 0)
+	layout := widgets.NewQVBoxLayout()
+	tab.SetLayout(layout)
+
+	// Start from a copy so Cancel leaves the preferences untouched
+	editedKeybindings = KeybindingSettings{Preset: preferences.Keybindings.Preset, Overrides: make(map[string]string)}
+	for id, key := range preferences.Keybindings.Overrides {
+		editedKeybindings.Overrides[id] = key
+	}
+
+	// Preset and filter
+	topLayout := widgets.NewQFormLayout(nil)
+	presetCombo := widgets.NewQComboBox(nil)
+	presetCombo.AddItems(keybindingPresetNames)
+	for i, name := range keybindingPresetNames {
+		if name == editedKeybindings.Preset {
+			presetCombo.SetCurrentIndex(i)
+		}
+	}
+	topLayout.AddRow3("Preset:", presetCombo)
+	filterEdit := widgets.NewQLineEdit(nil)
+	filterEdit.SetPlaceholderText("Filter by command or key")
+	topLayout.AddRow3("Filter:", filterEdit)
+	layout.AddLayout(topLayout, 0)
+
+	table := widgets.NewQTableWidget(nil)
+	table.SetColumnCount(2)
+	table.SetRowCount(len(commands))
+	table.SetHorizontalHeaderLabels([]string{"Command", "Shortcut"})
+	table.VerticalHeader().SetVisible(false)
+	table.HorizontalHeader().SetStretchLastSection(true)
+	table.SetEditTriggers(widgets.QAbstractItemView__NoEditTriggers)
+	table.SetSelectionBehavior(widgets.QAbstractItemView__SelectRows)
+	table.SetSelectionMode(widgets.QAbstractItemView__SingleSelection)
+	layout.AddWidget(table, 1, 0)
+
+	// Recording a new key for the selected command
+	keyLayout := widgets.NewQHBoxLayout()
+	keyEdit := widgets.NewQKeySequenceEdit(nil)
+	assignButton := widgets.NewQPushButton2("Assign", nil)
+	removeButton := widgets.NewQPushButton2("Remove", nil)
+	resetButton := widgets.NewQPushButton2("Reset", nil)
+	resetAllButton := widgets.NewQPushButton2("Reset All to Preset", nil)
+	keyLayout.AddWidget(keyEdit, 1, 0)
+	keyLayout.AddWidget(assignButton, 0, 0)
+	keyLayout.AddWidget(removeButton, 0, 0)
+	keyLayout.AddWidget(resetButton, 0, 0)
+	keyLayout.AddStretch(1)
+	keyLayout.AddWidget(resetAllButton, 0, 0)
+	layout.AddLayout(keyLayout, 0)
+
+	conflictLabel := widgets.NewQLabel2("", nil, 0)
+	conflictLabel.SetWordWrap(true)
+	layout.AddWidget(conflictLabel, 0, 0)
+
+	showBindings := func() {
+		conflicting := 0
+		for i, c := range commands {
+			key := normalizeKeySequence(editedKeybindings.binding(c))
+			table.SetItem(i, 0, widgets.NewQTableWidgetItem2(commandLabel(c), 0))
+			keyItem := widgets.NewQTableWidgetItem2(key, 0)
+			if clashes := editedKeybindings.conflicts(c, key); len(clashes) > 0 {
+				conflicting++
+				var names []string
+				for _, other := range clashes {
+					names = append(names, commandLabel(other))
+				}
+				keyItem.SetBackground(gui.NewQBrush3(gui.NewQColor6(activeTheme.Colors["errorBackground"]), core.Qt__SolidPattern))
+				keyItem.SetToolTip("Conflicts with " + strings.Join(names, ", "))
+			}
+			if _, ok := editedKeybindings.Overrides[c.id]; ok {
+				font := keyItem.Font()
+				font.SetBold(true)
+				keyItem.SetFont(font)
+			}
+			table.SetItem(i, 1, keyItem)
+		}
+		table.ResizeColumnToContents(0)
+		if conflicting > 0 {
+			conflictLabel.SetText(fmt.Sprintf("%d commands have conflicting shortcuts, only one of each can be used.", conflicting))
+		} else {
+			conflictLabel.SetText("")
+		}
+	}
+
+	filterBindings := func() {
+		filter := strings.ToLower(strings.TrimSpace(filterEdit.Text()))
+		for i := range commands {
+			text := strings.ToLower(table.Item(i, 0).Text() + " " + table.Item(i, 1).Text())
+			table.SetRowHidden(i, filter != "" && !strings.Contains(text, filter))
+		}
+	}
+
+	selectedCommand := func() *command {
+		row := table.CurrentRow()
+		if row < 0 || row >= len(commands) {
+			return nil
+		}
+		return commands[row]
+	}
+
+	// Warn about conflicts as a key is recorded, before it is assigned
+	keyEdit.ConnectKeySequenceChanged(func(sequence *gui.QKeySequence) {
+		c := selectedCommand()
+		key := sequence.ToString(gui.QKeySequence__PortableText)
+		if c == nil || key == "" {
+			return
+		}
+		if clashes := editedKeybindings.conflicts(c, key); len(clashes) > 0 {
+			conflictLabel.SetText(fmt.Sprintf("%s is already used by %s.", key, commandLabel(clashes[0])))
+		} else {
+			conflictLabel.SetText("")
+		}
+	})
+
+	table.ConnectCurrentCellChanged(func(row, column, previousRow, previousColumn int) {
+		if c := selectedCommand(); c != nil {
+			keyEdit.SetKeySequence(gui.NewQKeySequence2(editedKeybindings.binding(c), gui.QKeySequence__PortableText))
+		}
+	})
+
+	rebind := func(change func(c *command)) {
+		c := selectedCommand()
+		if c == nil {
+			return
+		}
+		row := table.CurrentRow()
+		change(c)
+		showBindings()
+		filterBindings()
+		table.SelectRow(row)
+	}
+
+	assignButton.ConnectClicked(func(bool) {
+		rebind(func(c *command) {
+			editedKeybindings.bind(c, keyEdit.KeySequence().ToString(gui.QKeySequence__PortableText))
+		})
+	})
+	removeButton.ConnectClicked(func(bool) {
+		rebind(func(c *command) {
+			editedKeybindings.bind(c, "")
+			keyEdit.Clear()
+		})
+	})
+	resetButton.ConnectClicked(func(bool) {
+		rebind(func(c *command) {
+			delete(editedKeybindings.Overrides, c.id)
+			keyEdit.SetKeySequence(gui.NewQKeySequence2(editedKeybindings.binding(c), gui.QKeySequence__PortableText))
+		})
+	})
+	resetAllButton.ConnectClicked(func(bool) {
+		editedKeybindings.Overrides = nil
+		showBindings()
+		filterBindings()
+	})
+
+	// Switching presets starts over from the preset's bindings
+	presetCombo.ConnectCurrentIndexChanged(func(index int) {
+		editedKeybindings = KeybindingSettings{}
+		if index > 0 {
+			editedKeybindings.Preset = keybindingPresetNames[index]
+		}
+		showBindings()
+		filterBindings()
+	})
+
+	filterEdit.ConnectTextChanged(func(string) { filterBindings() })
+
+	showBindings()
+	return tab
+}
@@ -0,0 +1,678 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	assembler "github.com/RISC-GoV/risc-assembler"
+)
+
+// The language server speaks JSON-RPC over stdio as described by the
+// Language Server Protocol. Positions are UTF-16 offsets, like Qt's.
+
+// lspDocument is a file open in the client
+type lspDocument struct {
+	uri  string
+	path string
+	text string
+}
+
+// lspDocuments holds the documents open in the client by path, it is nil
+// when the IDE runs with its own editor
+var lspDocuments map[string]*lspDocument
+
+// lspDocumentList returns the open documents sorted by path
+func lspDocumentList() []*lspDocument {
+	documents := make([]*lspDocument, 0, len(lspDocuments))
+	for _, document := range lspDocuments {
+		documents = append(documents, document)
+	}
+	sort.Slice(documents, func(i, j int) bool { return documents[i].path < documents[j].path })
+	return documents
+}
+
+type lspMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *lspError       `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes
+const (
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+)
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+// Diagnostic severities
+const (
+	lspSeverityError   = 1
+	lspSeverityWarning = 2
+)
+
+type lspCompletionItem struct {
+	Label    string       `json:"label"`
+	Kind     int          `json:"kind"`
+	Detail   string       `json:"detail,omitempty"`
+	TextEdit *lspTextEdit `json:"textEdit,omitempty"`
+}
+
+// Completion item kinds
+const (
+	lspCompletionVariable  = 6
+	lspCompletionKeyword   = 14
+	lspCompletionReference = 18
+)
+
+type lspDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Detail         string              `json:"detail,omitempty"`
+	Kind           int                 `json:"kind"`
+	Range          lspRange            `json:"range"`
+	SelectionRange lspRange            `json:"selectionRange"`
+	Children       []lspDocumentSymbol `json:"children,omitempty"`
+}
+
+// Symbol kinds
+const (
+	lspSymbolNamespace = 3
+	lspSymbolMethod    = 6
+	lspSymbolFunction  = 12
+	lspSymbolVariable  = 13
+	lspSymbolConstant  = 14
+)
+
+// languageServer serves one client over a pair of streams
+type languageServer struct {
+	reader    *bufio.Reader
+	writer    io.Writer
+	writeLock sync.Mutex // Diagnostics are published from their own goroutines
+
+	// Diagnostics wait until a document stops changing, the version drops
+	// the results of edits that were overtaken
+	diagnosticsLock    sync.Mutex
+	diagnosticsTimers  map[string]*time.Timer
+	diagnosticsVersion map[string]int
+}
+
+// diagnosticsDelay is how long a document must stay unchanged before it
+// is assembled for diagnostics
+const diagnosticsDelay = 300 * time.Millisecond
+
+// assembleLock runs one diagnostics assembly at a time
+var assembleLock sync.Mutex
+
+// runLanguageServer answers LSP requests on stdin until the client exits
+func runLanguageServer() error {
+	// Keep stray prints, e.g. from the assembler, out of the protocol stream
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	lspDocuments = make(map[string]*lspDocument)
+	server := &languageServer{
+		reader:             bufio.NewReader(os.Stdin),
+		writer:             out,
+		diagnosticsTimers:  make(map[string]*time.Timer),
+		diagnosticsVersion: make(map[string]int),
+	}
+	for {
+		message, err := server.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read message: %v", err)
+		}
+		if message.Method == "exit" {
+			return nil
+		}
+
+		result, rpcErr := server.handle(message)
+		if len(message.ID) == 0 {
+			continue // Notifications get no response
+		}
+		response := lspMessage{JSONRPC: "2.0", ID: message.ID, Error: rpcErr}
+		if rpcErr == nil {
+			if response.Result, err = json.Marshal(result); err != nil {
+				return fmt.Errorf("failed to encode result: %v", err)
+			}
+		}
+		if err := server.write(response); err != nil {
+			return err
+		}
+	}
+}
+
+// read reads one Content-Length framed message
+func (server *languageServer) read() (*lspMessage, error) {
+	length := -1
+	for {
+		line, err := server.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("bad Content-Length: %v", err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(server.reader, body); err != nil {
+		return nil, err
+	}
+	message := &lspMessage{}
+	if err := json.Unmarshal(body, message); err != nil {
+		return nil, fmt.Errorf("bad message: %v", err)
+	}
+	return message, nil
+}
+
+// write sends one message
+func (server *languageServer) write(message lspMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %v", err)
+	}
+	server.writeLock.Lock()
+	defer server.writeLock.Unlock()
+	if _, err := fmt.Fprintf(server.writer, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		return fmt.Errorf("failed to write message: %v", err)
+	}
+	return nil
+}
+
+// notify sends a notification to the client
+func (server *languageServer) notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %v", err)
+	}
+	return server.write(lspMessage{JSONRPC: "2.0", Method: method, Params: data})
+}
+
+// handle dispatches a request or notification
+func (server *languageServer) handle(message *lspMessage) (any, *lspError) {
+	switch message.Method {
+	case "initialize":
+		var params struct {
+			RootURI string `json:"rootUri"`
+		}
+		json.Unmarshal(message.Params, &params)
+		if params.RootURI != "" {
+			currentProjectPath = uriToPath(params.RootURI)
+			if err := LoadProjectSettings(currentProjectPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load project settings: %v\n", err)
+			}
+		}
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":           1, // Full text on every change
+				"completionProvider":         map[string]any{"triggerCharacters": []string{".", ",", "("}},
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"documentSymbolProvider":     true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "risc-gov-ide"},
+		}, nil
+
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &lspError{lspInvalidParams, err.Error()}
+		}
+		server.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &lspError{lspInvalidParams, err.Error()}
+		}
+		if count := len(params.ContentChanges); count > 0 {
+			server.update(params.TextDocument.URI, params.ContentChanges[count-1].Text)
+		}
+
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &lspError{lspInvalidParams, err.Error()}
+		}
+		delete(lspDocuments, uriToPath(params.TextDocument.URI))
+		server.publishDiagnostics(params.TextDocument.URI, func() []lspDiagnostic { return []lspDiagnostic{} }, 0)
+
+	case "textDocument/completion":
+		return server.withPosition(message, completionAt)
+	case "textDocument/hover":
+		return server.withPosition(message, hoverAt)
+	case "textDocument/definition":
+		return server.withPosition(message, definitionAt)
+
+	case "textDocument/documentSymbol":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &lspError{lspInvalidParams, err.Error()}
+		}
+		if document := lspDocuments[uriToPath(params.TextDocument.URI)]; document != nil {
+			return documentSymbols(document.text), nil
+		}
+		return []lspDocumentSymbol{}, nil
+
+	case "textDocument/formatting":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, &lspError{lspInvalidParams, err.Error()}
+		}
+		document := lspDocuments[uriToPath(params.TextDocument.URI)]
+		if document == nil {
+			return []lspTextEdit{}, nil
+		}
+		return formattingEdits(document.text, formatAssembly(document.text, formatterSettings())), nil
+
+	default:
+		if len(message.ID) > 0 && !strings.HasPrefix(message.Method, "$/") {
+			return nil, &lspError{lspMethodNotFound, "unsupported method " + message.Method}
+		}
+	}
+	return nil, nil
+}
+
+// withPosition decodes a position request and runs it on the document's line
+func (server *languageServer) withPosition(message *lspMessage, handler func(*lspDocument, lspPosition) any) (any, *lspError) {
+	var params lspTextDocumentPosition
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		return nil, &lspError{lspInvalidParams, err.Error()}
+	}
+	document := lspDocuments[uriToPath(params.TextDocument.URI)]
+	if document == nil {
+		return nil, nil
+	}
+	return handler(document, params.Position), nil
+}
+
+// update stores a document's new text and publishes its diagnostics once
+// the client stops changing it
+func (server *languageServer) update(uri, text string) {
+	path := uriToPath(uri)
+	lspDocuments[path] = &lspDocument{uri: uri, path: path, text: text}
+	server.publishDiagnostics(uri, func() []lspDiagnostic { return diagnose(path, text) }, diagnosticsDelay)
+}
+
+// publishDiagnostics computes and sends a document's diagnostics after a
+// delay, cancelling any still pending for it
+func (server *languageServer) publishDiagnostics(uri string, compute func() []lspDiagnostic, delay time.Duration) {
+	server.diagnosticsLock.Lock()
+	defer server.diagnosticsLock.Unlock()
+
+	if timer := server.diagnosticsTimers[uri]; timer != nil {
+		timer.Stop()
+	}
+	server.diagnosticsVersion[uri]++
+	version := server.diagnosticsVersion[uri]
+
+	server.diagnosticsTimers[uri] = time.AfterFunc(delay, func() {
+		diagnostics := compute()
+
+		server.diagnosticsLock.Lock()
+		defer server.diagnosticsLock.Unlock()
+		if server.diagnosticsVersion[uri] != version {
+			return // The document changed while it was assembled
+		}
+		delete(server.diagnosticsTimers, uri)
+		server.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diagnostics})
+	})
+}
+
+// uriToPath turns a file URI into a path, other URIs are kept as they are
+func uriToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	path := parsed.Path
+	// file:///C:/dir on Windows
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path)
+}
+
+// pathToURI turns a path back into a file URI
+func pathToURI(path string) string {
+	if strings.Contains(path, "://") || strings.HasPrefix(path, "untitled:") {
+		return path
+	}
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+// documentLine returns a line of a document, the byte offset of an LSP
+// character position within it and whether the line starts inside a /* */
+// comment
+func documentLine(text string, position lspPosition) (string, int, bool) {
+	lines := strings.Split(text, "\n")
+	if position.Line < 0 || position.Line >= len(lines) {
+		return "", 0, false
+	}
+	inBlock := blockCommentStates(lines[:position.Line+1])[position.Line]
+	line := strings.TrimSuffix(lines[position.Line], "\r")
+	units := 0
+	for offset, r := range line {
+		if units >= position.Character {
+			return line, offset, inBlock
+		}
+		units += utf16Length(string(r))
+	}
+	return line, len(line), inBlock
+}
+
+// completionAt offers the same suggestions as the editor's popup
+func completionAt(document *lspDocument, position lspPosition) any {
+	line, offset, inBlock := documentLine(document.text, position)
+	prefix, kinds, ok := completionContext(line[:offset], inBlock)
+	items := []lspCompletionItem{}
+	if !ok || kinds == 0 {
+		return items
+	}
+
+	start := lspPosition{Line: position.Line, Character: position.Character - utf16Length(prefix)}
+	for _, item := range completionItems(kinds) {
+		kind := lspCompletionReference
+		if _, isRegister := registerNumber(item.text); isRegister {
+			kind = lspCompletionVariable
+		} else if isInstruction(item.text) || directiveSignatures[item.text] != "" || strings.HasPrefix(item.text, ".") {
+			kind = lspCompletionKeyword
+		}
+		items = append(items, lspCompletionItem{
+			Label:    item.text,
+			Kind:     kind,
+			Detail:   item.detail,
+			TextEdit: &lspTextEdit{Range: lspRange{Start: start, End: position}, NewText: item.text},
+		})
+	}
+	return items
+}
+
+// hoverAt describes the instruction or symbol under the position
+func hoverAt(document *lspDocument, position lspPosition) any {
+	line, offset, inBlock := documentLine(document.text, position)
+	word, isMnemonic := wordAt(line, offset, inBlock)
+	text := ""
+	if isMnemonic {
+		text = formatInstructionHelp(word, markdownHelp)
+	} else if name := symbolAt(line, offset, inBlock); name != "" {
+		if definitions := lspDefinitions(document, name); len(definitions) > 0 {
+			definition := definitions[0]
+			kind := "Label"
+			if definition.constant {
+				kind = "Constant"
+			}
+			text = fmt.Sprintf("**%s**  \n%s defined at %s:%d", markdownEscaper.Replace(name),
+				kind, markdownEscaper.Replace(filepath.Base(definition.path)), definition.line+1)
+		}
+	}
+	if text == "" {
+		return nil
+	}
+	return map[string]any{"contents": map[string]string{"kind": "markdown", "value": text}}
+}
+
+// lspDefinitions lists where a symbol is defined, the document's own
+// definitions first
+func lspDefinitions(document *lspDocument, name string) []labelDefinition {
+	var local, other []labelDefinition
+	for _, definition := range projectLabels() {
+		switch {
+		case definition.name != name:
+		case definition.path == document.path:
+			local = append(local, definition)
+		default:
+			other = append(other, definition)
+		}
+	}
+	return append(local, other...)
+}
+
+// definitionAt finds where the symbol under the position is defined
+func definitionAt(document *lspDocument, position lspPosition) any {
+	line, offset, inBlock := documentLine(document.text, position)
+	name := symbolAt(line, offset, inBlock)
+	locations := []lspLocation{}
+	if name == "" {
+		return locations
+	}
+	for _, definition := range lspDefinitions(document, name) {
+		start := lspPosition{Line: definition.line, Character: definition.column}
+		end := lspPosition{Line: definition.line, Character: definition.column + utf16Length(name)}
+		locations = append(locations, lspLocation{URI: pathToURI(definition.path), Range: lspRange{Start: start, End: end}})
+	}
+	return locations
+}
+
+// documentSymbols turns the outline of a document into LSP symbols, with
+// the symbols of each section as its children
+func documentSymbols(text string) []lspDocumentSymbol {
+	lines := strings.Split(text, "\n")
+	symbols := []lspDocumentSymbol{}
+	section := -1
+	for _, entry := range outlineEntries(text) {
+		selection := lspRange{
+			Start: lspPosition{Line: entry.line, Character: entry.column},
+			End:   lspPosition{Line: entry.line, Character: entry.column + utf16Length(entry.name)},
+		}
+		symbol := lspDocumentSymbol{
+			Name:           entry.name,
+			Detail:         entry.kindName(),
+			Range:          lspRange{Start: lspPosition{Line: entry.line}, End: lspPosition{Line: entry.line, Character: utf16Length(lines[entry.line])}},
+			SelectionRange: selection,
+		}
+		switch entry.kind {
+		case outlineSection:
+			symbol.Kind = lspSymbolNamespace
+		case outlineLabel:
+			symbol.Kind = lspSymbolFunction
+		case outlineGlobal:
+			symbol.Kind = lspSymbolVariable
+		case outlineConstant:
+			symbol.Kind = lspSymbolConstant
+		case outlineMacro:
+			symbol.Kind = lspSymbolMethod
+		}
+
+		switch {
+		case entry.kind == outlineSection:
+			symbols = append(symbols, symbol)
+			section = len(symbols) - 1
+		case section >= 0:
+			// A section spans the symbols inside it
+			symbols[section].Children = append(symbols[section].Children, symbol)
+			symbols[section].Range.End = symbol.Range.End
+		default:
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+// formattingEdits replaces the whole document if formatting changed it
+func formattingEdits(oldText, newText string) []lspTextEdit {
+	if oldText == newText {
+		return []lspTextEdit{}
+	}
+	lines := strings.Split(oldText, "\n")
+	end := lspPosition{Line: len(lines) - 1, Character: utf16Length(lines[len(lines)-1])}
+	return []lspTextEdit{{Range: lspRange{End: end}, NewText: newText}}
+}
+
+// reAssemblerLine finds the line number in an assembler error message
+var reAssemblerLine = regexp.MustCompile(`(?i)line\s*:?\s*(\d+)|:(\d+):`)
+
+// diagnose reports unknown mnemonics and the assembler's error for a
+// document
+func diagnose(path, text string) []lspDiagnostic {
+	diagnostics := []lspDiagnostic{}
+	lines := strings.Split(text, "\n")
+
+	// Mnemonics the assembler does not know, macros excepted
+	macros := make(map[string]bool)
+	for _, entry := range outlineEntries(text) {
+		if entry.kind == outlineMacro {
+			macros[entry.name] = true
+		}
+	}
+	inMacro := false
+	for i, statement := range parseAsmLines(lines) {
+		mnemonic := statement.Mnemonic()
+		switch {
+		case mnemonic == ".macro":
+			inMacro = true
+		case mnemonic == ".endm":
+			inMacro = false
+		case inMacro || mnemonic == "" || strings.HasPrefix(mnemonic, ".") || isInstruction(mnemonic) || macros[mnemonic]:
+		default:
+			_, at := mnemonicStart(statement.Code)
+			column := utf16Length(lines[i][:at])
+			diagnostics = append(diagnostics, lspDiagnostic{
+				Range:    lspRange{Start: lspPosition{Line: i, Character: column}, End: lspPosition{Line: i, Character: column + utf16Length(mnemonic)}},
+				Severity: lspSeverityWarning,
+				Source:   "risc-gov",
+				Message:  fmt.Sprintf("unknown instruction %q", mnemonic),
+			})
+		}
+	}
+
+	// The assembler only works on files, so assemble a copy of the buffer
+	// in a directory of its own rather than next to the user's files
+	if _, err := os.Stat(path); err != nil || !isAssemblySource(path) {
+		return diagnostics
+	}
+	outputDir, err := os.MkdirTemp("", "riscgov-lsp-*")
+	if err != nil {
+		return diagnostics
+	}
+	defer os.RemoveAll(outputDir)
+	tempFile := filepath.Join(outputDir, filepath.Base(path))
+	if err := os.WriteFile(tempFile, []byte(text), 0644); err != nil {
+		return diagnostics
+	}
+
+	assembleLock.Lock()
+	defer assembleLock.Unlock()
+
+	if err := assembleQuietly(tempFile, outputDir); err != nil {
+		line := 0
+		if match := reAssemblerLine.FindStringSubmatch(err.Error()); match != nil {
+			number, _ := strconv.Atoi(match[1] + match[2])
+			line = min(max(number-1, 0), len(lines)-1)
+		}
+		diagnostics = append(diagnostics, lspDiagnostic{
+			Range:    lspRange{Start: lspPosition{Line: line}, End: lspPosition{Line: line, Character: utf16Length(lines[line])}},
+			Severity: lspSeverityError,
+			Source:   "risc-assembler",
+			Message:  err.Error(),
+		})
+	}
+	return diagnostics
+}
+
+// assembleQuietly runs the assembler, turning a panic into an error so a
+// bad buffer cannot take the server down
+func assembleQuietly(file, outputDir string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("assembler crashed: %v", r)
+		}
+	}()
+	asm := assembler.Assembler{}
+	return asm.Assemble(file, outputDir)
+}
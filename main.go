@@ -1,12 +1,10 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
+	"log"
 	"os"
-	"strings"
 	"sync"
-	"syscall"
 
 	rcore "github.com/RISC-GoV/core"
 	"github.com/therecipe/qt/core"
@@ -22,8 +20,7 @@ var (
 
 	// UI components
 	editor          *CodeEditor
-	terminalOutput  *widgets.QTextEdit
-	terminalInput   *widgets.QTextEdit
+	console         *ConsoleWidget
 	fileTree        *widgets.QTreeView
 	fileSystemModel *widgets.QFileSystemModel
 	debugToolbar    *widgets.QToolBar
@@ -36,8 +33,6 @@ var (
 	currentHighline int
 
 	// File handling
-	debugFileSplit     []string
-	realFileSplit      []string
 	currentFilePath    string
 	currentProjectPath string
 	wg                 sync.WaitGroup
@@ -47,12 +42,43 @@ type DebugState struct {
 	sync.RWMutex
 	isDebugging bool
 	cpu         *rcore.CPU
-	breakpoints map[int]bool
+	session     *programSession
+	editor      *CodeEditor     // Editor showing the code being debugged
+	symbols     []programSymbol // Labels of the program, for the debug console
+	imageEnd    uint32          // End address of the loaded program
+
+	addressLines map[uint32]int // Editor line of each instruction, for breakpoints set while debugging
 }
 
 type CodeEditor struct {
 	*widgets.QPlainTextEdit
 	lineNumberArea *LineNumberArea
+
+	// Per-document state, kept while the editor's tab is in the background
+	filePath    string
+	breakpoints map[int]bool
+	highlighter *gui.QSyntaxHighlighter
+	recoveryID  string // Name of the autosave backup, empty if there is none
+
+	// Completion popup
+	completer        *widgets.QCompleter
+	completionModel  *gui.QStandardItemModel
+	completionPrefix string
+	completionKinds  completionKind
+
+	// Operands of the instruction being typed, shown above the cursor
+	signatureLabel *widgets.QLabel
+
+	// Folded regions by first line, and the regions of the last revision
+	folds        map[int]bool
+	foldRegions  map[int]int
+	foldRevision int
+
+	refreshedRevision int // Revision the folds were last checked against
+
+	// Macros defined in the file, so the highlighter does not flag their uses
+	macros        map[string]bool
+	macroRevision int
 }
 
 type LineNumberArea struct {
@@ -63,9 +89,12 @@ type LineNumberArea struct {
 func NewCodeEditor() *CodeEditor {
 	editor := &CodeEditor{
 		QPlainTextEdit: widgets.NewQPlainTextEdit(nil),
+		breakpoints:    make(map[int]bool),
+		folds:          make(map[int]bool),
 	}
 
-	syntaxHighlighter = gui.NewQSyntaxHighlighter2(editor.Document())
+	editor.highlighter = gui.NewQSyntaxHighlighter2(editor.Document())
+	attachSyntaxHighlighter(editor)
 	font := gui.NewQFont()
 	font.SetFamily(preferences.EditorSettings.FontFamily)
 	font.SetFixedPitch(true)
@@ -78,7 +107,19 @@ func NewCodeEditor() *CodeEditor {
 	editor.lineNumberArea = NewLineNumberArea(editor)
 	editor.ConnectUpdateRequest(editor.updateLineNumberArea)
 	editor.lineNumberArea.ConnectMousePressEvent(editor.lineNumberAreaMousePress)
+	editor.lineNumberArea.ConnectPaintEvent(editor.lineNumberAreaPaint)
+	editor.setupCompletion()
+	editor.setupInstructionHelp()
+	editor.ConnectKeyPressEvent(editor.keyPress)
+	editor.ConnectEvent(editor.commandEvent)
+	editor.ConnectMouseReleaseEvent(editor.mouseRelease)
 	editor.ConnectBlockCountChanged(func(int) { editor.updateLineNumberAreaWidth() })
+	editor.Document().ConnectContentsChanged(editor.refreshFolds)
+	editor.ConnectCursorPositionChanged(func() {
+		if block := editor.TextCursor().Block(); !block.IsVisible() {
+			editor.revealLine(block.BlockNumber())
+		}
+	})
 	editor.SetLineWrapMode(widgets.QPlainTextEdit__NoWrap)
 	editor.updateLineNumberAreaWidth()
 
@@ -131,8 +172,8 @@ func (e *CodeEditor) calculateLineNumberAreaWidth() int {
 	leftPadding := 5  // space from the left edge of the area
 	rightPadding := 5 // space from the right edge of the area where the numbers stop
 
-	// The total width needed is the text width plus padding
-	requiredWidth := textWidth*len(widestNumberStr) + leftPadding + rightPadding
+	// The total width needed is the text width plus padding and the fold markers
+	requiredWidth := textWidth*len(widestNumberStr) + leftPadding + rightPadding + e.foldMarkerWidth()
 
 	return requiredWidth
 }
@@ -149,18 +190,9 @@ func createToolbars() {
 	mainToolbar.SetWindowTitle("Main")
 	mainWindow.AddToolBar(core.Qt__TopToolBarArea, mainToolbar)
 
-	actions := map[string]func(){
-		"New File":  createNewFile,
-		"Open File": openFileDialog,
-		"Save":      saveCurrentFile,
-		"Assemble":  AssembleCode,
-		"Run":       runCode,
-		"Debug":     debugCode,
-	}
-
-	for name, handler := range actions {
-		action := mainToolbar.AddAction2(gui.NewQIcon(), name)
-		action.ConnectTriggered(func(bool) { handler() }) // wrap it
+	// The main toolbar shares its actions with the menus, and their shortcuts
+	for _, id := range []string{"file.new", "file.open", "file.save", "run.assemble", "run.run", "run.debug"} {
+		mainToolbar.QWidget.AddAction(commandsByID[id].action)
 	}
 
 	debugToolbar = widgets.NewQToolBar("Debug", mainWindow)
@@ -168,30 +200,34 @@ func createToolbars() {
 	mainWindow.AddToolBar(core.Qt__TopToolBarArea, debugToolbar)
 	debugToolbar.SetVisible(false)
 
-	debugActions := map[string]func(){
-		"HotReload": hotReloadCode,
-		"Step":      stepDebugCode,
-		"Continue":  continueDebugCode,
-		"Stop":      stopDebugging,
-	}
-
-	for name, handler := range debugActions {
-		action := debugToolbar.AddAction2(gui.NewQIcon(), name)
-		action.ConnectTriggered(func(bool) { handler() }) // wrap it
-	}
-
+	// Debug commands live on the debug toolbar, so their shortcuts only
+	// work while it is shown
+	debugToolbar.QWidget.AddAction(registerCommand("Debug", "debug.hotReload", "Hot Reload", "Ctrl+F7", hotReloadCode))
+	debugToolbar.QWidget.AddAction(registerCommand("Debug", "debug.step", "Step", "F10", stepDebugCode))
+	debugToolbar.QWidget.AddAction(registerCommand("Debug", "debug.continue", "Continue", "F9", continueDebugCode))
+	debugToolbar.QWidget.AddAction(registerCommand("Debug", "debug.stop", "Stop", "Shift+F7", stopDebugging))
 }
 
 func main() {
+	// risc-gov-ide lsp serves editors over the Language Server Protocol
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		if err := runLanguageServer(); err != nil {
+			log.Fatalf("Language server failed: %v", err)
+		}
+		return
+	}
+
 	app = widgets.NewQApplication(len(os.Args), os.Args)
 
+	// Style the window before it is shown, the preferred theme follows once
+	// the preferences are loaded
+	applyModernTheme()
+
+	// The goroutines do no Qt work, widgets are only touched from the main thread
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		applyModernTheme()
-		debugInfo = &DebugState{
-			breakpoints: make(map[int]bool),
-		}
+		debugInfo = &DebugState{}
 	}()
 
 	mainWindow = widgets.NewQMainWindow(nil, 0)
@@ -211,21 +247,39 @@ func main() {
 
 	mainWindow.ShowMaximized()
 
+	var preferencesErr error
 	go func() {
 		defer wg.Done()
-		initializeFromPreferences()
+		preferencesErr = InitPreferences()
 	}()
 
 	wg.Wait()
-	editor.lineNumberArea.ConnectPaintEvent(editor.lineNumberAreaPaint)
-	go initTerminalIO()
+	initializeFromPreferences(preferencesErr)
+	activateEditor(editor)
+	applyKeybindings()
+	initTerminalIO()
 	initDebug()
 
+	// Follow the desktop between light and dark when the theme is Auto
+	mainWindow.ConnectChangeEvent(func(event *core.QEvent) {
+		if event.Type() == core.QEvent__ApplicationPaletteChange {
+			followSystemTheme()
+		}
+		mainWindow.ChangeEventDefault(event)
+	})
+
 	mainWindow.ConnectCloseEvent(func(event *gui.QCloseEvent) {
+		// Give the user a chance to keep unsaved changes
+		if !maybeSaveAll() {
+			event.Ignore()
+			return
+		}
+		discardAllRecovery()
 		go saveWindowState()
 		event.Accept()
 	})
 	setupSyntaxHighlighting()
+	offerRecovery()
 	mainWindow.Show()
 	app.Exec()
 }
@@ -251,7 +305,7 @@ func (e *CodeEditor) BlockAtPosition(y int) int {
 	bottom := top + int(e.BlockBoundingRect(block).Height())
 
 	for block.IsValid() && top <= y {
-		if y <= bottom {
+		if block.IsVisible() && y <= bottom {
 			return blockNumber
 		}
 
@@ -302,46 +356,30 @@ func createMainContent() *widgets.QWidget {
 	filePanelLayout.AddWidget(fileTree, 0, 0)
 	filePanel.SetLayout(filePanelLayout)
 
-	mainSplitter.AddWidget(filePanel)
+	// Outline of the active file below the files
+	leftSplitter := widgets.NewQSplitter2(core.Qt__Vertical, nil)
+	leftSplitter.AddWidget(filePanel)
+	outlinePanel = NewOutlinePanel()
+	leftSplitter.AddWidget(outlinePanel)
+	leftSplitter.SetSizes([]int{450, 350})
+
+	mainSplitter.AddWidget(leftSplitter)
 
 	// Right side: Editor and terminal
 	rightSplitter := widgets.NewQSplitter2(core.Qt__Vertical, nil)
 
-	// Code editor
-	editor = NewCodeEditor()
+	// Find bar and code editor tabs
 	editorPanel := widgets.NewQWidget(nil, 0)
 	editorLayout := widgets.NewQVBoxLayout()
-	editorLayout.AddWidget(editor, 0, 0)
+	findBar = NewFindBar()
+	editorLayout.AddWidget(findBar, 0, 0)
+	editorLayout.AddWidget(createEditorTabs(), 1, 0)
 	editorPanel.SetLayout(editorLayout)
 
 	rightSplitter.AddWidget(editorPanel)
 
-	// Terminal panel with output and input terminals
-	terminalPanel := widgets.NewQWidget(nil, 0)
-	terminalLayout := widgets.NewQVBoxLayout()
-
-	// Output terminal (stdout) - read-only
-	terminalOutput = widgets.NewQTextEdit(nil)
-	terminalOutput.SetReadOnly(true)
-	terminalOutput.SetFontFamily(preferences.EditorSettings.FontFamily)
-	terminalOutput.SetFontPointSize(float64(preferences.EditorSettings.TFontSize))
-
-	// Input terminal (stdin)
-	terminalInput = widgets.NewQTextEdit(nil)
-	terminalInput.SetReadOnly(false)
-	terminalInput.SetFontFamily(preferences.EditorSettings.FontFamily)
-	terminalInput.SetFontPointSize(float64(preferences.EditorSettings.TFontSize))
-	terminalInput.SetMaximumHeight(60) // Limit height of input terminal
-
-	// Add terminals to layout
-	terminalLayout.AddWidget(widgets.NewQLabel2("Output (stdout)", nil, 0), 0, 0)
-	terminalLayout.AddWidget(terminalOutput, 0, 0)
-	terminalLayout.AddWidget(widgets.NewQLabel2("Input (stdin)", nil, 0), 0, 0)
-	terminalLayout.AddWidget(terminalInput, 0, 0)
-
-	terminalPanel.SetLayout(terminalLayout)
-
-	rightSplitter.AddWidget(terminalPanel)
+	// Bottom panel with the Build, Output, Debug Console and Search tabs
+	rightSplitter.AddWidget(createBottomPanel())
 
 	// Set initial splitter sizes for right panel
 	rightSplitter.SetSizes([]int{600, 200})
@@ -360,221 +398,126 @@ func createMenus() {
 	menuBar := mainWindow.MenuBar()
 
 	fileMenu := menuBar.AddMenu2("&File")
-
-	newAction := fileMenu.AddAction("&New File")
-	newAction.SetShortcut(gui.NewQKeySequence2("Ctrl+N", gui.QKeySequence__NativeText))
-	newAction.ConnectTriggered(func(bool) { createNewFile() })
-
-	openAction := fileMenu.AddAction("&Open File...")
-	openAction.SetShortcut(gui.NewQKeySequence2("Ctrl+O", gui.QKeySequence__NativeText))
-	openAction.ConnectTriggered(func(bool) { openFileDialog() })
-
-	openProjectAction := fileMenu.AddAction("Open &Project...")
-	openProjectAction.ConnectTriggered(func(bool) { openProjectDialog() })
-
+	addCommand(fileMenu, "file.new", "&New File", "Ctrl+N", createNewFile)
+	addCommand(fileMenu, "file.open", "&Open File...", "Ctrl+O", openFileDialog)
+	addCommand(fileMenu, "file.openProject", "Open &Project...", "", openProjectDialog)
 	fileMenu.AddSeparator()
-
-	saveAction := fileMenu.AddAction("&Save")
-	saveAction.SetShortcut(gui.NewQKeySequence2("Ctrl+S", gui.QKeySequence__NativeText))
-	saveAction.ConnectTriggered(func(bool) { saveCurrentFile() })
-
-	saveAsAction := fileMenu.AddAction("Save &As...")
-	saveAsAction.ConnectTriggered(func(bool) { saveFileAs() })
-
+	addCommand(fileMenu, "file.save", "&Save", "Ctrl+S", saveCurrentFile)
+	addCommand(fileMenu, "file.saveAs", "Save &As...", "", saveFileAs)
+	fileMenu.AddSeparator()
+	addCommand(fileMenu, "file.closeTab", "&Close Tab", "Ctrl+W", closeCurrentTab)
+	addCommand(fileMenu, "file.closeOtherTabs", "Close &Other Tabs", "", closeOtherTabs)
+	addCommand(fileMenu, "file.reopenClosedTab", "&Reopen Closed Tab", "Ctrl+Shift+T", reopenClosedTab)
 	fileMenu.AddSeparator()
+	addCommand(fileMenu, "file.preferences", "Pre&ferences...", "", showPreferencesDialog)
 
-	preferencesAction := fileMenu.AddAction("Pre&ferences...")
-	preferencesAction.ConnectTriggered(func(bool) { showPreferencesDialog() })
+	themeMenu := fileMenu.AddMenu2("&Theme")
+	themeMenu.ConnectAboutToShow(func() { populateThemeMenu(themeMenu) })
 
 	fileMenu.AddSeparator()
-
-	exitAction := fileMenu.AddAction("E&xit")
-	exitAction.SetShortcut(gui.NewQKeySequence2("Alt+F4", gui.QKeySequence__NativeText))
-	exitAction.ConnectTriggered(func(bool) {
-		saveWindowState()
-		app.Quit()
+	addCommand(fileMenu, "file.exit", "E&xit", "Alt+F4", func() {
+		// Close the window so unsaved changes are checked first
+		mainWindow.Close()
 	})
 
 	editMenu := menuBar.AddMenu2("&Edit")
-
-	undoAction := editMenu.AddAction("&Undo")
-	undoAction.SetShortcut(gui.NewQKeySequence2("Ctrl+Z", gui.QKeySequence__NativeText))
-	undoAction.ConnectTriggered(func(bool) {
+	addCommand(editMenu, "edit.undo", "&Undo", "Ctrl+Z", func() {
 		if editor != nil {
 			editor.Undo()
 		}
 	})
-
-	redoAction := editMenu.AddAction("&Redo")
-	redoAction.SetShortcut(gui.NewQKeySequence2("Ctrl+Y", gui.QKeySequence__NativeText))
-	redoAction.ConnectTriggered(func(bool) {
+	addCommand(editMenu, "edit.redo", "&Redo", "Ctrl+Y", func() {
 		if editor != nil {
 			editor.Redo()
 		}
 	})
-
 	editMenu.AddSeparator()
-
-	cutAction := editMenu.AddAction("Cu&t")
-	cutAction.SetShortcut(gui.NewQKeySequence2("Ctrl+X", gui.QKeySequence__NativeText))
-	cutAction.ConnectTriggered(func(bool) {
+	addCommand(editMenu, "edit.cut", "Cu&t", "Ctrl+X", func() {
 		if editor != nil {
 			editor.Cut()
 		}
 	})
-
-	copyAction := editMenu.AddAction("&Copy")
-	copyAction.SetShortcut(gui.NewQKeySequence2("Ctrl+C", gui.QKeySequence__NativeText))
-	copyAction.ConnectTriggered(func(bool) {
+	addCommand(editMenu, "edit.copy", "&Copy", "Ctrl+C", func() {
 		if editor != nil {
 			editor.Copy()
 		}
 	})
-
-	pasteAction := editMenu.AddAction("&Paste")
-	pasteAction.SetShortcut(gui.NewQKeySequence2("Ctrl+V", gui.QKeySequence__NativeText))
-	pasteAction.ConnectTriggered(func(bool) {
+	addCommand(editMenu, "edit.paste", "&Paste", "Ctrl+V", func() {
 		if editor != nil {
 			editor.Paste()
 		}
 	})
+	editMenu.AddSeparator()
+	addCommand(editMenu, "edit.find", "&Find...", "Ctrl+F", func() { findBar.open(false) })
+	addCommand(editMenu, "edit.replace", "R&eplace...", "Ctrl+H", func() { findBar.open(true) })
+	addCommand(editMenu, "edit.findNext", "Find &Next", "F3", func() { findBar.find(false) })
+	addCommand(editMenu, "edit.findPrevious", "Find Pre&vious", "Shift+F3", func() { findBar.find(true) })
+	addCommand(editMenu, "edit.findInProject", "Find in Pro&ject...", "Ctrl+Shift+F", func() { projectSearch.open() })
+	editMenu.AddSeparator()
+	addCommand(editMenu, "edit.format", "F&ormat Document", "Alt+Shift+F", func() { formatDocument(editor) })
+	addCommand(editMenu, "edit.goToDefinition", "Go to &Definition", "F12", goToDefinition)
+	addCommand(editMenu, "edit.findReferences", "Find All Re&ferences", "Shift+F12", findAllReferences)
+	addCommand(editMenu, "edit.renameSymbol", "Rena&me Symbol...", "F2", renameSymbol)
+	addCommand(editMenu, "edit.goToLine", "Go to L&ine...", "Ctrl+G", func() { showCommandPalette(":") })
+	addCommand(editMenu, "edit.goToSymbol", "Go to S&ymbol...", "Ctrl+Shift+O", func() { showCommandPalette("@") })
+	addCommand(editMenu, "edit.commandPalette", "Command Palette...", "Ctrl+Shift+P", func() { showCommandPalette("") })
+	editMenu.AddSeparator()
+	addCommand(editMenu, "edit.fold", "Fo&ld", "Ctrl+Shift+[", func() { editor.foldAtCursor() })
+	addCommand(editMenu, "edit.unfold", "&Unfold", "Ctrl+Shift+]", func() { editor.unfoldAtCursor() })
+	addCommand(editMenu, "edit.foldAll", "Fold &All", "", func() { editor.foldAll() })
+	addCommand(editMenu, "edit.unfoldAll", "Unfold A&ll", "", func() { editor.unfoldAll() })
 
 	runMenu := menuBar.AddMenu2("&Run")
-
-	assembleAction := runMenu.AddAction("&Assemble")
-	assembleAction.SetShortcut(gui.NewQKeySequence2("F5", gui.QKeySequence__NativeText))
-	assembleAction.ConnectTriggered(func(bool) { AssembleCode() })
-
-	runAction := runMenu.AddAction("&Run")
-	runAction.SetShortcut(gui.NewQKeySequence2("F6", gui.QKeySequence__NativeText))
-	runAction.ConnectTriggered(func(bool) { runCode() })
-
-	debugAction := runMenu.AddAction("&Debug")
-	debugAction.SetShortcut(gui.NewQKeySequence2("F7", gui.QKeySequence__NativeText))
-	debugAction.ConnectTriggered(func(bool) { debugCode() })
+	addCommand(runMenu, "run.assemble", "&Assemble", "F5", AssembleCode)
+	addCommand(runMenu, "run.run", "&Run", "F6", runCode)
+	addCommand(runMenu, "run.debug", "&Debug", "F7", debugCode)
+	runMenu.AddSeparator()
+	addCommand(runMenu, "run.exportArtifacts", "E&xport Artifacts", "F8", exportArtifacts)
+	addCommand(runMenu, "run.exportELF", "Export E&LF...", "", exportELFDialog)
+	addCommand(runMenu, "run.debugELF", "Debug &ELF Executable...", "", debugELFDialog)
+	addCommand(runMenu, "run.configuration", "Run &Configuration...", "", showRunConfigurationDialog)
+	addCommand(runMenu, "run.buildConfigurations", "&Build Configurations...", "", showBuildConfigurationsDialog)
 
 	helpMenu := menuBar.AddMenu2("&Help")
-
-	bugAction := helpMenu.AddAction("&Report bug")
-	bugAction.ConnectTriggered(func(bool) {
+	addCommand(helpMenu, "help.reportBug", "&Report bug", "", func() {
 		url := core.NewQUrl3("https://github.com/RISC-GoV/gui/issues/new", core.QUrl__TolerantMode)
 		gui.QDesktopServices_OpenUrl(url)
 	})
-
-	aboutAction := helpMenu.AddAction("&About")
-	aboutAction.ConnectTriggered(func(bool) {
+	addCommand(helpMenu, "help.about", "&About", "", func() {
 		widgets.QMessageBox_About(mainWindow, "About RISC-GoV IDE",
 			"RISC-GoV IDE\nA development environment for RISC-V assembly.")
 	})
 }
+
 func initTerminalIO() {
-	stdinR, stdinW, _ := os.Pipe()
-	stdoutR, stdoutW, _ := os.Pipe()
-
-	os.Stdin = stdinR
-	os.Stdout = stdoutW
-	os.Stderr = stdoutW
-
-	// Hold original stdout to write back to terminal for debugging
-	originalStdout := os.NewFile(uintptr(syscall.Stdout), "/dev/stdout")
-
-	var currentInput string
-	updateCh := make(chan string, 100)
-
-	// UI: Capture key events
-	terminalInput.ConnectKeyPressEvent(func(event *gui.QKeyEvent) {
-		key := event.Key()
-
-		// Handle Enter key - send input to stdin
-		if key == int(core.Qt__Key_Return) || key == int(core.Qt__Key_Enter) {
-			if currentInput != "" {
-				stdinW.Write([]byte(currentInput))
-				updateCh <- currentInput + "\n"
-				currentInput = ""
-				terminalInput.Clear()
-			}
-			event.Accept()
-			return
+	// Console: submitted lines go to the active program's stdin, Ctrl+D
+	// sends EOF and Ctrl+C stops the program
+	console.onInput = func(text string) {
+		if session := currentSession(); session != nil {
+			session.sendInput([]byte(text))
 		}
-
-		// Handle Backspace
-		if key == int(core.Qt__Key_Backspace) && len(currentInput) > 0 {
-			currentInput = currentInput[:len(currentInput)-1]
-			text := terminalInput.ToPlainText()
-			if len(text) > 0 {
-				terminalInput.SetPlainText(text[:len(text)-1])
-			}
-			event.Accept()
-			return
+	}
+	console.onEOF = func() {
+		if session := currentSession(); session != nil {
+			session.sendInput(nil)
 		}
-
-		// Handle regular character input
-		if event.Text() != "" {
-			char := event.Text()
-			currentInput += char
-			terminalInput.InsertPlainText(char)
-			event.Accept()
+	}
+	console.onInterrupt = func() {
+		if session := currentSession(); session != nil {
+			session.interrupt()
 		}
-	})
+	}
 
-	// Timer-based UI update from stdout pipe
+	// Timer-based UI update from program output, log messages and the
+	// debugger's current line
 	timer := core.NewQTimer(nil)
 	timer.ConnectTimeout(func() {
-		for {
-			select {
-			case out := <-updateCh:
-				terminalOutput.Append(out)
-				cursor := terminalOutput.TextCursor()
-				cursor.MovePosition(gui.QTextCursor__End, gui.QTextCursor__MoveAnchor, 1)
-				terminalOutput.SetTextCursor(cursor)
-				terminalOutput.EnsureCursorVisible()
-
-			default:
-				return
-			}
+		for _, pane := range outputPanes {
+			pane.flush()
 		}
+		flushHighlight()
 	})
 	timer.Start(5)
-
-	// Goroutine to read from redirected stdout/stderr
-	go func() {
-		reader := bufio.NewReader(stdoutR)
-		buffer := make([]byte, 1024)
-		for {
-			n, err := reader.Read(buffer)
-			if err != nil {
-				break
-			}
-			output := string(buffer[:n])
-			// Mirror to original stdout
-			fmt.Fprintln(originalStdout, output)
-			// Send to GUI
-			updateCh <- output
-		}
-	}()
-}
-
-func setTerminal(newMSG string) {
-	const maxLines = 50
-
-	old := terminalOutput.ToPlainText()
-	combined := old + newMSG
-
-	// Split into lines
-	lines := strings.Split(combined, "\n")
-
-	// Keep only the last maxLines
-	if len(lines) > maxLines {
-		lines = lines[len(lines)-maxLines:]
-	}
-
-	// Join and set the updated text
-	terminalOutput.SetPlainText(strings.Join(lines, "\n"))
-
-	// Scroll to bottom using gui.QTextCursor
-	cursor := terminalOutput.TextCursor()
-	cursor.MovePosition(gui.QTextCursor__End, gui.QTextCursor__MoveAnchor, 1)
-	terminalOutput.SetTextCursor(cursor)
 }
 
 func updateRegistersDisplay() {
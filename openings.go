@@ -3,37 +3,49 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/therecipe/qt/widgets"
 )
 
-func openFile(path string) {
+// openFile shows a file in its own tab, switching to the tab if the file is
+// already open. It returns false if the file could not be read.
+func openFile(path string) bool {
+	if open := editorForPath(path); open != nil {
+		editorTabs.SetCurrentWidget(open)
+		return true
+	}
+
 	data, err := os.ReadFile(path)
 	if err != nil {
 		widgets.QMessageBox_Critical(mainWindow, "Error",
 			fmt.Sprintf("Failed to open file: %v", err),
 			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
-		return
+		return false
 	}
 
-	currentFilePath = path
+	// Reuse an untouched untitled tab, otherwise open a new one so that
+	// unsaved changes are never overwritten
+	if !editor.isBlank() {
+		newEditorTab()
+	}
 	editor.SetPlainText(string(data))
+	editor.Document().SetModified(false)
+	editor.setFilePath(path)
 
 	// Force update line numbers when file is opened
 	editor.updateLineNumberAreaWidth()
 	editor.lineNumberArea.Update()
 
-	mainWindow.SetWindowTitle(fmt.Sprintf("RISC-GoV IDE - %s", filepath.Base(path)))
-
 	// Add to recent files list
 	AddRecentFile(path)
 
-	// Trigger global syntax highlighting immediately after opening the file
+	// Trigger syntax highlighting immediately after opening the file
 	// This will re-apply highlighting to the entire document.
-	if syntaxHighlighter != nil {
-		syntaxHighlighter.Rehighlight()
-	}
+	editor.highlighter.Rehighlight()
+
+	// Fold what was folded when the file was last open
+	editor.restoreFolds()
+	return true
 }
 
 func openProjectDialog() {
@@ -41,6 +53,13 @@ func openProjectDialog() {
 		"", widgets.QFileDialog__ShowDirsOnly)
 
 	if projectDir != "" {
+		// The open files belong to the old project
+		if !maybeSaveAll() {
+			return
+		}
+		stopDebugging()
+		closeAllTabs()
+
 		currentProjectPath = projectDir
 		fileSystemModel.SetRootPath(currentProjectPath)
 		fileTree.SetRootIndex(fileSystemModel.Index2(currentProjectPath, 0))
@@ -50,6 +69,13 @@ func openProjectDialog() {
 
 		// Save as last opened project
 		SetLastOpenedProject(projectDir)
+
+		// Load the project's build configurations
+		if err := LoadProjectSettings(projectDir); err != nil {
+			widgets.QMessageBox_Warning(mainWindow, "Project Settings",
+				fmt.Sprintf("Failed to load project settings, using defaults: %v", err),
+				widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		}
 	}
 }
 
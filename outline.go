@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+// Delay after the last keystroke before the outline is rebuilt
+const outlineUpdateDelay = 300
+
+// outlineKind is what an outline entry stands for
+type outlineKind int
+
+const (
+	outlineSection outlineKind = iota
+	outlineLabel
+	outlineGlobal
+	outlineConstant
+	outlineMacro
+)
+
+// outlineEntry is one symbol of the outline
+type outlineEntry struct {
+	kind   outlineKind
+	name   string
+	detail string
+	global bool // Labels named by .globl
+	line   int  // 0-based
+	column int  // Qt position within the line
+}
+
+// outlineEntries parses a source text into its sections, labels, global
+// symbols, constants and macros, in source order
+func outlineEntries(text string) []outlineEntry {
+	var entries []outlineEntry
+	globals := make(map[string]bool)
+	inMacro := false
+
+	inBlock := false
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		startsInBlock := inBlock
+		var statement asmLine
+		statement, inBlock = parseAsmLine(line, inBlock)
+		mnemonic := statement.Mnemonic()
+
+		// Skip macro bodies, they are only code once expanded
+		if inMacro {
+			inMacro = mnemonic != ".endm"
+			continue
+		}
+
+		if statement.Label != "" {
+			entries = append(entries, outlineEntry{kind: outlineLabel, name: statement.Label, line: i, column: symbolColumn(line, startsInBlock, statement.Label)})
+		}
+
+		arguments := ""
+		if len(statement.Fields) > 1 {
+			arguments = strings.Join(statement.Fields[1:], " ")
+		}
+		switch mnemonic {
+		case ".text", ".data", ".bss", ".rodata":
+			entries = append(entries, outlineEntry{kind: outlineSection, name: mnemonic, line: i, column: symbolColumn(line, startsInBlock, mnemonic)})
+		case ".section":
+			if arguments != "" {
+				name := strings.TrimSpace(strings.Split(arguments, ",")[0])
+				entries = append(entries, outlineEntry{kind: outlineSection, name: name, line: i, column: symbolColumn(line, startsInBlock, name)})
+			}
+		case ".globl", ".global":
+			for _, name := range strings.Split(arguments, ",") {
+				if name = strings.TrimSpace(name); isSymbolName(name) {
+					globals[name] = true
+					entries = append(entries, outlineEntry{kind: outlineGlobal, name: name, line: i, column: symbolColumn(line, startsInBlock, name)})
+				}
+			}
+		case ".equ", ".set":
+			parts := strings.SplitN(arguments, ",", 2)
+			if name := strings.TrimSpace(parts[0]); isSymbolName(name) {
+				entry := outlineEntry{kind: outlineConstant, name: name, line: i, column: symbolColumn(line, startsInBlock, name)}
+				if len(parts) == 2 {
+					entry.detail = strings.TrimSpace(parts[1])
+				}
+				entries = append(entries, entry)
+			}
+		case ".macro":
+			inMacro = true
+			if len(statement.Fields) > 1 {
+				name := strings.TrimSuffix(statement.Fields[1], ",")
+				entry := outlineEntry{kind: outlineMacro, name: name, line: i, column: symbolColumn(line, startsInBlock, name)}
+				if len(statement.Fields) > 2 {
+					entry.detail = strings.Join(statement.Fields[2:], " ")
+				}
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	// A label is global if any .globl names it, before or after it
+	for i := range entries {
+		if entries[i].kind == outlineLabel && globals[entries[i].name] {
+			entries[i].global = true
+		}
+	}
+	return entries
+}
+
+// symbolColumn returns the Qt position of the first use of name in a line,
+// which starts inside a /* */ comment if inBlock is set
+func symbolColumn(line string, inBlock bool, name string) int {
+	if occurrences, _ := lineSymbolOccurrences(line, inBlock, name); len(occurrences) > 0 {
+		return occurrences[0].start
+	}
+	if index := strings.Index(line, name); index >= 0 {
+		return utf16Length(line[:index])
+	}
+	return 0
+}
+
+// kindName describes an entry in the second column of the outline
+func (entry outlineEntry) kindName() string {
+	switch entry.kind {
+	case outlineSection:
+		return "section"
+	case outlineLabel:
+		if entry.global {
+			return "global label"
+		}
+		return "label"
+	case outlineGlobal:
+		return ".globl"
+	case outlineConstant:
+		if entry.detail != "" {
+			return "constant = " + entry.detail
+		}
+		return "constant"
+	case outlineMacro:
+		return ".macro " + entry.detail
+	}
+	return ""
+}
+
+// OutlinePanel lists the symbols of the active file below the file tree
+type OutlinePanel struct {
+	*widgets.QWidget
+	filterInput *widgets.QLineEdit
+	tree        *widgets.QTreeWidget
+	updateTimer *core.QTimer
+	entries     map[uintptr]outlineEntry
+}
+
+var outlinePanel *OutlinePanel
+
+// NewOutlinePanel creates the Outline panel
+func NewOutlinePanel() *OutlinePanel {
+	panel := &OutlinePanel{
+		QWidget: widgets.NewQWidget(nil, 0),
+		entries: make(map[uintptr]outlineEntry),
+	}
+
+	panel.filterInput = widgets.NewQLineEdit(nil)
+	panel.filterInput.SetPlaceholderText("Filter symbols")
+	panel.filterInput.SetClearButtonEnabled(true)
+	panel.filterInput.ConnectTextChanged(func(string) { panel.applyFilter() })
+
+	panel.tree = widgets.NewQTreeWidget(nil)
+	panel.tree.SetColumnCount(2)
+	panel.tree.SetHeaderHidden(true)
+	panel.tree.SetUniformRowHeights(true)
+	panel.tree.ConnectItemClicked(func(item *widgets.QTreeWidgetItem, column int) {
+		if entry, ok := panel.entries[uintptr(item.Pointer())]; ok {
+			editor.selectRange(entry.line, entry.column, utf16Length(entry.name))
+		}
+	})
+
+	// Rebuild once typing pauses rather than on every keystroke
+	panel.updateTimer = core.NewQTimer(nil)
+	panel.updateTimer.SetSingleShot(true)
+	panel.updateTimer.ConnectTimeout(panel.refresh)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.AddWidget(widgets.NewQLabel2("Outline", nil, 0), 0, 0)
+	layout.AddWidget(panel.filterInput, 0, 0)
+	layout.AddWidget(panel.tree, 1, 0)
+	panel.SetLayout(layout)
+
+	return panel
+}
+
+// scheduleRefresh rebuilds the outline after a short pause in typing
+func (panel *OutlinePanel) scheduleRefresh() {
+	panel.updateTimer.Start(outlineUpdateDelay)
+}
+
+// refresh rebuilds the outline from the active editor's buffer
+func (panel *OutlinePanel) refresh() {
+	panel.updateTimer.Stop()
+	panel.tree.Clear()
+	panel.entries = make(map[uintptr]outlineEntry)
+	if editor == nil {
+		return
+	}
+
+	// Symbols are grouped under the section they are defined in
+	var section *widgets.QTreeWidgetItem
+	for _, entry := range outlineEntries(editor.ToPlainText()) {
+		item := widgets.NewQTreeWidgetItem(0)
+		item.SetText(0, entry.name)
+		item.SetText(1, entry.kindName())
+		item.SetToolTip(0, fmt.Sprintf("%s, line %d", entry.kindName(), entry.line+1))
+		if entry.kind == outlineSection || entry.global {
+			font := item.Font(0)
+			font.SetBold(true)
+			item.SetFont(0, font)
+		}
+		panel.entries[uintptr(item.Pointer())] = entry
+
+		switch {
+		case entry.kind == outlineSection:
+			panel.tree.AddTopLevelItem(item)
+			section = item
+		case section != nil:
+			section.AddChild(item)
+		default:
+			panel.tree.AddTopLevelItem(item)
+		}
+	}
+	panel.tree.ExpandAll()
+	panel.tree.ResizeColumnToContents(0)
+	panel.applyFilter()
+}
+
+// applyFilter hides the entries whose name does not contain the filter,
+// sections stay visible while one of their entries matches
+func (panel *OutlinePanel) applyFilter() {
+	filter := strings.ToLower(panel.filterInput.Text())
+	matches := func(item *widgets.QTreeWidgetItem) bool {
+		return strings.Contains(strings.ToLower(item.Text(0)), filter)
+	}
+
+	for i := 0; i < panel.tree.TopLevelItemCount(); i++ {
+		top := panel.tree.TopLevelItem(i)
+		visible := matches(top)
+		for j := 0; j < top.ChildCount(); j++ {
+			child := top.Child(j)
+			childVisible := matches(child)
+			child.SetHidden(!childVisible)
+			visible = visible || childVisible
+		}
+		top.SetHidden(!visible)
+	}
+}
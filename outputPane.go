@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// maxPendingOutput bounds the text waiting to be shown. A program writing
+// faster than the UI keeps up loses its oldest output, as scrollback would.
+const maxPendingOutput = 1 << 20
+
+// OutputPane is one tab of the bottom panel: a read-only log with its own
+// scrollback limit and a toolbar to search, copy, save and clear it.
+// Append, Log and Clear may be called from any goroutine and never block;
+// the changes are applied on the UI thread in the order they were made.
+type OutputPane struct {
+	*widgets.QWidget
+	name        string
+	view        *widgets.QPlainTextEdit
+	searchInput *widgets.QLineEdit
+
+	pendingLock  sync.Mutex
+	pendingText  []byte
+	pendingClear bool // Clear the view before adding pendingText
+
+	appendText func(text string)
+	clearText  func()
+}
+
+var (
+	// Bottom panel tabs
+	bottomPanel   *widgets.QTabWidget
+	buildLog      *OutputPane // Assembler and export messages
+	programOutput *OutputPane // Program stdout/stdin and run status
+	debugLog      *OutputPane // Debugger messages
+	outputPanes   []*OutputPane
+)
+
+// NewOutputPane wraps view, which shows text appended at its end
+func NewOutputPane(name string, view *widgets.QPlainTextEdit) *OutputPane {
+	pane := &OutputPane{
+		QWidget: widgets.NewQWidget(nil, 0),
+		name:    name,
+		view:    view,
+	}
+	pane.appendText = pane.appendAtEnd
+	pane.clearText = view.Clear
+
+	// Toolbar: search, copy, save, clear
+	toolbar := widgets.NewQHBoxLayout()
+	toolbar.SetContentsMargins(0, 0, 0, 0)
+
+	pane.searchInput = widgets.NewQLineEdit(nil)
+	pane.searchInput.SetPlaceholderText("Search " + name)
+	pane.searchInput.SetClearButtonEnabled(true)
+	pane.searchInput.ConnectReturnPressed(func() {
+		backward := gui.QGuiApplication_KeyboardModifiers()&core.Qt__ShiftModifier != 0
+		pane.find(backward)
+	})
+	toolbar.AddWidget(pane.searchInput, 1, 0)
+
+	previousButton := widgets.NewQPushButton2("Previous", nil)
+	previousButton.ConnectClicked(func(bool) { pane.find(true) })
+	toolbar.AddWidget(previousButton, 0, 0)
+
+	nextButton := widgets.NewQPushButton2("Next", nil)
+	nextButton.ConnectClicked(func(bool) { pane.find(false) })
+	toolbar.AddWidget(nextButton, 0, 0)
+
+	copyButton := widgets.NewQPushButton2("Copy", nil)
+	copyButton.SetToolTip("Copy the selection, or everything if nothing is selected")
+	copyButton.ConnectClicked(func(bool) { pane.copyText() })
+	toolbar.AddWidget(copyButton, 0, 0)
+
+	saveButton := widgets.NewQPushButton2("Save...", nil)
+	saveButton.ConnectClicked(func(bool) { pane.saveToFile() })
+	toolbar.AddWidget(saveButton, 0, 0)
+
+	clearButton := widgets.NewQPushButton2("Clear", nil)
+	clearButton.ConnectClicked(func(bool) { pane.clearText() })
+	toolbar.AddWidget(clearButton, 0, 0)
+
+	layout := widgets.NewQVBoxLayout()
+	layout.SetContentsMargins(2, 2, 2, 2)
+	layout.AddLayout(toolbar, 0)
+	layout.AddWidget(view, 1, 0)
+	pane.SetLayout(layout)
+
+	outputPanes = append(outputPanes, pane)
+	return pane
+}
+
+// newLogPane creates a pane around a read-only log view
+func newLogPane(name string) *OutputPane {
+	view := widgets.NewQPlainTextEdit(nil)
+	view.SetReadOnly(true)
+	view.SetUndoRedoEnabled(false)
+	view.SetLineWrapMode(widgets.QPlainTextEdit__WidgetWidth)
+	return NewOutputPane(name, view)
+}
+
+// Append queues text exactly as given
+func (p *OutputPane) Append(text string) {
+	if text == "" {
+		return
+	}
+	p.pendingLock.Lock()
+	defer p.pendingLock.Unlock()
+	p.pendingText = append(p.pendingText, text...)
+	if excess := len(p.pendingText) - maxPendingOutput; excess > 0 {
+		for excess < len(p.pendingText) && !utf8.RuneStart(p.pendingText[excess]) {
+			excess++
+		}
+		p.pendingText = append(p.pendingText[:0], p.pendingText[excess:]...)
+	}
+}
+
+// Log queues a message and ends it with a newline if it has none
+func (p *OutputPane) Log(message string) {
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	p.Append(message)
+}
+
+// Clear queues removing everything shown so far
+func (p *OutputPane) Clear() {
+	p.pendingLock.Lock()
+	defer p.pendingLock.Unlock()
+	p.pendingText = p.pendingText[:0]
+	p.pendingClear = true
+}
+
+// flush applies the queued changes, it must run on the UI thread
+func (p *OutputPane) flush() {
+	p.pendingLock.Lock()
+	text, clear := string(p.pendingText), p.pendingClear
+	p.pendingText = p.pendingText[:0]
+	p.pendingClear = false
+	p.pendingLock.Unlock()
+
+	if clear {
+		p.clearText()
+	}
+	if text != "" {
+		p.appendText(text)
+	}
+}
+
+// reveal brings the pane's tab to the front
+func (p *OutputPane) reveal() {
+	if bottomPanel != nil {
+		bottomPanel.SetCurrentWidget(p)
+	}
+}
+
+// setScrollback limits the pane to the last lines lines, 0 means unlimited
+func (p *OutputPane) setScrollback(lines int) {
+	p.view.SetMaximumBlockCount(lines)
+}
+
+// appendAtEnd adds text to the end of the view, following it if the view
+// was scrolled to the bottom
+func (p *OutputPane) appendAtEnd(text string) {
+	scrollBar := p.view.VerticalScrollBar()
+	atBottom := scrollBar.Value() >= scrollBar.Maximum()
+
+	cursor := gui.NewQTextCursor2(p.view.Document())
+	cursor.MovePosition(gui.QTextCursor__End, gui.QTextCursor__MoveAnchor, 1)
+	cursor.InsertText(text)
+
+	if atBottom {
+		scrollBar.SetValue(scrollBar.Maximum())
+	}
+}
+
+// find selects the next match of the search text, wrapping around at the end
+func (p *OutputPane) find(backward bool) {
+	text := p.searchInput.Text()
+	if text == "" {
+		return
+	}
+
+	var flags gui.QTextDocument__FindFlag
+	if backward {
+		flags |= gui.QTextDocument__FindBackward
+	}
+	if p.view.Find(text, flags) {
+		p.searchInput.SetStyleSheet("")
+		return
+	}
+
+	// Wrap around and try once more from the other end
+	cursor := p.view.TextCursor()
+	if backward {
+		cursor.MovePosition(gui.QTextCursor__End, gui.QTextCursor__MoveAnchor, 1)
+	} else {
+		cursor.MovePosition(gui.QTextCursor__Start, gui.QTextCursor__MoveAnchor, 1)
+	}
+	p.view.SetTextCursor(cursor)
+	if !p.view.Find(text, flags) {
+		p.searchInput.SetStyleSheet(errorInputStyle())
+		return
+	}
+	p.searchInput.SetStyleSheet("")
+}
+
+// copyText copies the selection, or the whole pane if nothing is selected
+func (p *OutputPane) copyText() {
+	if p.view.TextCursor().HasSelection() {
+		p.view.Copy()
+		return
+	}
+	gui.QGuiApplication_Clipboard().SetText(p.view.ToPlainText(), gui.QClipboard__Clipboard)
+}
+
+// saveToFile writes the pane's contents to a file chosen by the user
+func (p *OutputPane) saveToFile() {
+	defaultName := filepath.Join(projectRoot(), strings.ToLower(strings.ReplaceAll(p.name, " ", "-"))+".log")
+
+	path := widgets.QFileDialog_GetSaveFileName(mainWindow, "Save "+p.name, defaultName,
+		"Log Files (*.log *.txt);;All Files (*)", "", 0)
+	if path == "" {
+		return
+	}
+
+	if err := os.WriteFile(path, []byte(p.view.ToPlainText()), 0644); err != nil {
+		widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Failed to save %s: %v", p.name, err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+}
+
+// createBottomPanel builds the Build, Output, Debug Console and Search tabs
+func createBottomPanel() *widgets.QTabWidget {
+	bottomPanel = widgets.NewQTabWidget(nil)
+	bottomPanel.SetDocumentMode(true)
+
+	// Assembler and export messages
+	buildLog = newLogPane("Build")
+	bottomPanel.AddTab(buildLog, "Build")
+
+	// Program console (stdout and stdin)
+	console = NewConsoleWidget()
+	programOutput = NewOutputPane("Output", console.QPlainTextEdit)
+	programOutput.appendText = console.AppendOutput
+	programOutput.clearText = console.ClearConsole
+	outputIndex := bottomPanel.AddTab(programOutput, "Output")
+	bottomPanel.SetTabToolTip(outputIndex, "Program console: Ctrl+C interrupts, Ctrl+D sends EOF")
+
+	// Debugger messages and the debug console command line
+	debugLog = newLogPane("Debug Console")
+	debugLog.Layout().AddWidget(newDebugReplInput())
+	bottomPanel.AddTab(debugLog, "Debug Console")
+
+	// Find in Project results
+	projectSearch = NewProjectSearchPanel()
+	bottomPanel.AddTab(projectSearch, "Search")
+
+	applyOutputPreferences()
+	bottomPanel.SetCurrentWidget(programOutput)
+	return bottomPanel
+}
+
+// applyOutputPreferences applies the font and scrollback settings to every pane
+func applyOutputPreferences() {
+	tFont := gui.NewQFont()
+	tFont.SetFamily(preferences.EditorSettings.FontFamily)
+	tFont.SetPointSize(preferences.EditorSettings.TFontSize)
+	tFont.SetFixedPitch(true)
+	tMetrics := gui.NewQFontMetrics(tFont)
+
+	for _, pane := range outputPanes {
+		pane.view.SetFont(tFont)
+		pane.view.SetTabStopWidth(preferences.EditorSettings.TabWidth * tMetrics.HorizontalAdvance(" ", 0))
+	}
+
+	buildLog.setScrollback(preferences.OutputSettings.BuildScrollback)
+	programOutput.setScrollback(preferences.OutputSettings.OutputScrollback)
+	debugLog.setScrollback(preferences.OutputSettings.DebugScrollback)
+}
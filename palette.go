@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// maxRecentCommands is how many commands the palette remembers
+const maxRecentCommands = 10
+
+// paletteEntry is one choice of the command palette
+type paletteEntry struct {
+	key    string // Remembered among the recent commands, empty if not remembered
+	label  string
+	detail string // Shortcut, path or line shown on the right
+	run    func() // nil for hints
+}
+
+// CommandPalette is the Ctrl+Shift+P popup that searches every command.
+// Typing ":" goes to a line and "@" to a symbol of the active file.
+type CommandPalette struct {
+	*widgets.QDialog
+	input   *widgets.QLineEdit
+	list    *widgets.QTreeWidget
+	entries []paletteEntry // In list order
+}
+
+var commandPalette *CommandPalette
+
+// NewCommandPalette creates the command palette popup
+func NewCommandPalette() *CommandPalette {
+	palette := &CommandPalette{QDialog: widgets.NewQDialog(mainWindow, core.Qt__Popup)}
+
+	palette.input = widgets.NewQLineEdit(nil)
+	palette.input.SetPlaceholderText("Type a command, : and a line number, or @ and a symbol")
+	palette.input.ConnectTextChanged(func(string) { palette.refresh() })
+	palette.input.ConnectReturnPressed(func() { palette.runEntry(palette.list.IndexOfTopLevelItem(palette.list.CurrentItem())) })
+	palette.input.ConnectKeyPressEvent(palette.keyPress)
+
+	palette.list = widgets.NewQTreeWidget(nil)
+	palette.list.SetColumnCount(2)
+	palette.list.SetHeaderHidden(true)
+	palette.list.SetRootIsDecorated(false)
+	palette.list.SetUniformRowHeights(true)
+	palette.list.SetFocusPolicy(core.Qt__NoFocus)
+	palette.list.ConnectItemActivated(func(item *widgets.QTreeWidgetItem, column int) {
+		palette.runEntry(palette.list.IndexOfTopLevelItem(item))
+	})
+
+	layout := widgets.NewQVBoxLayout()
+	layout.SetContentsMargins(4, 4, 4, 4)
+	layout.AddWidget(palette.input, 0, 0)
+	layout.AddWidget(palette.list, 1, 0)
+	palette.SetLayout(layout)
+	palette.Resize2(600, 360)
+
+	return palette
+}
+
+// showCommandPalette opens the palette at the top of the main window,
+// starting with some text such as ":" for Go to Line
+func showCommandPalette(text string) {
+	if commandPalette == nil {
+		commandPalette = NewCommandPalette()
+	}
+	palette := commandPalette
+	palette.Move(mainWindow.MapToGlobal(core.NewQPoint2((mainWindow.Width()-palette.Width())/2, mainWindow.MenuBar().Height())))
+	palette.input.SetText(text)
+	palette.refresh() // Text may be unchanged since the last time
+	palette.Show()
+	palette.ActivateWindow()
+	palette.input.SetFocus2()
+}
+
+// keyPress moves through the list while the focus stays in the input
+func (palette *CommandPalette) keyPress(event *gui.QKeyEvent) {
+	row := palette.list.IndexOfTopLevelItem(palette.list.CurrentItem())
+	switch core.Qt__Key(event.Key()) {
+	case core.Qt__Key_Up:
+		palette.selectRow(row - 1)
+	case core.Qt__Key_Down:
+		palette.selectRow(row + 1)
+	case core.Qt__Key_PageUp:
+		palette.selectRow(row - 10)
+	case core.Qt__Key_PageDown:
+		palette.selectRow(row + 10)
+	default:
+		palette.input.KeyPressEventDefault(event)
+	}
+}
+
+func (palette *CommandPalette) selectRow(row int) {
+	count := palette.list.TopLevelItemCount()
+	if count == 0 {
+		return
+	}
+	row = max(0, min(row, count-1))
+	palette.list.SetCurrentItem(palette.list.TopLevelItem(row))
+}
+
+// refresh lists the entries matching the input
+func (palette *CommandPalette) refresh() {
+	text := palette.input.Text()
+	switch {
+	case strings.HasPrefix(text, ":"):
+		palette.entries = lineEntries(strings.TrimSpace(text[1:]))
+	case strings.HasPrefix(text, "@"):
+		palette.entries = rankEntries(symbolEntries(), strings.TrimSpace(text[1:]), false)
+	default:
+		palette.entries = rankEntries(commandEntries(), strings.TrimSpace(strings.TrimPrefix(text, ">")), true)
+	}
+
+	palette.list.Clear()
+	for _, entry := range palette.entries {
+		item := widgets.NewQTreeWidgetItem(0)
+		item.SetText(0, entry.label)
+		item.SetText(1, entry.detail)
+		item.SetTextAlignment(1, int(core.Qt__AlignRight|core.Qt__AlignVCenter))
+		palette.list.AddTopLevelItem(item)
+	}
+	palette.list.ResizeColumnToContents(0)
+	palette.selectRow(0)
+}
+
+// runEntry closes the palette and runs an entry, remembering it
+func (palette *CommandPalette) runEntry(row int) {
+	if row < 0 || row >= len(palette.entries) || palette.entries[row].run == nil {
+		return
+	}
+	entry := palette.entries[row]
+	palette.Hide()
+	if entry.key != "" {
+		rememberCommand(entry.key)
+	}
+	entry.run()
+}
+
+// rememberCommand moves a command to the front of the recent commands
+func rememberCommand(key string) {
+	recent := []string{key}
+	for _, other := range preferences.RecentCommands {
+		if other != key && len(recent) < maxRecentCommands {
+			recent = append(recent, other)
+		}
+	}
+	preferences.RecentCommands = recent
+	if err := SavePreferences(); err != nil {
+		fmt.Printf("Failed to save recent commands: %v\n", err)
+	}
+}
+
+// commandEntries lists every command, the themes and the recent files
+func commandEntries() []paletteEntry {
+	var entries []paletteEntry
+	for _, c := range commands {
+		if !c.action.IsEnabled() {
+			continue
+		}
+		entries = append(entries, paletteEntry{
+			key:    c.id,
+			label:  commandLabel(c),
+			detail: c.action.Shortcut().ToString(gui.QKeySequence__NativeText),
+			run:    c.action.Trigger,
+		})
+	}
+
+	entries = append(entries, paletteEntry{
+		key:   "theme.toggle",
+		label: "Theme: Toggle Light and Dark",
+		run: func() {
+			if activeTheme.Dark {
+				SetTheme(ThemeLight)
+			} else {
+				SetTheme(ThemeDark)
+			}
+		},
+	})
+	for _, name := range themeNames() {
+		entry := paletteEntry{key: "theme:" + name, label: "Theme: " + name, run: func() { SetTheme(name) }}
+		if name == preferences.ThemeSettings.ThemeName {
+			entry.detail = "current"
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, path := range preferences.RecentFiles {
+		entries = append(entries, paletteEntry{
+			label:  "Open Recent: " + filepath.Base(path),
+			detail: path,
+			run:    func() { openFile(path) },
+		})
+	}
+	return entries
+}
+
+// symbolEntries lists the symbols of the active file
+func symbolEntries() []paletteEntry {
+	if editor == nil {
+		return nil
+	}
+	var entries []paletteEntry
+	for _, symbol := range outlineEntries(editor.ToPlainText()) {
+		entries = append(entries, paletteEntry{
+			label:  symbol.name,
+			detail: fmt.Sprintf("%s, line %d", symbol.kindName(), symbol.line+1),
+			run:    func() { editor.selectRange(symbol.line, symbol.column, utf16Length(symbol.name)) },
+		})
+	}
+	return entries
+}
+
+// lineEntries offers to go to the typed line of the active file
+func lineEntries(text string) []paletteEntry {
+	if editor == nil {
+		return []paletteEntry{{label: "Open a file to go to a line"}}
+	}
+	lines := editor.BlockCount()
+	line, err := strconv.Atoi(text)
+	if err != nil || line < 1 || line > lines {
+		return []paletteEntry{{label: fmt.Sprintf("Type a line number between 1 and %d", lines)}}
+	}
+	return []paletteEntry{{
+		label:  fmt.Sprintf("Go to line %d", line),
+		detail: filepath.Base(currentFilePath),
+		run:    func() { editor.selectRange(line-1, 0, 0) },
+	}}
+}
+
+// rankEntries keeps the entries matching a query, best matches first. With
+// no query, recently used entries come first when recent is set.
+func rankEntries(entries []paletteEntry, query string, recent bool) []paletteEntry {
+	recentRank := make(map[string]int)
+	if recent {
+		for i, key := range preferences.RecentCommands {
+			recentRank[key] = maxRecentCommands - i
+		}
+	}
+
+	type rankedEntry struct {
+		entry paletteEntry
+		score int
+	}
+	var ranked []rankedEntry
+	for _, entry := range entries {
+		score, ok := fuzzyScore(query, entry.label)
+		if !ok {
+			continue
+		}
+		ranked = append(ranked, rankedEntry{entry, score*maxRecentCommands + recentRank[entry.key]})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+
+	matches := make([]paletteEntry, len(ranked))
+	for i, r := range ranked {
+		matches[i] = r.entry
+	}
+	return matches
+}
+
+// fuzzyScore matches the characters of a pattern in order within a text,
+// ignoring case and spaces, so "fsa" finds "File: Save As". Characters at
+// the start of words and runs of consecutive characters score higher.
+func fuzzyScore(pattern, text string) (int, bool) {
+	var wanted []rune
+	for _, r := range pattern {
+		if !unicode.IsSpace(r) {
+			wanted = append(wanted, unicode.ToLower(r))
+		}
+	}
+
+	runes := []rune(text)
+	score, matched, previous := 0, 0, -2
+	for i := 0; i < len(runes) && matched < len(wanted); i++ {
+		if unicode.ToLower(runes[i]) != wanted[matched] {
+			continue
+		}
+		score++
+		if i == previous+1 {
+			score += 5
+		}
+		if i == 0 || !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]) {
+			score += 10
+		}
+		previous = i
+		matched++
+	}
+	if matched < len(wanted) {
+		return 0, false
+	}
+	return score, true
+}
@@ -14,6 +14,7 @@ import (
 type UserPreferences struct {
 	LastOpenedProject string   `json:"lastOpenedProject"`
 	RecentFiles       []string `json:"recentFiles"`
+	RecentCommands    []string `json:"recentCommands,omitempty"` // Command palette entries, most recent first
 	EditorSettings    struct {
 		FontFamily      string `json:"fontFamily"`
 		FontSize        int    `json:"fontSize"`
@@ -22,6 +23,11 @@ type UserPreferences struct {
 		ShowLineNumbers bool   `json:"showLineNumbers"`
 		WrapText        bool   `json:"wrapText"`
 	} `json:"editorSettings"`
+	OutputSettings struct {
+		BuildScrollback  int `json:"buildScrollback"` // In lines, 0 means unlimited
+		OutputScrollback int `json:"outputScrollback"`
+		DebugScrollback  int `json:"debugScrollback"`
+	} `json:"outputSettings"`
 	WindowSettings struct {
 		Width  int `json:"width"`
 		Height int `json:"height"`
@@ -29,12 +35,14 @@ type UserPreferences struct {
 		Y      int `json:"y"`
 	} `json:"windowSettings"`
 	ThemeSettings struct {
-		DarkMode            bool        `json:"darkMode"`
-		ThemeName           string      `json:"themeName"`
-		LineNumberAreaColor *gui.QColor `json:"lineNumberAreaColor"`
+		DarkMode     bool          `json:"darkMode"`
+		ThemeName    string        `json:"themeName"`
+		SyntaxScheme *SyntaxScheme `json:"syntaxScheme,omitempty"` // nil uses the theme's colours
 	} `json:"themeSettings"`
-	AutoSaveEnabled  bool `json:"autoSaveEnabled"`
-	AutoSaveInterval int  `json:"autoSaveInterval"` // In seconds
+	AutoSaveEnabled  bool               `json:"autoSaveEnabled"`
+	AutoSaveInterval int                `json:"autoSaveInterval"`    // In seconds
+	Formatter        *FormatterSettings `json:"formatter,omitempty"` // nil uses the defaults
+	Keybindings      KeybindingSettings `json:"keybindings"`
 }
 
 var preferences UserPreferences
@@ -63,11 +71,12 @@ func InitPreferences() error {
 		return SavePreferences()
 	}
 
-	// Load existing preferences
+	// Load existing preferences, settings missing from the file keep their defaults
 	data, err := os.ReadFile(preferencesPath)
 	if err != nil {
 		return fmt.Errorf("failed to read preferences file: %v", err)
 	}
+	preferences = getDefaultPreferences()
 
 	if err := json.Unmarshal(data, &preferences); err != nil {
 		return fmt.Errorf("failed to parse preferences file: %v", err)
@@ -91,6 +100,11 @@ func getDefaultPreferences() UserPreferences {
 	prefs.EditorSettings.ShowLineNumbers = true
 	prefs.EditorSettings.WrapText = false
 
+	// Default output pane scrollback
+	prefs.OutputSettings.BuildScrollback = 5000
+	prefs.OutputSettings.OutputScrollback = 10000
+	prefs.OutputSettings.DebugScrollback = 5000
+
 	// Default window settings
 	prefs.WindowSettings.Width = 1200
 	prefs.WindowSettings.Height = 800
@@ -99,8 +113,7 @@ func getDefaultPreferences() UserPreferences {
 
 	// Default theme settings
 	prefs.ThemeSettings.DarkMode = false
-	prefs.ThemeSettings.ThemeName = "default"
-	prefs.ThemeSettings.LineNumberAreaColor = gui.NewQColor3(240, 240, 240, 255)
+	prefs.ThemeSettings.ThemeName = ThemeLight
 
 	return prefs
 }
@@ -164,16 +177,28 @@ func SetEditorSettings(fontFamily string, fontSize, tFontSize, tabWidth int, sho
 	SavePreferences()
 }
 
+func SetOutputScrollback(build, output, debug int) {
+	preferences.OutputSettings.BuildScrollback = build
+	preferences.OutputSettings.OutputScrollback = output
+	preferences.OutputSettings.DebugScrollback = debug
+	SavePreferences()
+}
+
 func SetAutoSave(enabled bool, interval int) {
 	preferences.AutoSaveEnabled = enabled
 	preferences.AutoSaveInterval = interval
 	SavePreferences()
 }
 
+func SetFormatterSettings(settings FormatterSettings) {
+	preferences.Formatter = &settings
+	SavePreferences()
+}
+
 func showPreferencesDialog() {
 	dialog := widgets.NewQDialog(mainWindow, 0)
 	dialog.SetWindowTitle("Preferences")
-	dialog.Resize2(500, 400)
+	dialog.Resize2(600, 640)
 
 	// Create tabbed interface
 	tabs := widgets.NewQTabWidget(dialog)
@@ -187,10 +212,13 @@ func showPreferencesDialog() {
 	editorTab := createEditorSettingsTab()
 	themeTab := createThemeSettingsTab()
 	generalTab := createGeneralSettingsTab()
+	formattingTab := createFormattingSettingsTab()
 
 	tabs.AddTab(generalTab, "General")
 	tabs.AddTab(editorTab, "Editor")
+	tabs.AddTab(formattingTab, "Formatting")
 	tabs.AddTab(themeTab, "Appearance")
+	tabs.AddTab(createKeybindingsSettingsTab(), "Keyboard Shortcuts")
 
 	// Button box
 	buttonBox := widgets.NewQDialogButtonBox2(core.Qt__Horizontal, dialog)
@@ -220,6 +248,15 @@ var (
 	themeCombo              *widgets.QComboBox
 	autoSaveCheck           *widgets.QCheckBox
 	autoSaveIntervalSpinner *widgets.QSpinBox
+	buildScrollbackSpinner  *widgets.QSpinBox
+	outputScrollbackSpinner *widgets.QSpinBox
+	debugScrollbackSpinner  *widgets.QSpinBox
+	mnemonicColumnSpinner   *widgets.QSpinBox
+	operandColumnSpinner    *widgets.QSpinBox
+	commentColumnSpinner    *widgets.QSpinBox
+	registerNamesCombo      *widgets.QComboBox
+	hexDigitsCombo          *widgets.QComboBox
+	formatOnSaveCheck       *widgets.QCheckBox
 )
 
 func createEditorSettingsTab() *widgets.QWidget {
@@ -267,6 +304,83 @@ func createEditorSettingsTab() *widgets.QWidget {
 	wrapTextCheck.SetChecked(preferences.EditorSettings.WrapText)
 	layout.AddRow3("Wrap Text:", wrapTextCheck)
 
+	// Scrollback of the bottom panel tabs
+	scrollbackSpinner := func(value int) *widgets.QSpinBox {
+		spinner := widgets.NewQSpinBox(nil)
+		spinner.SetRange(0, 1000000)
+		spinner.SetSingleStep(1000)
+		spinner.SetSpecialValueText("Unlimited")
+		spinner.SetSuffix(" lines")
+		spinner.SetValue(value)
+		return spinner
+	}
+	buildScrollbackSpinner = scrollbackSpinner(preferences.OutputSettings.BuildScrollback)
+	layout.AddRow3("Build Scrollback:", buildScrollbackSpinner)
+	outputScrollbackSpinner = scrollbackSpinner(preferences.OutputSettings.OutputScrollback)
+	layout.AddRow3("Output Scrollback:", outputScrollbackSpinner)
+	debugScrollbackSpinner = scrollbackSpinner(preferences.OutputSettings.DebugScrollback)
+	layout.AddRow3("Debug Console Scrollback:", debugScrollbackSpinner)
+
+	return tab
+}
+
+// Choices of the formatting combo boxes, in the order they are listed
+var (
+	registerNameChoices = []string{"", registerNamesABI, registerNamesX}
+	hexDigitChoices     = []string{"", "lower", "upper"}
+)
+
+func createFormattingSettingsTab() *widgets.QWidget {
+	tab := widgets.NewQWidget(nil, 0)
+	layout := widgets.NewQFormLayout(nil)
+	tab.SetLayout(layout)
+
+	settings := userFormatterSettings()
+
+	// Columns
+	columnSpinner := func(value int, zero string) *widgets.QSpinBox {
+		spinner := widgets.NewQSpinBox(nil)
+		spinner.SetRange(0, 120)
+		spinner.SetSpecialValueText(zero)
+		spinner.SetValue(value)
+		return spinner
+	}
+	mnemonicColumnSpinner = columnSpinner(settings.MnemonicColumn, "0")
+	layout.AddRow3("Mnemonic Column:", mnemonicColumnSpinner)
+	operandColumnSpinner = columnSpinner(settings.OperandColumn, "After mnemonic")
+	layout.AddRow3("Operand Column:", operandColumnSpinner)
+	commentColumnSpinner = columnSpinner(settings.CommentColumn, "After code")
+	layout.AddRow3("Comment Column:", commentColumnSpinner)
+
+	// Register names
+	registerNamesCombo = widgets.NewQComboBox(nil)
+	registerNamesCombo.AddItems([]string{"Keep as written", "ABI names (a0, sp)", "Numbers (x10, x2)"})
+	for i, choice := range registerNameChoices {
+		if choice == settings.RegisterNames {
+			registerNamesCombo.SetCurrentIndex(i)
+		}
+	}
+	layout.AddRow3("Register Names:", registerNamesCombo)
+
+	// Hexadecimal literals
+	hexDigitsCombo = widgets.NewQComboBox(nil)
+	hexDigitsCombo.AddItems([]string{"Keep as written", "Lowercase (0xff)", "Uppercase (0xFF)"})
+	for i, choice := range hexDigitChoices {
+		if choice == settings.HexDigits {
+			hexDigitsCombo.SetCurrentIndex(i)
+		}
+	}
+	layout.AddRow3("Hex Digits:", hexDigitsCombo)
+
+	// Format on save
+	formatOnSaveCheck = widgets.NewQCheckBox(nil)
+	formatOnSaveCheck.SetChecked(settings.FormatOnSave)
+	layout.AddRow3("Format on Save:", formatOnSaveCheck)
+
+	note := widgets.NewQLabel2("A \"formatter\" entry in a project's .riscgov_ide/project.json overrides these settings.", nil, 0)
+	note.SetWordWrap(true)
+	layout.AddRow3("", note)
+
 	return tab
 }
 
@@ -278,6 +392,7 @@ func createGeneralSettingsTab() *widgets.QWidget {
 	// Auto-save
 	autoSaveCheck = widgets.NewQCheckBox(nil)
 	autoSaveCheck.SetChecked(preferences.AutoSaveEnabled)
+	autoSaveCheck.SetToolTip("Periodically back up unsaved changes so they can be recovered after a crash")
 	layout.AddRow3("Enable Auto-save:", autoSaveCheck)
 
 	// Auto-save interval
@@ -324,14 +439,40 @@ func savePreferencesFromUI() {
 		wrapTextCheck.IsChecked(),
 	)
 
+	// Save output pane settings
+	SetOutputScrollback(
+		buildScrollbackSpinner.Value(),
+		outputScrollbackSpinner.Value(),
+		debugScrollbackSpinner.Value(),
+	)
+
+	// Save formatter settings
+	SetFormatterSettings(FormatterSettings{
+		MnemonicColumn: mnemonicColumnSpinner.Value(),
+		OperandColumn:  operandColumnSpinner.Value(),
+		CommentColumn:  commentColumnSpinner.Value(),
+		RegisterNames:  registerNameChoices[registerNamesCombo.CurrentIndex()],
+		HexDigits:      hexDigitChoices[hexDigitsCombo.CurrentIndex()],
+		FormatOnSave:   formatOnSaveCheck.IsChecked(),
+	})
+
 	// Save theme settings
-	SetTheme(themeCombo.CurrentText() == "Dark")
+	preferences.ThemeSettings.SyntaxScheme = editedSyntaxScheme
+	SetTheme(themeCombo.CurrentText())
+
+	// Save key bindings
+	SetKeybindings(editedKeybindings)
 
 	// Save auto-save settings
 	SetAutoSave(
 		autoSaveCheck.IsChecked(),
 		autoSaveIntervalSpinner.Value(),
 	)
+	if preferences.AutoSaveEnabled && preferences.AutoSaveInterval > 0 {
+		setupAutoSaveTimer()
+	} else if autoSaveTimer != nil {
+		autoSaveTimer.Stop()
+	}
 
 	// Apply settings to current editor session
 	applyPreferencesToEditor()
@@ -340,48 +481,47 @@ func savePreferencesFromUI() {
 // Apply preferences to the editor
 func applyPreferencesToEditor() {
 
-	// Apply theme
+	// Apply theme and syntax colours
 	applyTheme(preferences.ThemeSettings.ThemeName)
 
-	// Force update of line number area
-	editor.updateLineNumberAreaWidth()
-	editor.lineNumberArea.Update()
+	// Apply editor settings to every open tab
+	for _, e := range openEditors {
+		applyPreferencesToCodeEditor(e)
+	}
 
+	// Apply font and scrollback settings to the bottom panel
+	applyOutputPreferences()
+}
+
+// applyPreferencesToCodeEditor applies the font, tab width and wrapping to one editor
+func applyPreferencesToCodeEditor(e *CodeEditor) {
 	// Apply font settings
 	font := gui.NewQFont()
 	font.SetFamily(preferences.EditorSettings.FontFamily)
 	font.SetPointSize(preferences.EditorSettings.FontSize)
 	font.SetFixedPitch(true)
-	editor.SetFont(font)
+	e.SetFont(font)
 
 	// Set tab width
 	metrics := gui.NewQFontMetrics(font)
-	editor.SetTabStopWidth(preferences.EditorSettings.TabWidth * metrics.HorizontalAdvance(" ", 0))
-
-	// Apply font settings
-	tFont := gui.NewQFont()
-	tFont.SetFamily(preferences.EditorSettings.FontFamily)
-	tFont.SetPointSize(preferences.EditorSettings.TFontSize)
-	tFont.SetFixedPitch(true)
-	terminalOutput.SetFont(tFont)
-	terminalInput.SetFont(tFont)
-
-	// Set tab width
-	tMetrics := gui.NewQFontMetrics(tFont)
-	terminalOutput.SetTabStopWidth(preferences.EditorSettings.TabWidth * tMetrics.HorizontalAdvance(" ", 0))
+	e.SetTabStopWidth(preferences.EditorSettings.TabWidth * metrics.HorizontalAdvance(" ", 0))
 
 	// Apply text wrapping
 	if preferences.EditorSettings.WrapText {
-		editor.SetLineWrapMode(widgets.QPlainTextEdit__WidgetWidth)
+		e.SetLineWrapMode(widgets.QPlainTextEdit__WidgetWidth)
 	} else {
-		editor.SetLineWrapMode(widgets.QPlainTextEdit__NoWrap)
+		e.SetLineWrapMode(widgets.QPlainTextEdit__NoWrap)
 	}
+
+	// Force update of line number area
+	e.updateLineNumberAreaWidth()
+	e.lineNumberArea.Update()
 }
 
-// Initialize from preferences
-func initializeFromPreferences() {
-	// Initialize preferences system
-	err := InitPreferences()
+// Initialize from preferences once InitPreferences has loaded them, on the
+// main thread as it restores widgets
+func initializeFromPreferences(err error) {
+	// Keep the default theme if the preferences could not be loaded
 	if err != nil {
 		fmt.Printf("Failed to initialize preferences: %v\n", err)
 		return
@@ -398,6 +538,10 @@ func initializeFromPreferences() {
 		fileTree.SetRootIndex(fileSystemModel.Index2(currentProjectPath, 0))
 		fileTree.Expand(fileSystemModel.Index2(currentProjectPath, 0))
 
+		if err := LoadProjectSettings(currentProjectPath); err != nil {
+			fmt.Printf("Failed to load project settings: %v\n", err)
+		}
+
 		// Open most recent file if available
 		if len(preferences.RecentFiles) > 0 {
 			openFile(preferences.RecentFiles[0])
@@ -419,11 +563,8 @@ func setupAutoSaveTimer() {
 	}
 
 	autoSaveTimer = core.NewQTimer(nil)
-	autoSaveTimer.ConnectTimeout(func() {
-		if currentFilePath != "" {
-			saveCurrentFile()
-		}
-	})
+	// Back up unsaved buffers, the user's files are only written on save
+	autoSaveTimer.ConnectTimeout(autoSaveRecovery)
 
 	// Convert seconds to milliseconds
 	autoSaveTimer.Start(preferences.AutoSaveInterval * 1000)
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+const (
+	maxSearchFileSize = 2 << 20 // Larger files are skipped
+	maxSearchHits     = 5000
+	maxPreviewLength  = 200
+)
+
+// projectFile is a file with matches, text is the open buffer if the file
+// is open in a tab
+type projectFile struct {
+	path    string
+	text    string
+	matches []textMatch
+}
+
+// projectHit is one result line in the Find in Project panel
+type projectHit struct {
+	path   string
+	line   int // 0-based
+	column int // Qt position within the line
+	length int
+}
+
+// ProjectSearchPanel is the Find in Project tab of the bottom panel
+type ProjectSearchPanel struct {
+	*widgets.QWidget
+	findInput    *widgets.QLineEdit
+	replaceInput *widgets.QLineEdit
+	matchCase    *widgets.QCheckBox
+	wholeWord    *widgets.QCheckBox
+	regex        *widgets.QCheckBox
+	results      *widgets.QTreeWidget
+	statusLabel  *widgets.QLabel
+	hits         map[uintptr]projectHit
+}
+
+var projectSearch *ProjectSearchPanel
+
+// NewProjectSearchPanel creates the Find in Project panel
+func NewProjectSearchPanel() *ProjectSearchPanel {
+	panel := &ProjectSearchPanel{
+		QWidget: widgets.NewQWidget(nil, 0),
+		hits:    make(map[uintptr]projectHit),
+	}
+
+	// Search row
+	searchRow := widgets.NewQHBoxLayout()
+	searchRow.SetContentsMargins(0, 0, 0, 0)
+
+	panel.findInput = widgets.NewQLineEdit(nil)
+	panel.findInput.SetPlaceholderText("Find in project")
+	panel.findInput.SetClearButtonEnabled(true)
+	panel.findInput.ConnectReturnPressed(func() { panel.search() })
+	searchRow.AddWidget(panel.findInput, 1, 0)
+
+	panel.matchCase = widgets.NewQCheckBox2("Match Case", nil)
+	panel.wholeWord = widgets.NewQCheckBox2("Whole Word", nil)
+	panel.regex = widgets.NewQCheckBox2("Regex", nil)
+	for _, check := range []*widgets.QCheckBox{panel.matchCase, panel.wholeWord, panel.regex} {
+		searchRow.AddWidget(check, 0, 0)
+	}
+
+	searchButton := widgets.NewQPushButton2("Search", nil)
+	searchButton.ConnectClicked(func(bool) { panel.search() })
+	searchRow.AddWidget(searchButton, 0, 0)
+
+	// Replace row
+	replaceRow := widgets.NewQHBoxLayout()
+	replaceRow.SetContentsMargins(0, 0, 0, 0)
+
+	panel.replaceInput = widgets.NewQLineEdit(nil)
+	panel.replaceInput.SetPlaceholderText("Replace ($1 inserts a group in regex mode)")
+	replaceRow.AddWidget(panel.replaceInput, 1, 0)
+
+	replaceButton := widgets.NewQPushButton2("Replace All...", nil)
+	replaceButton.SetToolTip("Preview the replacements before applying them")
+	replaceButton.ConnectClicked(func(bool) { panel.previewReplace() })
+	replaceRow.AddWidget(replaceButton, 0, 0)
+
+	panel.statusLabel = widgets.NewQLabel(nil, 0)
+	replaceRow.AddWidget(panel.statusLabel, 0, 0)
+
+	// Results: one item per file with its matching lines below
+	panel.results = widgets.NewQTreeWidget(nil)
+	panel.results.SetHeaderHidden(true)
+	panel.results.SetUniformRowHeights(true)
+	panel.results.ConnectItemActivated(func(item *widgets.QTreeWidgetItem, column int) {
+		if hit, ok := panel.hits[uintptr(item.Pointer())]; ok {
+			goToProjectHit(hit)
+		}
+	})
+
+	layout := widgets.NewQVBoxLayout()
+	layout.SetContentsMargins(2, 2, 2, 2)
+	layout.AddLayout(searchRow, 0)
+	layout.AddLayout(replaceRow, 0)
+	layout.AddWidget(panel.results, 1, 0)
+	panel.SetLayout(layout)
+
+	return panel
+}
+
+// open reveals the panel, seeded with the editor's selection
+func (panel *ProjectSearchPanel) open() {
+	if selected := editor.TextCursor().SelectedText(); selected != "" && !containsParagraphSeparator(selected) {
+		panel.findInput.SetText(selected)
+	}
+	bottomPanel.SetCurrentWidget(panel)
+	panel.findInput.SetFocus2()
+	panel.findInput.SelectAll()
+}
+
+// options returns the state of the toggles
+func (panel *ProjectSearchPanel) options() searchOptions {
+	return searchOptions{
+		matchCase: panel.matchCase.IsChecked(),
+		wholeWord: panel.wholeWord.IsChecked(),
+		regex:     panel.regex.IsChecked(),
+	}
+}
+
+// scan searches every text file of the project, using the buffers of open
+// files so unsaved changes are found too
+func (panel *ProjectSearchPanel) scan() (*regexp.Regexp, []projectFile, error) {
+	root := currentProjectPath
+	if root == "" {
+		return nil, nil, fmt.Errorf("no project is open")
+	}
+	re, err := compileSearch(panel.findInput.Text(), panel.options())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []projectFile
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		// Skip hidden directories such as .git and .riscgov_ide
+		if entry.IsDir() {
+			if path != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		text, ok := projectFileText(path, entry)
+		if !ok {
+			return nil
+		}
+		if matches := findMatches(re, text); len(matches) > 0 {
+			files = append(files, projectFile{path: path, text: text, matches: matches})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to search project: %v", err)
+	}
+	return re, files, nil
+}
+
+// projectFileText returns the text of a file, or false for binary and very
+// large files
+func projectFileText(path string, entry fs.DirEntry) (string, bool) {
+	if open := editorForPath(path); open != nil {
+		return open.ToPlainText(), true
+	}
+
+	info, err := entry.Info()
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxSearchFileSize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !utf8.Valid(data) || strings.ContainsRune(string(data), 0) {
+		return "", false
+	}
+	return string(data), true
+}
+
+// search lists the matches as file:line with a preview of the line
+func (panel *ProjectSearchPanel) search() {
+	panel.results.Clear()
+	panel.hits = make(map[uintptr]projectHit)
+	if panel.findInput.Text() == "" {
+		panel.statusLabel.SetText("")
+		return
+	}
+
+	_, files, err := panel.scan()
+	if err != nil {
+		panel.statusLabel.SetText(err.Error())
+		return
+	}
+
+	count := panel.showFiles(files)
+	status := fmt.Sprintf("%d matches in %d files", count, len(files))
+	if count > maxSearchHits {
+		status += fmt.Sprintf(" (showing the first %d)", maxSearchHits)
+	}
+	panel.statusLabel.SetText(status)
+}
+
+// showReferences lists the uses of a symbol found by Find All References
+func (panel *ProjectSearchPanel) showReferences(name string, files []projectFile) {
+	panel.results.Clear()
+	panel.hits = make(map[uintptr]projectHit)
+	panel.findInput.SetText(name)
+
+	count := panel.showFiles(files)
+	panel.statusLabel.SetText(fmt.Sprintf("%d references to %s in %d files", count, name, len(files)))
+	bottomPanel.SetCurrentWidget(panel)
+}
+
+// showFiles adds the matches of each file to the results and returns how
+// many matches there are
+func (panel *ProjectSearchPanel) showFiles(files []projectFile) int {
+	total := 0
+	for _, file := range files {
+		relative, err := filepath.Rel(currentProjectPath, file.path)
+		if err != nil {
+			relative = file.path
+		}
+		fileItem := widgets.NewQTreeWidgetItem(0)
+		fileItem.SetText(0, fmt.Sprintf("%s (%d)", relative, len(file.matches)))
+		fileItem.SetToolTip(0, file.path)
+		panel.results.AddTopLevelItem(fileItem)
+
+		for _, hit := range hitsInFile(file) {
+			if total >= maxSearchHits {
+				break
+			}
+			total++
+
+			item := widgets.NewQTreeWidgetItem(0)
+			item.SetText(0, fmt.Sprintf("%s:%d: %s", relative, hit.line+1, linePreview(file.text, hit.line)))
+			fileItem.AddChild(item)
+			panel.hits[uintptr(item.Pointer())] = hit
+		}
+		fileItem.SetExpanded(true)
+	}
+
+	count := 0
+	for _, file := range files {
+		count += len(file.matches)
+	}
+	return count
+}
+
+// hitsInFile turns a file's matches into line and column positions
+func hitsInFile(file projectFile) []projectHit {
+	hits := make([]projectHit, 0, len(file.matches))
+	line, lineStart := 0, 0
+	for _, match := range file.matches {
+		for {
+			newline := strings.IndexByte(file.text[lineStart:], '\n')
+			if newline < 0 || lineStart+newline >= match.byteStart {
+				break
+			}
+			lineStart += newline + 1
+			line++
+		}
+		column := utf16Length(file.text[lineStart:match.byteStart])
+		hits = append(hits, projectHit{path: file.path, line: line, column: column, length: match.end - match.start})
+	}
+	return hits
+}
+
+// linePreview returns a line of text, trimmed for display
+func linePreview(text string, line int) string {
+	lines := strings.SplitN(text, "\n", line+2)
+	if line >= len(lines) {
+		return ""
+	}
+	preview := strings.TrimSpace(lines[line])
+	if runes := []rune(preview); len(runes) > maxPreviewLength {
+		preview = string(runes[:maxPreviewLength]) + "..."
+	}
+	return preview
+}
+
+// goToProjectHit opens the file of a result and selects the match
+func goToProjectHit(hit projectHit) {
+	if openFile(hit.path) {
+		editor.selectRange(hit.line, hit.column, hit.length)
+	}
+}
+
+// previewReplace shows every change a project-wide replace would make and
+// applies the ones the user keeps checked
+func (panel *ProjectSearchPanel) previewReplace() {
+	if panel.findInput.Text() == "" {
+		return
+	}
+	re, files, err := panel.scan()
+	if err != nil {
+		panel.statusLabel.SetText(err.Error())
+		return
+	}
+	if len(files) == 0 {
+		panel.statusLabel.SetText("No matches to replace")
+		return
+	}
+
+	// Work out the replacements of every file
+	replacement := panel.replaceInput.Text()
+	options := panel.options()
+	replacements := make([][]string, len(files))
+	for i, file := range files {
+		replacements[i] = make([]string, len(file.matches))
+		for j, match := range file.matches {
+			replacements[i][j] = replacementFor(re, file.text, match, replacement, options)
+		}
+	}
+
+	// Create dialog
+	dialog := widgets.NewQDialog(mainWindow, 0)
+	dialog.SetWindowTitle("Replace in Project")
+	dialog.Resize2(900, 500)
+	dialogLayout := widgets.NewQVBoxLayout()
+
+	dialogLayout.AddWidget(widgets.NewQLabel2("Uncheck the files that should be left unchanged:", nil, 0), 0, 0)
+
+	preview := widgets.NewQTreeWidget(nil)
+	preview.SetColumnCount(2)
+	preview.SetHeaderLabels([]string{"Before", "After"})
+	fileItems := make([]*widgets.QTreeWidgetItem, len(files))
+	for i, file := range files {
+		newText := applyReplacements(file.text, file.matches, replacements[i])
+
+		fileItem := widgets.NewQTreeWidgetItem(0)
+		fileItem.SetText(0, fmt.Sprintf("%s (%d)", file.path, len(file.matches)))
+		fileItem.SetFlags(fileItem.Flags() | core.Qt__ItemIsUserCheckable)
+		fileItem.SetCheckState(0, core.Qt__Checked)
+		preview.AddTopLevelItem(fileItem)
+		fileItems[i] = fileItem
+
+		for _, change := range changedLines(file.text, newText, file.matches, replacements[i]) {
+			item := widgets.NewQTreeWidgetItem(0)
+			item.SetText(0, change[0])
+			item.SetText(1, change[1])
+			fileItem.AddChild(item)
+		}
+		fileItem.SetExpanded(true)
+	}
+	preview.ResizeColumnToContents(0)
+	dialogLayout.AddWidget(preview, 1, 0)
+
+	buttonBox := widgets.NewQDialogButtonBox2(core.Qt__Horizontal, nil)
+	buttonBox.SetStandardButtons(widgets.QDialogButtonBox__Apply | widgets.QDialogButtonBox__Cancel)
+	buttonBox.Button(widgets.QDialogButtonBox__Apply).ConnectClicked(func(bool) { dialog.Accept() })
+	buttonBox.ConnectRejected(func() { dialog.Reject() })
+	dialogLayout.AddWidget(buttonBox, 0, 0)
+	dialog.SetLayout(dialogLayout)
+
+	if dialog.Exec() != int(widgets.QDialog__Accepted) {
+		return
+	}
+
+	// Apply the checked files: open files are edited in their buffer so the
+	// change can be undone, the others are rewritten on disk
+	changed, replaced := 0, 0
+	for i, file := range files {
+		if fileItems[i].CheckState(0) != core.Qt__Checked {
+			continue
+		}
+		if open := editorForPath(file.path); open != nil {
+			open.replaceMatches(file.matches, replacements[i])
+		} else if err := writeReplacedFile(file.path, applyReplacements(file.text, file.matches, replacements[i])); err != nil {
+			widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Failed to replace in %s: %v", file.path, err),
+				widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+			continue
+		}
+		changed++
+		replaced += len(file.matches)
+	}
+
+	panel.search()
+	panel.statusLabel.SetText(fmt.Sprintf("Replaced %d matches in %d files", replaced, changed))
+}
+
+// applyReplacements returns text with each match replaced
+func applyReplacements(text string, matches []textMatch, replacements []string) string {
+	var builder strings.Builder
+	offset := 0
+	for i, match := range matches {
+		builder.WriteString(text[offset:match.byteStart])
+		builder.WriteString(replacements[i])
+		offset = match.byteEnd
+	}
+	builder.WriteString(text[offset:])
+	return builder.String()
+}
+
+// changedLines pairs each line with matches with the same line after the
+// replacements
+func changedLines(oldText, newText string, matches []textMatch, replacements []string) [][2]string {
+	var changes [][2]string
+	delta, lastLineStart := 0, -1
+	for i, match := range matches {
+		lineStart := strings.LastIndexByte(oldText[:match.byteStart], '\n') + 1
+		if lineStart != lastLineStart {
+			lastLineStart = lineStart
+			changes = append(changes, [2]string{lineAt(oldText, lineStart), lineAt(newText, lineStart+delta)})
+		}
+		delta += len(replacements[i]) - (match.byteEnd - match.byteStart)
+	}
+	return changes
+}
+
+// lineAt returns the line starting at a byte offset
+func lineAt(text string, start int) string {
+	if start > len(text) {
+		return ""
+	}
+	line := text[start:]
+	if end := strings.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	return strings.TrimSpace(line)
+}
+
+// writeReplacedFile rewrites a file that is not open, atomically so a crash
+// during a project-wide replace leaves every file whole. A file deleted
+// since it was searched is not created again.
+func writeReplacedFile(path, text string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(text))
+}
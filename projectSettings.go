@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+// BuildConfiguration selects which artifacts are produced by the export step
+type BuildConfiguration struct {
+	Name          string `json:"name"`
+	ExportListing bool   `json:"exportListing"`
+	ExportSymbols bool   `json:"exportSymbols"`
+	ExportBin     bool   `json:"exportBin"`
+	ExportHex     bool   `json:"exportHex"`
+	ExportMemInit bool   `json:"exportMemInit"`
+	ExportELF     bool   `json:"exportElf"`
+}
+
+// ProjectSettings are stored per project in .riscgov_ide/project.json
+type ProjectSettings struct {
+	ActiveBuild         string               `json:"activeBuild"`
+	BuildConfigurations []BuildConfiguration `json:"buildConfigurations"`
+	Run                 RunConfiguration     `json:"runConfiguration"`
+	Formatter           *FormatterSettings   `json:"formatter,omitempty"` // Overrides the user's formatter settings
+	Folds               map[string][]int     `json:"folds,omitempty"`     // Folded lines by file, relative to the project
+}
+
+var projectSettings ProjectSettings
+
+var projectSettingsPath string
+
+func getDefaultProjectSettings() ProjectSettings {
+	return ProjectSettings{
+		ActiveBuild: "Debug",
+		BuildConfigurations: []BuildConfiguration{
+			{
+				Name:          "Debug",
+				ExportListing: true,
+				ExportSymbols: true,
+			},
+			{
+				Name:          "Release",
+				ExportListing: true,
+				ExportSymbols: true,
+				ExportBin:     true,
+				ExportHex:     true,
+				ExportMemInit: true,
+				ExportELF:     true,
+			},
+		},
+	}
+}
+
+// projectRoot returns the open project directory, falling back to the
+// directory of the current file when no project is open
+func projectRoot() string {
+	if currentProjectPath != "" {
+		return currentProjectPath
+	}
+	if currentFilePath != "" {
+		return filepath.Dir(currentFilePath)
+	}
+	return ""
+}
+
+func LoadProjectSettings(projectDir string) error {
+	projectSettings = getDefaultProjectSettings()
+	projectSettingsPath = ""
+	if projectDir == "" {
+		return nil
+	}
+
+	projectSettingsPath = filepath.Join(projectDir, ".riscgov_ide", "project.json")
+
+	data, err := os.ReadFile(projectSettingsPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read project settings: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &projectSettings); err != nil {
+		return fmt.Errorf("failed to parse project settings: %v", err)
+	}
+
+	return nil
+}
+
+func SaveProjectSettings() error {
+	if projectSettingsPath == "" {
+		return fmt.Errorf("no project is open")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(projectSettingsPath), 0755); err != nil {
+		return fmt.Errorf("failed to create project settings directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(projectSettings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal project settings: %v", err)
+	}
+
+	if err := os.WriteFile(projectSettingsPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write project settings: %v", err)
+	}
+
+	return nil
+}
+
+// activeBuildConfiguration returns the selected build configuration,
+// falling back to the first one if the selection no longer exists
+// checkConfigurationName reports why a name cannot be given to a build
+// configuration. The name is a folder under .riscgov_ide/build, so it
+// must not leave it.
+func checkConfigurationName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%q cannot be used as a folder name", name)
+	}
+	return nil
+}
+
+func activeBuildConfiguration() *BuildConfiguration {
+	for i := range projectSettings.BuildConfigurations {
+		if projectSettings.BuildConfigurations[i].Name == projectSettings.ActiveBuild {
+			return &projectSettings.BuildConfigurations[i]
+		}
+	}
+	if len(projectSettings.BuildConfigurations) == 0 {
+		projectSettings.BuildConfigurations = getDefaultProjectSettings().BuildConfigurations
+	}
+	return &projectSettings.BuildConfigurations[0]
+}
+
+func showBuildConfigurationsDialog() {
+	if projectRoot() == "" {
+		widgets.QMessageBox_Information(mainWindow, "No Project",
+			"Please open a project folder first", widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	if projectSettingsPath == "" {
+		LoadProjectSettings(projectRoot())
+	}
+
+	// Work on a copy so Cancel discards every change
+	configs := append([]BuildConfiguration{}, projectSettings.BuildConfigurations...)
+	selected := 0
+
+	dialog := widgets.NewQDialog(mainWindow, 0)
+	dialog.SetWindowTitle("Build Configurations")
+	dialogLayout := widgets.NewQVBoxLayout()
+	dialog.SetLayout(dialogLayout)
+
+	// Configuration selector
+	configCombo := widgets.NewQComboBox(nil)
+	addButton := widgets.NewQPushButton2("Add...", nil)
+	removeButton := widgets.NewQPushButton2("Remove", nil)
+
+	selectorLayout := widgets.NewQHBoxLayout()
+	selectorLayout.AddWidget(widgets.NewQLabel2("Configuration:", nil, 0), 0, 0)
+	selectorLayout.AddWidget(configCombo, 1, 0)
+	selectorLayout.AddWidget(addButton, 0, 0)
+	selectorLayout.AddWidget(removeButton, 0, 0)
+	dialogLayout.AddLayout(selectorLayout, 0)
+
+	// Artifact checkboxes
+	artifactsGroup := widgets.NewQGroupBox2("Export Artifacts", nil)
+	artifactsLayout := widgets.NewQVBoxLayout()
+	artifactsGroup.SetLayout(artifactsLayout)
+
+	listingCheck := widgets.NewQCheckBox2("Listing file (.lst)", nil)
+	symbolsCheck := widgets.NewQCheckBox2("Symbol map (.map)", nil)
+	binCheck := widgets.NewQCheckBox2("Raw binary (.bin)", nil)
+	hexCheck := widgets.NewQCheckBox2("Intel HEX (.hex)", nil)
+	memCheck := widgets.NewQCheckBox2("Verilog $readmemh (.mem)", nil)
+	elfCheck := widgets.NewQCheckBox2("ELF executable (.elf)", nil)
+	for _, check := range []*widgets.QCheckBox{listingCheck, symbolsCheck, binCheck, hexCheck, memCheck, elfCheck} {
+		artifactsLayout.AddWidget(check, 0, 0)
+	}
+	dialogLayout.AddWidget(artifactsGroup, 0, 0)
+
+	// Keep the copy in sync with the checkboxes of the selected configuration
+	storeChecks := func() {
+		if selected < 0 || selected >= len(configs) {
+			return
+		}
+		configs[selected].ExportListing = listingCheck.IsChecked()
+		configs[selected].ExportSymbols = symbolsCheck.IsChecked()
+		configs[selected].ExportBin = binCheck.IsChecked()
+		configs[selected].ExportHex = hexCheck.IsChecked()
+		configs[selected].ExportMemInit = memCheck.IsChecked()
+		configs[selected].ExportELF = elfCheck.IsChecked()
+	}
+	loadChecks := func() {
+		if selected < 0 || selected >= len(configs) {
+			return
+		}
+		listingCheck.SetChecked(configs[selected].ExportListing)
+		symbolsCheck.SetChecked(configs[selected].ExportSymbols)
+		binCheck.SetChecked(configs[selected].ExportBin)
+		hexCheck.SetChecked(configs[selected].ExportHex)
+		memCheck.SetChecked(configs[selected].ExportMemInit)
+		elfCheck.SetChecked(configs[selected].ExportELF)
+		removeButton.SetEnabled(len(configs) > 1)
+	}
+	refreshCombo := func() {
+		configCombo.BlockSignals(true)
+		configCombo.Clear()
+		for _, config := range configs {
+			configCombo.AddItem(config.Name, core.NewQVariant())
+		}
+		configCombo.SetCurrentIndex(selected)
+		configCombo.BlockSignals(false)
+		loadChecks()
+	}
+
+	for i, config := range configs {
+		if config.Name == activeBuildConfiguration().Name {
+			selected = i
+		}
+	}
+	refreshCombo()
+
+	configCombo.ConnectCurrentIndexChanged(func(index int) {
+		storeChecks()
+		selected = index
+		loadChecks()
+	})
+
+	addButton.ConnectClicked(func(bool) {
+		ok := false
+		name := widgets.QInputDialog_GetText(dialog, "Add Configuration", "Configuration name:",
+			widgets.QLineEdit__Normal, "", &ok, 0, 0)
+		if !ok || name == "" {
+			return
+		}
+		if err := checkConfigurationName(name); err != nil {
+			widgets.QMessageBox_Warning(dialog, "Invalid Name", fmt.Sprintf("Invalid configuration name: %v", err),
+				widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+			return
+		}
+		for _, config := range configs {
+			if config.Name == name {
+				widgets.QMessageBox_Warning(dialog, "Duplicate Name",
+					fmt.Sprintf("A configuration named %q already exists", name),
+					widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+				return
+			}
+		}
+		storeChecks()
+		configs = append(configs, BuildConfiguration{Name: name, ExportListing: true})
+		selected = len(configs) - 1
+		refreshCombo()
+	})
+
+	removeButton.ConnectClicked(func(bool) {
+		if len(configs) <= 1 {
+			return
+		}
+		configs = append(configs[:selected], configs[selected+1:]...)
+		if selected >= len(configs) {
+			selected = len(configs) - 1
+		}
+		refreshCombo()
+	})
+
+	// Button box
+	buttonBox := widgets.NewQDialogButtonBox2(core.Qt__Horizontal, nil)
+	buttonBox.SetStandardButtons(widgets.QDialogButtonBox__Ok | widgets.QDialogButtonBox__Cancel)
+	buttonBox.ConnectAccepted(func() { dialog.Accept() })
+	buttonBox.ConnectRejected(func() { dialog.Reject() })
+	dialogLayout.AddWidget(buttonBox, 0, 0)
+
+	if dialog.Exec() != int(widgets.QDialog__Accepted) {
+		return
+	}
+
+	storeChecks()
+	projectSettings.BuildConfigurations = configs
+	projectSettings.ActiveBuild = configs[selected].Name
+	if err := SaveProjectSettings(); err != nil {
+		widgets.QMessageBox_Critical(mainWindow, "Error",
+			fmt.Sprintf("Failed to save build configurations: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/therecipe/qt/widgets"
+)
+
+// recoveryEntry is the backup of one unsaved buffer. Autosave writes these
+// next to the preferences instead of over the user's files, so the real
+// file only changes on an explicit save.
+type recoveryEntry struct {
+	Path  string    `json:"path"` // Empty for untitled buffers
+	Text  string    `json:"text"`
+	Saved time.Time `json:"saved"`
+}
+
+var (
+	recoveryCounter int
+
+	// recoveryInstance names this process's backups. The start time keeps
+	// it unique when a later process, say after a reboot, reuses the pid.
+	recoveryInstance = fmt.Sprintf("%d-%d", time.Now().UnixNano(), os.Getpid())
+
+	// recoveryLock is held while this process runs, marking its backups as
+	// owned so other instances do not offer them
+	recoveryLock *os.File
+)
+
+// recoveryDir is where unsaved buffers are backed up
+func recoveryDir() string {
+	return filepath.Join(filepath.Dir(preferencesPath), "recovery")
+}
+
+// recoveryFile is the backup path of an editor, assigning it a name on first use
+func (e *CodeEditor) recoveryFile() string {
+	if e.recoveryID == "" {
+		recoveryCounter++
+		e.recoveryID = fmt.Sprintf("%s-%d", recoveryInstance, recoveryCounter)
+	}
+	return filepath.Join(recoveryDir(), e.recoveryID+".json")
+}
+
+// recoveryOwner is the instance that wrote a recovery file, taken from its name
+func recoveryOwner(file string) (string, bool) {
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(file), ".json"), "-")
+	if len(parts) != 3 {
+		return "", false
+	}
+	return parts[0] + "-" + parts[1], true
+}
+
+// recoveryLockPath is the lock file an instance holds while it runs
+func recoveryLockPath(instance string) string {
+	return filepath.Join(recoveryDir(), instance+".lock")
+}
+
+// holdRecoveryLock creates and locks this instance's lock file, once
+func holdRecoveryLock() error {
+	if recoveryLock != nil {
+		return nil
+	}
+	file, err := os.OpenFile(recoveryLockPath(recoveryInstance), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return err
+	}
+	recoveryLock = file
+	return nil
+}
+
+// releaseRecoveryLock unlocks and removes this instance's lock file
+func releaseRecoveryLock() {
+	if recoveryLock == nil {
+		return
+	}
+	recoveryLock.Close()
+	os.Remove(recoveryLock.Name())
+	recoveryLock = nil
+}
+
+// ownerRunning reports whether the instance that wrote a recovery file
+// still runs, which is when it holds its lock
+func ownerRunning(instance string) bool {
+	return instance == recoveryInstance || lockHeld(recoveryLockPath(instance))
+}
+
+// writeFileAtomic replaces path with data so that a crash leaves either the
+// old or the new contents, never a truncated file. An existing file keeps
+// its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	tempPath := temp.Name()
+
+	if err := temp.Chmod(mode); err != nil {
+		temp.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to set permissions of temporary file: %v", err)
+	}
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write temporary file: %v", err)
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to sync temporary file: %v", err)
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to close temporary file: %v", err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to replace %s: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// writeRecovery backs up the editor's unsaved text
+func (e *CodeEditor) writeRecovery() error {
+	if err := os.MkdirAll(recoveryDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create recovery directory: %v", err)
+	}
+	if err := holdRecoveryLock(); err != nil {
+		// The backup still helps, other instances just may offer it early
+		fmt.Printf("Failed to lock recovery files: %v\n", err)
+	}
+
+	data, err := json.MarshalIndent(recoveryEntry{
+		Path:  e.filePath,
+		Text:  e.ToPlainText(),
+		Saved: time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode recovery data: %v", err)
+	}
+	return writeFileAtomic(e.recoveryFile(), data)
+}
+
+// discardRecovery removes the editor's backup once its changes are saved or dropped
+func (e *CodeEditor) discardRecovery() {
+	if e.recoveryID == "" {
+		return
+	}
+	os.Remove(e.recoveryFile())
+	e.recoveryID = ""
+}
+
+// autoSaveRecovery backs up every editor with unsaved changes
+func autoSaveRecovery() {
+	for _, e := range openEditors {
+		if !e.Document().IsModified() {
+			e.discardRecovery()
+			continue
+		}
+		if err := e.writeRecovery(); err != nil {
+			fmt.Printf("Auto-save of %s failed: %v\n", editorTitle(e), err)
+		}
+	}
+}
+
+// discardAllRecovery removes the backups of every open editor and the lock
+// that claims them
+func discardAllRecovery() {
+	for _, e := range openEditors {
+		e.discardRecovery()
+	}
+	releaseRecoveryLock()
+}
+
+// offerRecovery looks for buffers left unsaved by a previous session and
+// asks whether to restore them. Restored buffers stay modified; the files
+// on disk are not touched until they are saved.
+func offerRecovery() {
+	if preferencesPath == "" {
+		return
+	}
+	matches, err := filepath.Glob(filepath.Join(recoveryDir(), "*.json"))
+	if err != nil || len(matches) == 0 {
+		return
+	}
+	sort.Strings(matches)
+
+	var (
+		entries []recoveryEntry
+		files   []string
+		owners  []string
+		names   []string
+	)
+	for _, match := range matches {
+		// Another running instance still owns its backups
+		owner, ok := recoveryOwner(match)
+		if ok && ownerRunning(owner) {
+			continue
+		}
+
+		data, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+		var entry recoveryEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			fmt.Printf("Ignoring unreadable recovery file %s: %v\n", match, err)
+			os.Remove(match)
+			continue
+		}
+		entries = append(entries, entry)
+		files = append(files, match)
+		if ok {
+			owners = append(owners, owner)
+		}
+
+		name := "Untitled"
+		if entry.Path != "" {
+			name = entry.Path
+		}
+		names = append(names, fmt.Sprintf("%s (%s)", name, entry.Saved.Format("2006-01-02 15:04")))
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	answer := widgets.QMessageBox_Question(mainWindow, "Recover Unsaved Changes",
+		fmt.Sprintf("Unsaved changes from a previous session were found:\n\n%s\n\nRestore them?", strings.Join(names, "\n")),
+		widgets.QMessageBox__Yes|widgets.QMessageBox__No, widgets.QMessageBox__Yes)
+
+	// Restored buffers get fresh backups, declined ones are dropped along
+	// with the locks their instances left behind
+	for _, file := range files {
+		os.Remove(file)
+	}
+	for _, owner := range owners {
+		os.Remove(recoveryLockPath(owner))
+	}
+	if answer != widgets.QMessageBox__Yes {
+		return
+	}
+
+	for _, entry := range entries {
+		restoreRecovery(entry)
+	}
+}
+
+// restoreRecovery shows a backed up buffer as an unsaved document
+func restoreRecovery(entry recoveryEntry) {
+	opened := false
+	if entry.Path != "" {
+		if _, err := os.Stat(entry.Path); err == nil {
+			opened = openFile(entry.Path)
+		}
+	}
+	if !opened {
+		if !editor.isBlank() {
+			newEditorTab()
+		}
+		if entry.Path != "" {
+			editor.setFilePath(entry.Path)
+		}
+	}
+
+	editor.SetPlainText(entry.Text)
+	editor.Document().SetModified(true)
+
+	// Keep a backup until the user saves or discards the changes
+	if err := editor.writeRecovery(); err != nil {
+		fmt.Printf("Failed to back up restored buffer: %v\n", err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile does nothing, an open file cannot be deleted on Windows and
+// that is the lock
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// lockHeld reports whether a running process holds the lock file at path,
+// removing it if none does
+func lockHeld(path string) bool {
+	err := os.Remove(path)
+	return err != nil && !errors.Is(err, os.ErrNotExist)
+}
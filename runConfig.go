@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rcore "github.com/RISC-GoV/core"
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/widgets"
+)
+
+// RunConfiguration describes how a program is started by Run and Debug
+type RunConfiguration struct {
+	Arguments   []string `json:"arguments"`
+	Environment []string `json:"environment,omitempty"` // NAME=value entries
+	StdinFile   string   `json:"stdinFile"`             // Relative to the project root
+	StdoutFile  string   `json:"stdoutFile"`            // Relative to the project root
+}
+
+const (
+	regSP = 2
+	regA0 = 10
+	regA1 = 11
+)
+
+// splitArguments splits a command line into arguments, honouring single
+// and double quotes and backslash escapes
+func splitArguments(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\\' && quote != '\'' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// splitEnvironment splits NAME=value entries like arguments, checking
+// that each one names a variable
+func splitEnvironment(line string) ([]string, error) {
+	entries, err := splitArguments(line)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if name, _, ok := strings.Cut(entry, "="); !ok || name == "" {
+			return nil, fmt.Errorf("%q is not NAME=value", entry)
+		}
+	}
+	return entries, nil
+}
+
+// joinArguments is the inverse of splitArguments, quoting where needed
+func joinArguments(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t'\"\\") {
+			arg = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// resolveProjectPath makes a run configuration path absolute
+func resolveProjectPath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(projectRoot(), path)
+}
+
+// writeMemory copies data into CPU memory starting at address
+func writeMemory(cpu *rcore.CPU, address uint32, data []byte) error {
+	for i, value := range data {
+		if err := cpu.Memory.WriteByte(address+uint32(i), value); err != nil {
+			return fmt.Errorf("failed to write memory at 0x%08x: %v", address+uint32(i), err)
+		}
+	}
+	return nil
+}
+
+// defaultStackTop is where the stack starts for programs loaded without a
+// stack pointer, such as ELF executables, well above any program image
+const defaultStackTop uint32 = 0x7ffffff0
+
+// setupProgramArguments lays out argc, argv, envp and auxv on the stack
+// as the RISC-V psABI specifies for process entry, and also passes argc,
+// argv and envp in a0-a2 for programs that start at a main-style label
+func setupProgramArguments(cpu *rcore.CPU, args, env []string) error {
+	sp := uint32(cpu.Registers[regSP])
+	if sp == 0 {
+		sp = defaultStackTop
+	}
+
+	// Make sure the frame fits below the stack pointer rather than wrapping
+	values := append(append([]string{}, args...), env...)
+	size := uint32(4 * (len(values) + 5)) // argc, the pointers, two NULLs and the auxv pair
+	for _, value := range values {
+		size += uint32(len(value) + 1)
+	}
+	if sp < size+16 {
+		return fmt.Errorf("stack pointer 0x%08x leaves no room for %d bytes of arguments", sp, size)
+	}
+
+	// Copy the argument and environment strings to the top of the stack
+	pointers := make([]uint32, len(values))
+	for i := len(values) - 1; i >= 0; i-- {
+		sp -= uint32(len(values[i]) + 1)
+		if err := writeMemory(cpu, sp, append([]byte(values[i]), 0)); err != nil {
+			return err
+		}
+		pointers[i] = sp
+	}
+
+	// argc, argv[], NULL, envp[], NULL, auxv AT_NULL pair
+	words := []uint32{uint32(len(args))}
+	words = append(words, pointers[:len(args)]...)
+	words = append(words, 0)
+	words = append(words, pointers[len(args):]...)
+	words = append(words, 0, 0, 0)
+
+	sp -= uint32(4 * len(words))
+	sp &^= 15 // The stack pointer stays 16-byte aligned
+
+	block := make([]byte, 0, 4*len(words))
+	for _, word := range words {
+		block = binary.LittleEndian.AppendUint32(block, word)
+	}
+	if err := writeMemory(cpu, sp, block); err != nil {
+		return err
+	}
+
+	cpu.Registers[regSP] = sp
+	cpu.Registers[regA0] = uint32(len(args))
+	cpu.Registers[regA1] = sp + 4
+	cpu.Registers[regA2] = sp + uint32(4*(len(args)+2))
+	return nil
+}
+
+// applyRunConfiguration passes the configured arguments to the session's
+// program and redirects its stdin/stdout. Redirected files are closed with
+// the session.
+func applyRunConfiguration(session *programSession, programPath string) error {
+	config := projectSettings.Run
+	args := append([]string{filepath.Base(programPath)}, config.Arguments...)
+	if err := setupProgramArguments(session.cpu, args, config.Environment); err != nil {
+		return fmt.Errorf("failed to set up program arguments: %v", err)
+	}
+
+	if config.StdinFile != "" {
+		input, err := os.Open(resolveProjectPath(config.StdinFile))
+		if err != nil {
+			return fmt.Errorf("failed to open stdin file: %v", err)
+		}
+		session.stdin = input
+		session.closers = append(session.closers, input)
+	}
+
+	if config.StdoutFile != "" {
+		output, err := os.Create(resolveProjectPath(config.StdoutFile))
+		if err != nil {
+			session.close()
+			return fmt.Errorf("failed to create stdout file: %v", err)
+		}
+		session.stdout = io.MultiWriter(session.stdout, output)
+		session.closers = append(session.closers, output)
+	}
+
+	return nil
+}
+
+func showRunConfigurationDialog() {
+	if projectRoot() == "" {
+		widgets.QMessageBox_Information(mainWindow, "No Project",
+			"Please open a project folder first", widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+	if projectSettingsPath == "" {
+		LoadProjectSettings(projectRoot())
+	}
+	config := projectSettings.Run
+
+	dialog := widgets.NewQDialog(mainWindow, 0)
+	dialog.SetWindowTitle("Run Configuration")
+	dialog.Resize2(500, 0)
+	dialogLayout := widgets.NewQVBoxLayout()
+	dialog.SetLayout(dialogLayout)
+	formLayout := widgets.NewQFormLayout(nil)
+
+	// Program arguments
+	argsInput := widgets.NewQLineEdit(nil)
+	argsInput.SetPlaceholderText(`arg1 "second argument"`)
+	argsInput.SetText(joinArguments(config.Arguments))
+	formLayout.AddRow3("Arguments:", argsInput)
+
+	// Environment variables, quoted like arguments
+	envInput := widgets.NewQLineEdit(nil)
+	envInput.SetPlaceholderText(`NAME=value "GREETING=hello world"`)
+	envInput.SetText(joinArguments(config.Environment))
+	formLayout.AddRow3("Environment:", envInput)
+
+	// File pickers for stdin and stdout, stored relative to the project
+	fileRow := func(value, placeholder string, save bool) (*widgets.QWidget, *widgets.QLineEdit) {
+		input := widgets.NewQLineEdit(nil)
+		input.SetPlaceholderText(placeholder)
+		input.SetText(value)
+
+		browseButton := widgets.NewQPushButton2("Browse...", nil)
+		browseButton.ConnectClicked(func(bool) {
+			var path string
+			if save {
+				path = widgets.QFileDialog_GetSaveFileName(dialog, "Capture stdout to", projectRoot(), "All Files (*)", "", 0)
+			} else {
+				path = widgets.QFileDialog_GetOpenFileName(dialog, "Read stdin from", projectRoot(), "All Files (*)", "", 0)
+			}
+			if path == "" {
+				return
+			}
+			if rel, err := filepath.Rel(projectRoot(), path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+			input.SetText(path)
+		})
+
+		row := widgets.NewQWidget(nil, 0)
+		rowLayout := widgets.NewQHBoxLayout()
+		rowLayout.SetContentsMargins(0, 0, 0, 0)
+		rowLayout.AddWidget(input, 1, 0)
+		rowLayout.AddWidget(browseButton, 0, 0)
+		row.SetLayout(rowLayout)
+		return row, input
+	}
+
+	stdinRow, stdinInput := fileRow(config.StdinFile, "Type into the terminal", false)
+	formLayout.AddRow3("Stdin from file:", stdinRow)
+
+	stdoutRow, stdoutInput := fileRow(config.StdoutFile, "Terminal only", true)
+	formLayout.AddRow3("Capture stdout to:", stdoutRow)
+
+	dialogLayout.AddLayout(formLayout, 0)
+
+	// Button box
+	buttonBox := widgets.NewQDialogButtonBox2(core.Qt__Horizontal, nil)
+	buttonBox.SetStandardButtons(widgets.QDialogButtonBox__Ok | widgets.QDialogButtonBox__Cancel)
+	buttonBox.ConnectAccepted(func() {
+		if _, err := splitArguments(argsInput.Text()); err != nil {
+			widgets.QMessageBox_Warning(dialog, "Invalid Arguments", fmt.Sprintf("Invalid arguments: %v", err),
+				widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+			return
+		}
+		if _, err := splitEnvironment(envInput.Text()); err != nil {
+			widgets.QMessageBox_Warning(dialog, "Invalid Environment", fmt.Sprintf("Invalid environment: %v", err),
+				widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+			return
+		}
+		dialog.Accept()
+	})
+	buttonBox.ConnectRejected(func() { dialog.Reject() })
+	dialogLayout.AddWidget(buttonBox, 0, 0)
+
+	if dialog.Exec() != int(widgets.QDialog__Accepted) {
+		return
+	}
+
+	args, _ := splitArguments(argsInput.Text())
+	env, _ := splitEnvironment(envInput.Text())
+	projectSettings.Run = RunConfiguration{
+		Arguments:   args,
+		Environment: env,
+		StdinFile:   strings.TrimSpace(stdinInput.Text()),
+		StdoutFile:  strings.TrimSpace(stdoutInput.Text()),
+	}
+	if err := SaveProjectSettings(); err != nil {
+		widgets.QMessageBox_Critical(mainWindow, "Error",
+			fmt.Sprintf("Failed to save run configuration: %v", err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+	}
+}
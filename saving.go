@@ -71,13 +71,19 @@ func saveCurrentFile() {
 		return
 	}
 
+	if formatterSettings().FormatOnSave && isAssemblySource(currentFilePath) {
+		formatDocument(editor)
+	}
+
 	content := editor.ToPlainText()
-	err := os.WriteFile(currentFilePath, []byte(content), 0644)
-	if err != nil {
+	if err := writeFileAtomic(currentFilePath, []byte(content)); err != nil {
 		widgets.QMessageBox_Critical(mainWindow, "Error",
 			fmt.Sprintf("Failed to save file: %v", err),
 			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
 	}
+	editor.Document().SetModified(false)
+	editor.discardRecovery()
 }
 
 func saveFileAs() {
@@ -90,8 +96,7 @@ func saveFileAs() {
 			filePath += ".asm"
 		}
 
-		currentFilePath = filePath
+		editor.setFilePath(filePath)
 		saveCurrentFile()
-		mainWindow.SetWindowTitle(fmt.Sprintf("RISC-GoV IDE - %s", filepath.Base(filePath)))
 	}
 }
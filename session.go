@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	rcore "github.com/RISC-GoV/core"
+)
+
+// Linux-style system calls used for program I/O
+const (
+	sysRead  = 63
+	sysWrite = 64
+
+	regA2 = 12
+	regA7 = 17
+
+	ecallInstruction = 0x00000073
+	errBadFD         = -9 // EBADF
+
+	// maxTransfer bounds a single read or write ecall. Short reads and
+	// writes are allowed, so programs ask again for the rest.
+	maxTransfer = 64 << 10
+)
+
+// consoleWriter is an io.Writer that shows everything written in the Output tab
+type consoleWriter struct{}
+
+func (consoleWriter) Write(p []byte) (int, error) {
+	programOutput.Append(string(p))
+	return len(p), nil
+}
+
+// programSession is one running program together with its own stdin and
+// stdout. The simulator's read/write ecalls are served from here instead
+// of the IDE process's os.Stdin and os.Stdout.
+type programSession struct {
+	cpu    *rcore.CPU
+	stdin  io.Reader // Redirected stdin, nil to read from the console
+	stdout io.Writer
+	stderr io.Writer
+
+	input    chan []byte // Console input, a nil entry means end of file
+	inputBuf []byte
+	inputEOF bool
+
+	lock        sync.Mutex
+	interrupted chan struct{}
+	closers     []io.Closer
+}
+
+var (
+	// activeSession receives console input and Ctrl+C
+	activeSession     *programSession
+	activeSessionLock sync.Mutex
+)
+
+// currentSession returns the session that receives console input, if any
+func currentSession() *programSession {
+	activeSessionLock.Lock()
+	defer activeSessionLock.Unlock()
+	return activeSession
+}
+
+func newProgramSession(cpu *rcore.CPU) *programSession {
+	return &programSession{
+		cpu:         cpu,
+		stdout:      consoleWriter{},
+		stderr:      consoleWriter{},
+		input:       make(chan []byte, 256),
+		interrupted: make(chan struct{}),
+	}
+}
+
+// activate makes the session the one that receives console input
+func (s *programSession) activate() {
+	activeSessionLock.Lock()
+	activeSession = s
+	activeSessionLock.Unlock()
+}
+
+// close releases redirected files and detaches the session from the console
+func (s *programSession) close() {
+	activeSessionLock.Lock()
+	if activeSession == s {
+		activeSession = nil
+	}
+	activeSessionLock.Unlock()
+
+	for _, closer := range s.closers {
+		closer.Close()
+	}
+	s.closers = nil
+}
+
+// sendInput queues console input for the program, nil signals end of file
+func (s *programSession) sendInput(data []byte) {
+	select {
+	case s.input <- data:
+	default:
+		// Input buffer full, drop rather than block the UI
+	}
+}
+
+// interrupt asks the program to stop and wakes it if it waits for input
+func (s *programSession) interrupt() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.interrupted:
+	default:
+		close(s.interrupted)
+	}
+}
+
+// isInterrupted reports whether interrupt was called since the last reset
+func (s *programSession) isInterrupted() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.interrupted:
+		return true
+	default:
+		return false
+	}
+}
+
+// resetInterrupt clears a previous interrupt before the program resumes
+func (s *programSession) resetInterrupt() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.interrupted = make(chan struct{})
+}
+
+// readStdin reads up to n bytes the way a terminal does, returning once
+// any input is available
+func (s *programSession) readStdin(n int) ([]byte, error) {
+	if s.stdin != nil {
+		buf := make([]byte, n)
+		count, err := s.stdin.Read(buf)
+		if err == io.EOF {
+			err = nil
+		}
+		return buf[:count], err
+	}
+
+	if len(s.inputBuf) == 0 && !s.inputEOF {
+		s.lock.Lock()
+		interrupted := s.interrupted
+		s.lock.Unlock()
+
+		select {
+		case data := <-s.input:
+			if data == nil {
+				s.inputEOF = true
+			}
+			s.inputBuf = data
+		case <-interrupted:
+			return nil, fmt.Errorf("interrupted while waiting for input")
+		}
+	}
+
+	if s.inputEOF && len(s.inputBuf) == 0 {
+		s.inputEOF = false // Like a terminal, later reads wait for new input
+		return nil, nil
+	}
+
+	if n > len(s.inputBuf) {
+		n = len(s.inputBuf)
+	}
+	data := s.inputBuf[:n]
+	s.inputBuf = s.inputBuf[n:]
+	return data, nil
+}
+
+// handleEcall serves the read and write system calls if the next instruction
+// is an ecall for one of them. It reports whether the instruction was handled,
+// in which case the caller must not execute it again.
+func (s *programSession) handleEcall() (bool, error) {
+	cpu := s.cpu
+	word, err := readWord(cpu, uint32(cpu.PC))
+	if err != nil || word != ecallInstruction {
+		return false, nil
+	}
+
+	fd := cpu.Registers[regA0]
+	buffer := uint32(cpu.Registers[regA1])
+	count := min(int(cpu.Registers[regA2]), maxTransfer)
+	var result int32
+
+	switch cpu.Registers[regA7] {
+	case sysWrite:
+		var out io.Writer
+		switch fd {
+		case 1:
+			out = s.stdout
+		case 2:
+			out = s.stderr
+		}
+		if out == nil {
+			result = errBadFD
+			break
+		}
+
+		data := make([]byte, count)
+		for i := range data {
+			if data[i], err = cpu.Memory.ReadByte(buffer + uint32(i)); err != nil {
+				return true, fmt.Errorf("write: failed to read memory at 0x%08x: %v", buffer+uint32(i), err)
+			}
+		}
+		written, _ := out.Write(data)
+		result = int32(written)
+
+	case sysRead:
+		if fd != 0 {
+			result = errBadFD
+			break
+		}
+
+		data, err := s.readStdin(count)
+		if err != nil {
+			return true, err
+		}
+		if err := writeMemory(cpu, buffer, data); err != nil {
+			return true, err
+		}
+		result = int32(len(data))
+
+	default:
+		// Everything else, including exit, is up to the simulator
+		return false, nil
+	}
+
+	cpu.Registers[regA0] = uint32(result)
+	cpu.PC += 4
+	return true, nil
+}
+
+// traceInstruction shows the instruction at the PC in the debug console,
+// decoded here rather than printed by the simulator to the process stdout
+func traceInstruction(cpu *rcore.CPU) {
+	word, err := readWord(cpu, cpu.PC)
+	if err != nil {
+		debugLog.Log(fmt.Sprintf("Failed to trace instruction: %v", err))
+		return
+	}
+	debugLog.Log(fmt.Sprintf("0x%08x: %08x  %s", cpu.PC, word, disassemble(word, cpu.PC)))
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+	"github.com/therecipe/qt/widgets"
+)
+
+// projectSource is the text of an open buffer or of an assembly file of
+// the project that is not open
+type projectSource struct {
+	path   string
+	text   string
+	editor *CodeEditor // nil if the file is not open
+}
+
+// projectSources lists the open buffers, then the assembly sources of the
+// project that are not open
+func projectSources() []projectSource {
+	var sources []projectSource
+	for _, e := range openEditors {
+		sources = append(sources, projectSource{path: e.filePath, text: e.ToPlainText(), editor: e})
+	}
+	for _, document := range lspDocumentList() {
+		sources = append(sources, projectSource{path: document.path, text: document.text})
+	}
+
+	if currentProjectPath == "" {
+		return sources
+	}
+	filepath.WalkDir(currentProjectPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != currentProjectPath && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if editorForPath(path) != nil || lspDocuments[path] != nil || !isAssemblySource(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			sources = append(sources, projectSource{path: path, text: string(data)})
+		}
+		return nil
+	})
+	return sources
+}
+
+// symbolOccurrences finds every use of a symbol in a source text, skipping
+// comments, strings and character literals
+func symbolOccurrences(text, name string) []textMatch {
+	var matches []textMatch
+	position, lineStart := 0, 0
+	inBlock := false
+	for lineStart <= len(text) {
+		lineEnd := strings.IndexByte(text[lineStart:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += lineStart
+		}
+		line := text[lineStart:lineEnd]
+
+		var lineMatches []textMatch
+		lineMatches, inBlock = lineSymbolOccurrences(line, inBlock, name)
+		for _, match := range lineMatches {
+			matches = append(matches, textMatch{
+				start:     position + match.start,
+				end:       position + match.end,
+				byteStart: lineStart + match.byteStart,
+				byteEnd:   lineStart + match.byteEnd,
+			})
+		}
+
+		position += utf16Length(line) + 1
+		lineStart = lineEnd + 1
+	}
+	return matches
+}
+
+// lineSymbolOccurrences finds the uses of a symbol in a single line that
+// starts inside a /* */ comment if inBlock is set, with offsets relative
+// to the line. It also returns whether the line ends inside a comment.
+func lineSymbolOccurrences(line string, inBlock bool, name string) ([]textMatch, bool) {
+	var matches []textMatch
+	code, _, inBlock := stripComment(line, inBlock)
+	inString := false
+	for i := 0; i < len(code); {
+		c := code[i]
+		switch {
+		case c == '"':
+			inString = !inString
+			i++
+		case inString:
+			if c == '\\' {
+				i++
+			}
+			i++
+		case c == '\'':
+			if end := strings.IndexByte(code[i+1:], '\''); end >= 0 {
+				i += end + 2
+			} else {
+				i++
+			}
+		case isSymbolChar(c):
+			end := i
+			for end < len(code) && isSymbolChar(code[end]) {
+				end++
+			}
+			if code[i:end] == name {
+				start := utf16Length(line[:i])
+				matches = append(matches, textMatch{
+					start:     start,
+					end:       start + utf16Length(name),
+					byteStart: i,
+					byteEnd:   end,
+				})
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	return matches, inBlock
+}
+
+// symbolDefinitions lists where a label or constant is defined in the
+// project, definitions in the active file first
+func symbolDefinitions(name string) []labelDefinition {
+	var local, other []labelDefinition
+	for _, definition := range projectLabels() {
+		if definition.name != name {
+			continue
+		}
+		if definition.path == editor.filePath {
+			local = append(local, definition)
+		} else {
+			other = append(other, definition)
+		}
+	}
+	return append(local, other...)
+}
+
+// symbolUnderCursor returns the symbol at the text cursor, or "" if the
+// cursor is not on one
+func (e *CodeEditor) symbolUnderCursor() string {
+	cursor := e.TextCursor()
+	line := cursor.Block().Text()
+	column := len(string([]rune(line)[:min(cursor.PositionInBlock(), len([]rune(line)))]))
+	return symbolAt(line, column, startsInBlockComment(cursor.Block()))
+}
+
+// symbolAt returns the symbol around a byte column of a line, or "" if
+// there is none or it is in a comment. inBlock is whether the line starts
+// inside a /* */ comment.
+func symbolAt(line string, column int, inBlock bool) string {
+	code, _, _ := stripComment(line, inBlock)
+	if column > len(code) {
+		return ""
+	}
+	start, end := column, column
+	for start > 0 && isSymbolChar(code[start-1]) {
+		start--
+	}
+	for end < len(code) && isSymbolChar(code[end]) {
+		end++
+	}
+	if name := code[start:end]; isSymbolName(name) {
+		return name
+	}
+	return ""
+}
+
+// selectRange selects length characters from a line and column and brings
+// them into view
+func (e *CodeEditor) selectRange(line, column, length int) {
+	block := e.Document().FindBlockByNumber(line)
+	if !block.IsValid() {
+		return
+	}
+	cursor := e.TextCursor()
+	cursor.SetPosition(block.Position()+column, gui.QTextCursor__MoveAnchor)
+	cursor.SetPosition(block.Position()+column+length, gui.QTextCursor__KeepAnchor)
+	e.SetTextCursor(cursor)
+	e.CenterCursor()
+	e.SetFocus2()
+}
+
+// goToDefinition jumps to the definition of the label or constant at the
+// cursor, opening its file if needed
+func goToDefinition() {
+	name := editor.symbolUnderCursor()
+	if name == "" {
+		return
+	}
+	definitions := symbolDefinitions(name)
+	if len(definitions) == 0 {
+		return
+	}
+
+	definition := definitions[0]
+	if definition.path == editor.filePath {
+		editor.selectRange(definition.line, definition.column, utf16Length(name))
+		return
+	}
+	goToProjectHit(projectHit{path: definition.path, line: definition.line, column: definition.column, length: utf16Length(name)})
+}
+
+// mouseRelease makes Ctrl+click go to the definition of a symbol
+func (e *CodeEditor) mouseRelease(event *gui.QMouseEvent) {
+	e.MouseReleaseEventDefault(event)
+	if event.Button() != core.Qt__LeftButton || event.Modifiers()&core.Qt__ControlModifier == 0 || e.TextCursor().HasSelection() {
+		return
+	}
+	e.SetTextCursor(e.CursorForPosition(event.Pos()))
+	goToDefinition()
+}
+
+// findAllReferences lists every use of the symbol at the cursor in the
+// Search tab of the bottom panel
+func findAllReferences() {
+	name := editor.symbolUnderCursor()
+	if name == "" {
+		return
+	}
+	if len(symbolDefinitions(name)) == 0 {
+		widgets.QMessageBox_Information(mainWindow, "Find All References",
+			fmt.Sprintf("%s is not a label or constant defined in the project", name),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	var files []projectFile
+	for _, source := range projectSources() {
+		// Untitled buffers cannot be reopened from the results
+		if source.path == "" {
+			continue
+		}
+		if matches := symbolOccurrences(source.text, name); len(matches) > 0 {
+			files = append(files, projectFile{path: source.path, text: source.text, matches: matches})
+		}
+	}
+	projectSearch.showReferences(name, files)
+}
+
+// renameSymbol renames the label or constant at the cursor everywhere in
+// the project
+func renameSymbol() {
+	name := editor.symbolUnderCursor()
+	if name == "" {
+		return
+	}
+	if len(symbolDefinitions(name)) == 0 {
+		widgets.QMessageBox_Information(mainWindow, "Rename Symbol",
+			fmt.Sprintf("%s is not a label or constant defined in the project", name),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	ok := false
+	newName := widgets.QInputDialog_GetText(mainWindow, "Rename Symbol", fmt.Sprintf("New name for %s:", name),
+		widgets.QLineEdit__Normal, name, &ok, 0, 0)
+	newName = strings.TrimSpace(newName)
+	if !ok || newName == "" || newName == name {
+		return
+	}
+	if err := checkSymbolName(newName); err != nil {
+		widgets.QMessageBox_Warning(mainWindow, "Rename Symbol", fmt.Sprintf("Cannot rename %s to %s: %v", name, newName, err),
+			widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		return
+	}
+
+	// Find every reference before changing anything
+	type rename struct {
+		source  projectSource
+		matches []textMatch
+	}
+	var renames []rename
+	count := 0
+	for _, source := range projectSources() {
+		if matches := symbolOccurrences(source.text, name); len(matches) > 0 {
+			renames = append(renames, rename{source: source, matches: matches})
+			count += len(matches)
+		}
+	}
+
+	answer := widgets.QMessageBox_Question(mainWindow, "Rename Symbol",
+		fmt.Sprintf("Rename %s to %s?\n\n%d references in %d files will be changed.", name, newName, count, len(renames)),
+		widgets.QMessageBox__Yes|widgets.QMessageBox__No, widgets.QMessageBox__Yes)
+	if answer != widgets.QMessageBox__Yes {
+		return
+	}
+
+	// Open files are edited in their buffer so the rename can be undone,
+	// the others are rewritten on disk
+	for _, r := range renames {
+		replacements := make([]string, len(r.matches))
+		for i := range replacements {
+			replacements[i] = newName
+		}
+		if r.source.editor != nil {
+			r.source.editor.replaceMatches(r.matches, replacements)
+		} else if err := writeReplacedFile(r.source.path, applyReplacements(r.source.text, r.matches, replacements)); err != nil {
+			widgets.QMessageBox_Critical(mainWindow, "Error", fmt.Sprintf("Failed to rename in %s: %v", r.source.path, err),
+				widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		}
+	}
+}
+
+// checkSymbolName reports why a name cannot be given to a label or constant
+func checkSymbolName(name string) error {
+	if !isSymbolName(name) {
+		return fmt.Errorf("not a valid symbol name")
+	}
+	if isInstruction(name) {
+		return fmt.Errorf("it is an instruction mnemonic")
+	}
+	if vocabulary.directives[name] {
+		return fmt.Errorf("it is an assembler directive")
+	}
+	if _, isRegister := registerNumber(name); isRegister {
+		return fmt.Errorf("it is a register name")
+	}
+	if definitions := symbolDefinitions(name); len(definitions) > 0 {
+		location := "an untitled file"
+		if definitions[0].path != "" {
+			location = filepath.Base(definitions[0].path)
+		}
+		return fmt.Errorf("it is already defined in %s:%d", location, definitions[0].line+1)
+	}
+	return nil
+}
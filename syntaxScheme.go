@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+)
+
+// SyntaxScheme is a set of syntax colours, one rule per token class. It is
+// stored in the preferences and can be imported from or exported to a file.
+type SyntaxScheme struct {
+	Name  string                   `json:"name"`
+	Rules map[string]HighlightRule `json:"rules"` // By token class key
+}
+
+// syntaxClass is a class of tokens that share a colour
+type syntaxClass struct {
+	key   string // Key in SyntaxScheme.Rules
+	title string // Shown in the Appearance tab
+	kinds []asmTokenKind
+}
+
+// syntaxClasses lists the token classes in the order they are shown
+var syntaxClasses = []syntaxClass{
+	{"instruction", "Instructions", []asmTokenKind{tokenInstruction}},
+	{"pseudo", "Pseudo-instructions", []asmTokenKind{tokenPseudo}},
+	{"directive", "Directives", []asmTokenKind{tokenDirective}},
+	{"register", "Registers", []asmTokenKind{tokenRegister}},
+	{"number", "Numbers", []asmTokenKind{tokenNumber}},
+	{"string", "Strings", []asmTokenKind{tokenString}},
+	{"comment", "Comments", []asmTokenKind{tokenComment}},
+	{"label", "Label definitions", []asmTokenKind{tokenLabel}},
+	{"symbol", "Symbol references", []asmTokenKind{tokenSymbol}},
+	{"error", "Errors (underline)", []asmTokenKind{tokenUnknownMnemonic, tokenBadRegister}},
+}
+
+// withDefaults fills the classes a scheme leaves out from another one,
+// usually the theme's
+func (s SyntaxScheme) withDefaults(base SyntaxScheme) SyntaxScheme {
+	rules := make(map[string]HighlightRule)
+	for key, rule := range base.Rules {
+		rules[key] = rule
+	}
+	for key, rule := range s.Rules {
+		rules[key] = rule
+	}
+	return SyntaxScheme{Name: s.Name, Rules: rules}
+}
+
+// currentSyntaxScheme returns the user's scheme, or the theme's colours if
+// they have not chosen one
+func currentSyntaxScheme() SyntaxScheme {
+	if preferences.ThemeSettings.SyntaxScheme == nil {
+		return activeTheme.Syntax
+	}
+	return preferences.ThemeSettings.SyntaxScheme.withDefaults(activeTheme.Syntax)
+}
+
+// format builds the character format of a rule. Errors keep the text
+// colour and get a wavy underline in the rule's colour instead.
+func (r HighlightRule) format(underline bool) *gui.QTextCharFormat {
+	format := gui.NewQTextCharFormat()
+	if r.Color != "" {
+		color := gui.NewQColor6(r.Color)
+		if underline {
+			format.SetUnderlineStyle(gui.QTextCharFormat__WaveUnderline)
+			format.SetUnderlineColor(color)
+		} else {
+			format.SetForeground(gui.NewQBrush3(color, core.Qt__SolidPattern))
+		}
+	}
+	if r.Bold {
+		format.SetFontWeight(75) // Bold
+	}
+	format.SetFontItalic(r.Italic)
+	return format
+}
+
+// formats builds the character format of every kind of token
+func (s SyntaxScheme) formats() map[asmTokenKind]*gui.QTextCharFormat {
+	formats := make(map[asmTokenKind]*gui.QTextCharFormat)
+	for _, class := range syntaxClasses {
+		format := s.Rules[class.key].format(class.key == "error")
+		for _, kind := range class.kinds {
+			formats[kind] = format
+		}
+	}
+	return formats
+}
+
+// parseSyntaxScheme reads a scheme, checking that its colours are valid
+func parseSyntaxScheme(data []byte) (SyntaxScheme, error) {
+	var scheme SyntaxScheme
+	if err := json.Unmarshal(data, &scheme); err != nil {
+		return scheme, fmt.Errorf("failed to parse scheme file: %v", err)
+	}
+	for key, rule := range scheme.Rules {
+		if rule.Color != "" && !gui.NewQColor6(rule.Color).IsValid() {
+			return scheme, fmt.Errorf("invalid colour %q for %s", rule.Color, key)
+		}
+	}
+	return scheme, nil
+}
+
+// loadSyntaxScheme reads a scheme file
+func loadSyntaxScheme(path string) (SyntaxScheme, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SyntaxScheme{}, fmt.Errorf("failed to read scheme file: %v", err)
+	}
+	return parseSyntaxScheme(data)
+}
+
+// builtinSyntaxSchemes returns the schemes shipped with the IDE, by name
+func builtinSyntaxSchemes() []SyntaxScheme {
+	var schemes []SyntaxScheme
+	paths, _ := fs.Glob(builtinThemeFiles, "schemes/*.json")
+	for _, path := range paths {
+		data, err := builtinThemeFiles.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		scheme, err := parseSyntaxScheme(data)
+		if err != nil {
+			fmt.Printf("Ignoring built-in scheme %s: %v\n", path, err)
+			continue
+		}
+		if scheme.Name == "" {
+			scheme.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		schemes = append(schemes, scheme)
+	}
+	sort.Slice(schemes, func(i, j int) bool { return schemes[i].Name < schemes[j].Name })
+	return schemes
+}
+
+// saveSyntaxScheme writes a scheme file that can be imported again
+func saveSyntaxScheme(path string, scheme SyntaxScheme) error {
+	data, err := json.MarshalIndent(scheme, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal scheme: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write scheme file: %v", err)
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
 	"github.com/therecipe/qt/core"
 	"github.com/therecipe/qt/gui"
 	"github.com/therecipe/qt/widgets"
@@ -10,11 +14,16 @@ import (
 const (
 	ThemeLight = "Light"
 	ThemeDark  = "Dark"
+	ThemeAuto  = "Auto" // Light or Dark, following the desktop
 )
 
 // Global theme variable
 var currentTheme string
 
+// editedSyntaxScheme is the scheme being edited in the Appearance tab, nil
+// while it follows the theme's colours
+var editedSyntaxScheme *SyntaxScheme
+
 func createThemeSettingsTab() *widgets.QWidget {
 	tab := widgets.NewQWidget(nil, 0)
 	layout := widgets.NewQVBoxLayout()
@@ -23,18 +32,15 @@ func createThemeSettingsTab() *widgets.QWidget {
 	// Create form layout for settings
 	formLayout := widgets.NewQFormLayout(nil)
 
-	// Theme selector (Light/Dark)
+	// Theme selector, Auto then the built-in themes
 	themeCombo = widgets.NewQComboBox(nil)
-	themeCombo.AddItems([]string{
-		"Light",
-		"Dark",
-	})
+	themeCombo.AddItems(themeNames())
 
-	// Set current theme
-	if preferences.ThemeSettings.DarkMode {
-		themeCombo.SetCurrentText("Dark")
+	// Set current theme, older preferences may name one that is gone
+	if preferences.ThemeSettings.ThemeName == ThemeAuto {
+		themeCombo.SetCurrentText(ThemeAuto)
 	} else {
-		themeCombo.SetCurrentText("Light")
+		themeCombo.SetCurrentText(activeTheme.Name)
 	}
 
 	// Preview of selected theme
@@ -56,10 +62,17 @@ func createThemeSettingsTab() *widgets.QWidget {
 
 	// Add a code editor preview
 	previewEditor := widgets.NewQPlainTextEdit(nil)
-	previewEditor.SetPlainText("// Sample RISC-V Assembly\n.global _start\n\n_start:\n    li a0, 1       # File descriptor (stdout)\n    la a1, message  # Message address\n    li a2, 13      # Message length\n    li a7, 64      # syscall: write\n    ecall")
+	previewEditor.SetPlainText("/* Sample RISC-V Assembly */\n.data\nmessage: .string \"Hello, World\\n\"\n\n.text\n.global _start\n_start:\n    li a0, 1        # File descriptor (stdout)\n    la a1, message  # Message address\n    li a2, 13       # Message length\n    li a7, 64       # syscall: write\n    ecall\n    lw t0, 0(x40)   # Not a register")
 	previewEditor.SetReadOnly(true)
 	previewWidgetLayout.AddWidget(previewEditor, 0, 0)
 
+	// Highlight the preview with the scheme being edited
+	previewHighlighter := gui.NewQSyntaxHighlighter2(previewEditor.Document())
+	var previewFormats map[asmTokenKind]*gui.QTextCharFormat
+	previewHighlighter.ConnectHighlightBlock(func(text string) {
+		highlightLine(previewHighlighter, text, previewFormats, nil)
+	})
+
 	// Add buttons
 	buttonLayout := widgets.NewQHBoxLayout()
 	runButton := widgets.NewQPushButton2("Run", nil)
@@ -71,103 +84,199 @@ func createThemeSettingsTab() *widgets.QWidget {
 
 	previewLayout.AddWidget(previewWidget, 0, 0)
 
+	// Syntax colours, starting from the user's scheme or the theme's
+	editedSyntaxScheme = preferences.ThemeSettings.SyntaxScheme
+	syntaxGroupBox := widgets.NewQGroupBox2("Syntax Colours", nil)
+	syntaxLayout := widgets.NewQVBoxLayout()
+	syntaxGroupBox.SetLayout(syntaxLayout)
+
+	schemeLabel := widgets.NewQLabel2("", nil, 0)
+	syntaxLayout.AddWidget(schemeLabel, 0, 0)
+
+	syntaxTable := widgets.NewQTableWidget(nil)
+	syntaxTable.SetColumnCount(4)
+	syntaxTable.SetRowCount(len(syntaxClasses))
+	syntaxTable.SetHorizontalHeaderLabels([]string{"Token", "Colour", "Bold", "Italic"})
+	syntaxTable.VerticalHeader().SetVisible(false)
+	syntaxTable.SetEditTriggers(widgets.QAbstractItemView__NoEditTriggers)
+	syntaxTable.SetSelectionMode(widgets.QAbstractItemView__NoSelection)
+	syntaxLayout.AddWidget(syntaxTable, 1, 0)
+
+	// shownScheme is the scheme in the table, the theme's colours filling in
+	// whatever the edited scheme leaves out
+	shownScheme := func() SyntaxScheme {
+		themeSyntax := themeByName(themeCombo.CurrentText()).Syntax
+		if editedSyntaxScheme == nil {
+			return themeSyntax
+		}
+		return editedSyntaxScheme.withDefaults(themeSyntax)
+	}
+
+	colourButtons := make([]*widgets.QPushButton, len(syntaxClasses))
+	boldChecks := make([]*widgets.QCheckBox, len(syntaxClasses))
+	italicChecks := make([]*widgets.QCheckBox, len(syntaxClasses))
+	showScheme := func() {
+		scheme := shownScheme()
+		for i, class := range syntaxClasses {
+			rule := scheme.Rules[class.key]
+			if rule.Color == "" {
+				colourButtons[i].SetText("Text colour")
+				colourButtons[i].SetStyleSheet("")
+			} else {
+				colourButtons[i].SetText(rule.Color)
+				colourButtons[i].SetStyleSheet(fmt.Sprintf("QPushButton { color: %s; }", rule.Color))
+			}
+			boldChecks[i].SetChecked(rule.Bold)
+			italicChecks[i].SetChecked(rule.Italic)
+		}
+		if editedSyntaxScheme == nil {
+			schemeLabel.SetText("Scheme: theme colours")
+		} else {
+			schemeLabel.SetText("Scheme: " + scheme.Name)
+		}
+		previewFormats = scheme.formats()
+		previewHighlighter.Rehighlight()
+	}
+
+	// editRule changes one rule, starting a custom scheme from the shown
+	// colours the first time
+	editRule := func(key string, change func(*HighlightRule)) {
+		scheme := shownScheme()
+		if editedSyntaxScheme == nil {
+			scheme.Name = "Custom"
+		}
+		rule := scheme.Rules[key]
+		change(&rule)
+		scheme.Rules[key] = rule
+		editedSyntaxScheme = &scheme
+		showScheme()
+	}
+
+	for i, class := range syntaxClasses {
+		syntaxTable.SetItem(i, 0, widgets.NewQTableWidgetItem2(class.title, 0))
+
+		colourButtons[i] = widgets.NewQPushButton2("", nil)
+		colourButtons[i].ConnectClicked(func(bool) {
+			initial := gui.NewQColor6(shownScheme().Rules[class.key].Color)
+			color := widgets.QColorDialog_GetColor(initial, tab, "Colour of "+class.title, 0)
+			if color.IsValid() {
+				editRule(class.key, func(rule *HighlightRule) { rule.Color = color.Name() })
+			}
+		})
+		syntaxTable.SetCellWidget(i, 1, colourButtons[i])
+
+		boldChecks[i] = widgets.NewQCheckBox(nil)
+		boldChecks[i].ConnectClicked(func(checked bool) {
+			editRule(class.key, func(rule *HighlightRule) { rule.Bold = checked })
+		})
+		syntaxTable.SetCellWidget(i, 2, boldChecks[i])
+
+		italicChecks[i] = widgets.NewQCheckBox(nil)
+		italicChecks[i].ConnectClicked(func(checked bool) {
+			editRule(class.key, func(rule *HighlightRule) { rule.Italic = checked })
+		})
+		syntaxTable.SetCellWidget(i, 3, italicChecks[i])
+	}
+	syntaxTable.ResizeColumnsToContents()
+
+	// Schemes such as Solarized or Monokai are built in or shared as files
+	schemeButtonLayout := widgets.NewQHBoxLayout()
+	builtinButton := widgets.NewQPushButton2("Built-in", nil)
+	builtinMenu := widgets.NewQMenu(builtinButton)
+	for _, scheme := range builtinSyntaxSchemes() {
+		builtinMenu.AddAction(scheme.Name).ConnectTriggered(func(bool) {
+			editedSyntaxScheme = &scheme
+			showScheme()
+		})
+	}
+	builtinButton.SetMenu(builtinMenu)
+	importButton := widgets.NewQPushButton2("Import...", nil)
+	exportButton := widgets.NewQPushButton2("Export...", nil)
+	resetButton := widgets.NewQPushButton2("Use Theme Colours", nil)
+	schemeButtonLayout.AddWidget(builtinButton, 0, 0)
+	schemeButtonLayout.AddWidget(importButton, 0, 0)
+	schemeButtonLayout.AddWidget(exportButton, 0, 0)
+	schemeButtonLayout.AddStretch(1)
+	schemeButtonLayout.AddWidget(resetButton, 0, 0)
+	syntaxLayout.AddLayout(schemeButtonLayout, 0)
+
+	importButton.ConnectClicked(func(bool) {
+		path := widgets.QFileDialog_GetOpenFileName(tab, "Import Syntax Scheme", "",
+			"Syntax Schemes (*.json);;All Files (*.*)", "", 0)
+		if path == "" {
+			return
+		}
+		scheme, err := loadSyntaxScheme(path)
+		if err != nil {
+			widgets.QMessageBox_Critical(tab, "Error", fmt.Sprintf("Failed to import scheme: %v", err),
+				widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+			return
+		}
+		if scheme.Name == "" {
+			scheme.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		editedSyntaxScheme = &scheme
+		showScheme()
+	})
+
+	exportButton.ConnectClicked(func(bool) {
+		path := widgets.QFileDialog_GetSaveFileName(tab, "Export Syntax Scheme", "",
+			"Syntax Schemes (*.json)", "", 0)
+		if path == "" {
+			return
+		}
+		if filepath.Ext(path) == "" {
+			path += ".json"
+		}
+		if err := saveSyntaxScheme(path, shownScheme()); err != nil {
+			widgets.QMessageBox_Critical(tab, "Error", fmt.Sprintf("Failed to export scheme: %v", err),
+				widgets.QMessageBox__Ok, widgets.QMessageBox__Ok)
+		}
+	})
+
+	resetButton.ConnectClicked(func(bool) {
+		editedSyntaxScheme = nil
+		showScheme()
+	})
+
 	// Connect theme changes to update preview in real-time
 	themeCombo.ConnectCurrentTextChanged(func(text string) {
-		updateThemePreview(previewWidget, text == "Dark")
+		updateThemePreview(previewWidget, themeByName(text))
+		showScheme()
 	})
+	updateThemePreview(previewWidget, themeByName(themeCombo.CurrentText()))
+	showScheme()
 
 	// Add widgets to layout
 	formLayout.AddRow3("Theme:", themeCombo)
 
-	// Color customization note
-	noteLabel := widgets.NewQLabel2("Theme colors are optimized for code visibility and readability.", nil, 0)
+	// Where to put more themes
+	noteLabel := widgets.NewQLabel2(fmt.Sprintf("Themes are JSON files, add your own to %s and reopen Preferences.", themesDir()), nil, 0)
 	noteLabel.SetWordWrap(true)
+	noteLabel.SetTextInteractionFlags(core.Qt__TextSelectableByMouse)
 
 	// Add everything to main layout
 	layout.AddLayout(formLayout, 0)
 	layout.AddWidget(noteLabel, 0, 0)
 	layout.AddSpacing(15)
 	layout.AddWidget(previewGroupBox, 1, 0) // Give the preview some stretch
+	layout.AddWidget(syntaxGroupBox, 1, 0)
 
 	return tab
 }
 
-// Update theme preview when user selects a different theme
-func updateThemePreview(previewWidget *widgets.QWidget, isDarkMode bool) {
-	// Set preview stylesheet based on selected theme
-	if isDarkMode {
-		// Dark mode preview
-		previewWidget.SetStyleSheet(`
-			QWidget {
-				background-color: #1e1e1e;
-				color: #dcdcdc;
-			}
-			
-			QToolBar {
-				background-color: #2d2d2d;
-				border-bottom: 1px solid #444;
-			}
-			
-			QToolBar QToolButton {
-				color: #dcdcdc;
-			}
-			
-			QPlainTextEdit {
-				background-color: #1c1c1c;
-				color: #dcdcdc;
-				border: 1px solid #444;
-				border-radius: 3px;
-			}
-			
-			QPushButton {
-				background-color: #2d2d2d;
-				color: #dcdcdc;
-				border: 1px solid #444;
-				border-radius: 3px;
-				padding: 5px 15px;
-			}
-		`)
-	} else {
-		// Light mode preview
-		previewWidget.SetStyleSheet(`
-			QWidget {
-				background-color: #fafafa;
-				color: #212121;
-			}
-			
-			QToolBar {
-				background-color: #f5f5f5;
-				border-bottom: 1px solid #e0e0e0;
-			}
-			
-			QToolBar QToolButton {
-				color: #424242;
-			}
-			
-			QPlainTextEdit {
-				background-color: #ffffff;
-				color: #212121;
-				border: 1px solid #e0e0e0;
-				border-radius: 3px;
-			}
-			
-			QPushButton {
-				background-color: #f5f5f5;
-				color: #424242;
-				border: 1px solid #e0e0e0;
-				border-radius: 3px;
-				padding: 5px 15px;
-			}
-		`)
-	}
+// updateThemePreview styles the preview with the same style sheet the
+// main window gets
+func updateThemePreview(previewWidget *widgets.QWidget, theme Theme) {
+	previewWidget.SetStyleSheet(theme.styleSheet())
 }
 
-func SetTheme(darkMode bool) {
-	preferences.ThemeSettings.DarkMode = darkMode
-	preferences.ThemeSettings.ThemeName = ThemeDark
-	if !darkMode {
-		preferences.ThemeSettings.ThemeName = ThemeLight
+func SetTheme(name string) {
+	if name != ThemeAuto {
+		name = themeByName(name).Name
 	}
+	preferences.ThemeSettings.ThemeName = name
+	preferences.ThemeSettings.DarkMode = themeByName(name).Dark
 	_ = SavePreferences()
 
 	// Apply the theme
@@ -183,507 +292,70 @@ func applyModernTheme() {
 	applyTheme(currentTheme)
 }
 
+// applyTheme styles the application, the editors and their gutters with a
+// theme, the light one if there is none of that name
 func applyTheme(themeName string) {
-	currentTheme = themeName
-
-	// Create application-wide stylesheet based on theme
-	var styleSheet string
+	activeTheme = themeByName(themeName)
+	currentTheme = activeTheme.Name
 
-	if themeName == ThemeDark {
-		preferences.ThemeSettings.LineNumberAreaColor = gui.NewQColor3(45, 45, 45, 255)
-		// Dark theme styles
-		styleSheet = `
-			* {
-				transition: background-color 0ms, color 0ms, border 0ms;
-			}
+	// Apply stylesheet to application
+	app.SetStyleSheet(activeTheme.styleSheet())
 
-			QWidget {
-				background-color: #1e1e1e;
-				color: #dcdcdc;
-			}
-			
-			QMenuBar {
-				background-color: #2d2d2d;
-				color: #dcdcdc;
-				border-bottom: 1px solid #444;
-			}
-			
-			QMenuBar::item:selected {
-				background-color: #3e3e3e;
-			}
-			
-			QMenu {
-				background-color: #2d2d2d;
-				color: #dcdcdc;
-				border: 1px solid #444;
-			}
-			
-			QMenu::item:selected {
-				background-color: #3e3e3e;
-			}
-			
-			QToolBar {
-				background-color: #2d2d2d;
-				border-bottom: 1px solid #444;
-				spacing: 3px;
-			}
-			
-			QToolButton {
-				background-color: #2d2d2d;
-				color: #dcdcdc;
-				border: none;
-				border-radius: 3px;
-				padding: 3px;
-			}
-			
-			QToolButton:hover {
-				background-color: #3e3e3e;
-			}
-			
-			QToolButton:pressed {
-				background-color: #505050;
-			}
-			
-			QLineEdit {
-				background-color: #1c1c1c;
-				color: #dcdcdc;
-				border: 1px solid #444;
-				border-radius: 2px;
-				padding: 2px;
-			}
-			
-			QPlainTextEdit, QTextEdit {
-				background-color: #1c1c1c;
-				color: #dcdcdc;
-				border: 1px solid #444;
-				selection-background-color: #264f78;
-				selection-color: #ffffff;
-			}
-			
-			QTreeView, QListView, QTableView {
-				background-color: #1c1c1c;
-				color: #dcdcdc;
-				border: 1px solid #444;
-				alternate-background-color: #262626;
-			}
-			
-			QTreeView::item:selected, QListView::item:selected, QTableView::item:selected {
-				background-color: #264f78;
-				color: #ffffff;
-			}
-			
-			QTreeView::item:hover, QListView::item:hover, QTableView::item:hover {
-				background-color: #323232;
-			}
-			
-			QTreeView::branch {
-				background-color: #1c1c1c;
-			}
-			
-			QHeaderView::section {
-				background-color: #2d2d2d;
-				color: #dcdcdc;
-				border: 1px solid #444;
-				padding: 4px;
-			}
-			
-			QPushButton {
-				background-color: #2d2d2d;
-				color: #dcdcdc;
-				border: 1px solid #444;
-				padding: 5px 15px;
-				border-radius: 3px;
-			}
-			
-			QPushButton:hover {
-				background-color: #3e3e3e;
-			}
-			
-			QPushButton:pressed {
-				background-color: #505050;
-			}
-			
-			QPushButton:disabled {
-				background-color: #1e1e1e;
-				color: #666666;
-				border: 1px solid #333;
-			}
-			
-			QTabWidget::pane {
-				border: 1px solid #444;
-				background-color: #1e1e1e;
-			}
-			
-			QTabBar::tab {
-				background-color: #2d2d2d;
-				color: #b0b0b0;
-				padding: 5px 10px;
-				border: 1px solid #444;
-				border-bottom: none;
-				border-top-left-radius: 3px;
-				border-top-right-radius: 3px;
-			}
-			
-			QTabBar::tab:selected {
-				background-color: #1e1e1e;
-				color: #dcdcdc;
-			}
-			
-			QTabBar::tab:hover:!selected {
-				background-color: #3e3e3e;
-			}
-			
-			QStatusBar {
-				background-color: #2d2d2d;
-				color: #dcdcdc;
-				border-top: 1px solid #444;
-			}
-			
-			QScrollBar:vertical {
-				background-color: #292929;
-				width: 14px;
-				margin: 14px 0px 14px 0px;
-			}
-			
-			QScrollBar::handle:vertical {
-				background-color: #555555;
-				min-height: 20px;
-				border-radius: 3px;
-			}
-			
-			QScrollBar::handle:vertical:hover {
-				background-color: #666666;
-			}
-			
-			QScrollBar::add-line:vertical, QScrollBar::sub-line:vertical {
-				border: none;
-				background: none;
-				height: 14px;
-			}
-			
-			QScrollBar:horizontal {
-				background-color: #292929;
-				height: 14px;
-				margin: 0px 14px 0px 14px;
-			}
-			
-			QScrollBar::handle:horizontal {
-				background-color: #555555;
-				min-width: 20px;
-				border-radius: 3px;
-			}
-			
-			QScrollBar::handle:horizontal:hover {
-				background-color: #666666;
-			}
-			
-			QScrollBar::add-line:horizontal, QScrollBar::sub-line:horizontal {
-				border: none;
-				background: none;
-				width: 14px;
-			}
-			
-			QLabel {
-				color: #dcdcdc;
-			}
-			
-			QComboBox {
-				background-color: #2d2d2d;
-				color: #dcdcdc;
-				border: 1px solid #444;
-				border-radius: 3px;
-				padding: 2px 8px;
-			}
-			
-			QComboBox::drop-down {
-				subcontrol-origin: padding;
-				subcontrol-position: top right;
-				width: 20px;
-				border-left: 1px solid #444;
-			}
-			
-			QComboBox QAbstractItemView {
-				background-color: #2d2d2d;
-				color: #dcdcdc;
-				border: 1px solid #444;
-				selection-background-color: #3e3e3e;
-			}
-			
-			QSpinBox, QDoubleSpinBox {
-				background-color: #2d2d2d;
-				color: #dcdcdc;
-				border: 1px solid #444;
-				border-radius: 3px;
-				padding: 2px 5px;
-			}
-			
-			QGroupBox {
-				border: 1px solid #444;
-				border-radius: 5px;
-				margin-top: 8px;
-				padding-top: 8px;
-			}
-			
-			QGroupBox::title {
-				subcontrol-origin: margin;
-				subcontrol-position: top left;
-				left: 10px;
-				color: #dcdcdc;
-			}
-		`
-	} else {
-		preferences.ThemeSettings.LineNumberAreaColor = gui.NewQColor3(240, 240, 240, 255)
-		// Light theme styles
-		styleSheet = `
-			* {
-				transition: background-color 0ms, color 0ms, border 0ms;
-			}
-			
-			QWidget {
-				background-color: #f5f5f5;
-				color: #212121;
-			}
-			
-			QMenuBar {
-				background-color: #f0f0f0;
-				color: #212121;
-				border-bottom: 1px solid #e0e0e0;
-			}
-			
-			QMenuBar::item:selected {
-				background-color: #e3f2fd;
-			}
-			
-			QMenu {
-				background-color: #ffffff;
-				color: #212121;
-				border: 1px solid #e0e0e0;
-			}
-			
-			QMenu::item:selected {
-				background-color: #e3f2fd;
-			}
-			
-			QToolBar {
-				background-color: #f0f0f0;
-				border-bottom: 1px solid #e0e0e0;
-				spacing: 3px;
-			}
-			
-			QToolButton {
-				background-color: #f0f0f0;
-				color: #212121;
-				border: none;
-				border-radius: 3px;
-				padding: 3px;
-			}
-			
-			QToolButton:hover {
-				background-color: #e3f2fd;
-			}
-			
-			QToolButton:pressed {
-				background-color: #bbdefb;
-			}
-			
-			QLineEdit {
-				background-color: #ffffff;
-				color: #212121;
-				border: 1px solid #e0e0e0;
-				border-radius: 2px;
-				padding: 2px;
-			}
-			
-			QPlainTextEdit, QTextEdit {
-				background-color: #ffffff;
-				color: #212121;
-				border: 1px solid #e0e0e0;
-				selection-background-color: #bbdefb;
-				selection-color: #212121;
-			}
-			
-			QTreeView, QListView, QTableView {
-				background-color: #ffffff;
-				color: #212121;
-				border: 1px solid #e0e0e0;
-				alternate-background-color: #f9f9f9;
-			}
-			
-			QTreeView::item:selected, QListView::item:selected, QTableView::item:selected {
-				background-color: #bbdefb;
-				color: #212121;
-			}
-			
-			QTreeView::item:hover, QListView::item:hover, QTableView::item:hover {
-				background-color: #e3f2fd;
-			}
-			
-			QTreeView::branch {
-				background-color: #ffffff;
-			}
-			
-			QHeaderView::section {
-				background-color: #f0f0f0;
-				color: #212121;
-				border: 1px solid #e0e0e0;
-				padding: 4px;
-			}
-			
-			QPushButton {
-				background-color: #f0f0f0;
-				color: #212121;
-				border: 1px solid #e0e0e0;
-				padding: 5px 15px;
-				border-radius: 3px;
-			}
-			
-			QPushButton:hover {
-				background-color: #e3f2fd;
-			}
-			
-			QPushButton:pressed {
-				background-color: #bbdefb;
-			}
-			
-			QPushButton:disabled {
-				background-color: #f5f5f5;
-				color: #9e9e9e;
-				border: 1px solid #e0e0e0;
-			}
-			
-			QTabWidget::pane {
-				border: 1px solid #e0e0e0;
-				background-color: #ffffff;
-			}
-			
-			QTabBar::tab {
-				background-color: #f0f0f0;
-				color: #757575;
-				padding: 5px 10px;
-				border: 1px solid #e0e0e0;
-				border-bottom: none;
-				border-top-left-radius: 3px;
-				border-top-right-radius: 3px;
-			}
-			
-			QTabBar::tab:selected {
-				background-color: #ffffff;
-				color: #212121;
-			}
-			
-			QTabBar::tab:hover:!selected {
-				background-color: #e3f2fd;
-			}
-			
-			QStatusBar {
-				background-color: #f0f0f0;
-				color: #212121;
-				border-top: 1px solid #e0e0e0;
-			}
-			
-			QScrollBar:vertical {
-				background-color: #f0f0f0;
-				width: 14px;
-				margin: 14px 0px 14px 0px;
-			}
-			
-			QScrollBar::handle:vertical {
-				background-color: #bdbdbd;
-				min-height: 20px;
-				border-radius: 3px;
-			}
-			
-			QScrollBar::handle:vertical:hover {
-				background-color: #9e9e9e;
-			}
-			
-			QScrollBar::add-line:vertical, QScrollBar::sub-line:vertical {
-				border: none;
-				background: none;
-				height: 14px;
-			}
-			
-			QScrollBar:horizontal {
-				background-color: #f0f0f0;
-				height: 14px;
-				margin: 0px 14px 0px 14px;
-			}
-			
-			QScrollBar::handle:horizontal {
-				background-color: #bdbdbd;
-				min-width: 20px;
-				border-radius: 3px;
-			}
-			
-			QScrollBar::handle:horizontal:hover {
-				background-color: #9e9e9e;
-			}
-			
-			QScrollBar::add-line:horizontal, QScrollBar::sub-line:horizontal {
-				border: none;
-				background: none;
-				width: 14px;
-			}
-			
-			QLabel {
-				color: #212121;
-			}
-			
-			QComboBox {
-				background-color: #f0f0f0;
-				color: #212121;
-				border: 1px solid #e0e0e0;
-				border-radius: 3px;
-				padding: 2px 8px;
-			}
-			
-			QComboBox::drop-down {
-				subcontrol-origin: padding;
-				subcontrol-position: top right;
-				width: 20px;
-				border-left: 1px solid #e0e0e0;
-			}
-			
-			QComboBox QAbstractItemView {
-				background-color: #ffffff;
-				color: #212121;
-				border: 1px solid #e0e0e0;
-				selection-background-color: #e3f2fd;
-			}
-			
-			QSpinBox, QDoubleSpinBox {
-				background-color: #f0f0f0;
-				color: #212121;
-				border: 1px solid #e0e0e0;
-				border-radius: 3px;
-				padding: 2px 5px;
-			}
-			
-			QGroupBox {
-				border: 1px solid #e0e0e0;
-				border-radius: 5px;
-				margin-top: 8px;
-				padding-top: 8px;
-			}
-			
-			QGroupBox::title {
-				subcontrol-origin: margin;
-				subcontrol-position: top left;
-				left: 10px;
-				color: #212121;
-			}
-		`
+	// Recolour the code and the gutters of every open editor
+	setupSyntaxHighlighting()
+	for _, e := range openEditors {
+		e.lineNumberArea.Update()
 	}
 
-	// Apply stylesheet to application
-	app.SetStyleSheet(styleSheet)
 	// Force immediate update to prevent white flash
 	app.ProcessEvents(core.QEventLoop__AllEvents)
 }
 
+// themeNames lists the choices of theme: Auto, then every theme
+func themeNames() []string {
+	names := []string{ThemeAuto}
+	for _, theme := range loadThemes() {
+		names = append(names, theme.Name)
+	}
+	return names
+}
+
+// systemThemeName picks Light or Dark from the desktop's palette. Style
+// sheets do not change the application palette, so it still reflects the
+// desktop after a theme is applied.
+func systemThemeName() string {
+	if gui.QGuiApplication_Palette().Color2(gui.QPalette__Window).Lightness() < 128 {
+		return ThemeDark
+	}
+	return ThemeLight
+}
+
+// followSystemTheme switches between Light and Dark when the desktop does,
+// if the theme is Auto
+func followSystemTheme() {
+	if preferences.ThemeSettings.ThemeName != ThemeAuto || systemThemeName() == activeTheme.Name {
+		return
+	}
+	applyTheme(ThemeAuto)
+}
+
+// populateThemeMenu lists the themes with the current one checked, so
+// themes added to the themes folder show up without a restart
+func populateThemeMenu(menu *widgets.QMenu) {
+	menu.Clear()
+	group := widgets.NewQActionGroup(menu)
+	for _, name := range themeNames() {
+		action := menu.AddAction(name)
+		action.SetCheckable(true)
+		action.SetChecked(name == preferences.ThemeSettings.ThemeName)
+		group.AddAction(action)
+		action.ConnectTriggered(func(bool) { SetTheme(name) })
+	}
+}
+
+// HighlightRule is how one class of tokens is drawn
 type HighlightRule struct {
-	Pattern string
-	Format  *gui.QTextCharFormat
-	Color   *gui.QColor
-	Bold    bool
+	Color  string `json:"color,omitempty"` // "#rrggbb", empty for the text colour
+	Bold   bool   `json:"bold,omitempty"`
+	Italic bool   `json:"italic,omitempty"`
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Built-in themes, the style sheet every theme fills in with its colours
+// and the built-in syntax schemes
+//
+//go:embed themes/*.json themes/base.qss schemes/*.json
+var builtinThemeFiles embed.FS
+
+// Theme is everything that makes up a look: the application style sheet
+// colours, the editor and gutter colours and the syntax colours. Themes
+// are JSON files, built in or in the themes folder of the config directory.
+type Theme struct {
+	Name       string            `json:"name"`
+	Dark       bool              `json:"dark"`
+	Colors     map[string]string `json:"colors"`               // Used as @name in the style sheet
+	StyleSheet string            `json:"styleSheet,omitempty"` // Extra QSS file next to the theme, appended to the built-in one
+	Editor     EditorColors      `json:"editor"`
+	Gutter     GutterColors      `json:"gutter"`
+	Syntax     SyntaxScheme      `json:"syntax"`
+
+	path string // File the theme was loaded from, empty for built-ins
+}
+
+// EditorColors are the colours of the code editor and the other text views
+type EditorColors struct {
+	Background   string `json:"background"`
+	Text         string `json:"text"`
+	Selection    string `json:"selection"`
+	SelectedText string `json:"selectedText"`
+}
+
+// GutterColors are the colours of the line number area
+type GutterColors struct {
+	Background string `json:"background"`
+	LineNumber string `json:"lineNumber"`
+	Breakpoint string `json:"breakpoint"`
+	DebugLine  string `json:"debugLine"` // Usually translucent, as #aarrggbb
+	FoldMarker string `json:"foldMarker"`
+}
+
+// ThemeHighContrast is the name of the built-in high contrast theme
+const ThemeHighContrast = "High Contrast"
+
+// activeTheme is the theme the application is drawn with
+var activeTheme Theme
+
+// themesDir is where users put their own themes
+func themesDir() string {
+	return filepath.Join(filepath.Dir(preferencesPath), "themes")
+}
+
+// parseTheme reads a theme file
+func parseTheme(data []byte) (Theme, error) {
+	var theme Theme
+	if err := json.Unmarshal(data, &theme); err != nil {
+		return theme, fmt.Errorf("failed to parse theme: %v", err)
+	}
+	if theme.Name == "" {
+		return theme, fmt.Errorf("theme has no name")
+	}
+	return theme, nil
+}
+
+// builtinThemes returns the themes shipped with the IDE
+func builtinThemes() []Theme {
+	var themes []Theme
+	for _, name := range []string{"light", "dark", "high-contrast"} {
+		data, err := builtinThemeFiles.ReadFile("themes/" + name + ".json")
+		if err != nil {
+			continue
+		}
+		if theme, err := parseTheme(data); err == nil {
+			themes = append(themes, theme)
+		}
+	}
+	return themes
+}
+
+// loadThemes returns the built-in themes followed by the user's, a user
+// theme with the name of a built-in one replacing it
+func loadThemes() []Theme {
+	themes := builtinThemes()
+	if preferencesPath == "" {
+		return themes
+	}
+	if err := os.MkdirAll(themesDir(), 0755); err != nil {
+		fmt.Printf("Failed to create themes folder: %v\n", err)
+		return themes
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(themesDir(), "*.json"))
+	sort.Strings(paths)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Failed to read theme %s: %v\n", path, err)
+			continue
+		}
+		theme, err := parseTheme(data)
+		if err != nil {
+			fmt.Printf("Ignoring theme %s: %v\n", path, err)
+			continue
+		}
+		theme.path = path
+
+		replaced := false
+		for i := range themes {
+			if themes[i].Name == theme.Name {
+				themes[i] = theme
+				replaced = true
+			}
+		}
+		if !replaced {
+			themes = append(themes, theme)
+		}
+	}
+	return themes
+}
+
+// themeByName finds a theme, falling back to the light one. Auto is the
+// light or dark theme, as the desktop is. What a theme leaves out is taken
+// from the built-in light or dark theme.
+func themeByName(name string) Theme {
+	if name == ThemeAuto {
+		name = systemThemeName()
+	}
+	themes := loadThemes()
+	for _, theme := range themes {
+		if theme.Name == name {
+			return theme.withDefaults()
+		}
+	}
+	return themes[0].withDefaults()
+}
+
+// withDefaults fills in what a theme leaves out from the built-in light or
+// dark theme
+func (t Theme) withDefaults() Theme {
+	baseName := ThemeLight
+	if t.Dark {
+		baseName = ThemeDark
+	}
+	var base Theme
+	for _, theme := range builtinThemes() {
+		if theme.Name == baseName {
+			base = theme
+		}
+	}
+
+	colors := make(map[string]string)
+	for name, color := range base.Colors {
+		colors[name] = color
+	}
+	for name, color := range t.Colors {
+		colors[name] = color
+	}
+	t.Colors = colors
+
+	orDefault := func(color *string, fallback string) {
+		if *color == "" {
+			*color = fallback
+		}
+	}
+	orDefault(&t.Editor.Background, base.Editor.Background)
+	orDefault(&t.Editor.Text, base.Editor.Text)
+	orDefault(&t.Editor.Selection, base.Editor.Selection)
+	orDefault(&t.Editor.SelectedText, base.Editor.SelectedText)
+	orDefault(&t.Gutter.Background, base.Gutter.Background)
+	orDefault(&t.Gutter.LineNumber, base.Gutter.LineNumber)
+	orDefault(&t.Gutter.Breakpoint, base.Gutter.Breakpoint)
+	orDefault(&t.Gutter.DebugLine, base.Gutter.DebugLine)
+	orDefault(&t.Gutter.FoldMarker, base.Gutter.FoldMarker)
+
+	t.Syntax = t.Syntax.withDefaults(base.Syntax)
+	return t
+}
+
+// styleSheet fills the shared style sheet with the theme's colours and
+// appends the theme's own style sheet, if it has one
+func (t Theme) styleSheet() string {
+	data, err := builtinThemeFiles.ReadFile("themes/base.qss")
+	if err != nil {
+		return ""
+	}
+
+	colors := make(map[string]string)
+	for name, color := range t.Colors {
+		colors[name] = color
+	}
+	colors["editorBackground"] = t.Editor.Background
+	colors["editorText"] = t.Editor.Text
+	colors["editorSelection"] = t.Editor.Selection
+	colors["editorSelectedText"] = t.Editor.SelectedText
+
+	// Longer names first so @scrollHandle does not replace the start of @scrollHandleHover
+	names := make([]string, 0, len(colors))
+	for name := range colors {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	var replacements []string
+	for _, name := range names {
+		replacements = append(replacements, "@"+name, colors[name])
+	}
+	styleSheet := strings.NewReplacer(replacements...).Replace(string(data))
+
+	if t.StyleSheet != "" && t.path != "" {
+		extra, err := os.ReadFile(filepath.Join(filepath.Dir(t.path), t.StyleSheet))
+		if err != nil {
+			fmt.Printf("Failed to read style sheet of theme %s: %v\n", t.Name, err)
+		} else {
+			styleSheet += "\n" + string(extra)
+		}
+	}
+	return styleSheet
+}
+
+// errorInputStyle marks a search field that found nothing
+func errorInputStyle() string {
+	return fmt.Sprintf("QLineEdit { background-color: %s; }", activeTheme.Colors["errorBackground"])
+}